@@ -0,0 +1,42 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zakkor/server/toolfns"
+)
+
+// GetArtifact serves the content of an artifact to requests that are authorized or carry the artifact's signature.
+func (tr *ToolHandler) GetArtifact(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorized(r) && !tr.Artifacts.Verify(id, r.URL.Query().Get("sig")) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	a, path, ok := tr.Artifacts.Get(id)
+	if !ok {
+		writeError(w, toolfns.Errorf(toolfns.CodeNotFound, "artifact not found: %s", id))
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		writeError(w, toolfns.Errorf(toolfns.CodeInternal, "open artifact: %v", err))
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": a.Name}))
+	// Tool output is untrusted, keep HTML artifacts from running scripts on the tool server's origin.
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, a.Name, a.CreatedAt, f)
+}
+
+func (tr *ToolHandler) ListArtifacts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: tr.Artifacts.List(r.URL.Query().Get("chat_id"))})
+}
@@ -0,0 +1,229 @@
+// Package artifacts stores the files tools produce, so they can be served over HTTP instead of being inlined in tool
+// results.
+package artifacts
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+var ErrQuotaExceeded = errors.New("artifact quota exceeded")
+
+// Artifact is a file registered by a tool. Its content is stored by its SHA-256 Hash, so identical files are stored
+// once. Its ID identifies the content in the chat, so every chat has its own name and content type for it.
+type Artifact struct {
+	ID          string    `json:"id"`
+	Hash        string    `json:"hash"`
+	ChatID      string    `json:"chat_id,omitempty"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	URL         string    `json:"url"`
+}
+
+type Store struct {
+	dir string
+	// key signs artifact URLs, so they can be opened without the Authorization header.
+	key       []byte
+	retention time.Duration
+	quota     int64
+
+	mu        sync.Mutex
+	artifacts []Artifact
+}
+
+// Open opens the store in dir, creating it if needed. Artifacts older than retention are deleted, and a chat cannot
+// store more than quota bytes. Zero disables either limit.
+func Open(dir string, key []byte, retention time.Duration, quota int64) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:       dir,
+		key:       key,
+		retention: retention,
+		quota:     quota,
+	}
+
+	b, err := os.ReadFile(s.indexPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &s.artifacts); err != nil {
+			return nil, fmt.Errorf("read artifact index: %w", err)
+		}
+	}
+	// Artifacts stored before they had a hash were identified by it.
+	for i := range s.artifacts {
+		if s.artifacts[i].Hash == "" {
+			s.artifacts[i].Hash = s.artifacts[i].ID
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.prune(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Put stores data as an artifact of the given chat. If the chat already stored the same content, that artifact is
+// returned instead, and kept for another retention period.
+func (s *Store) Put(chatID, name, contentType string, data []byte) (Artifact, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	idSum := sha256.Sum256([]byte(chatID + "\x00" + hash))
+	id := hex.EncodeToString(idSum[:16])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.prune(); err != nil {
+		return Artifact{}, err
+	}
+	if i := slices.IndexFunc(s.artifacts, func(a Artifact) bool { return a.ID == id }); i >= 0 {
+		s.artifacts[i].CreatedAt = time.Now()
+		return s.artifacts[i], s.save()
+	}
+	if s.quota > 0 && s.usage(chatID)+int64(len(data)) > s.quota {
+		return Artifact{}, ErrQuotaExceeded
+	}
+
+	path := s.blobPath(hash)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := writeFileAtomic(path, data); err != nil {
+			return Artifact{}, err
+		}
+	}
+
+	a := Artifact{
+		ID:          id,
+		Hash:        hash,
+		ChatID:      chatID,
+		Name:        name,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		CreatedAt:   time.Now(),
+		URL:         s.url(id),
+	}
+	s.artifacts = append(s.artifacts, a)
+	return a, s.save()
+}
+
+// Get returns the artifact with the given ID and the path of its content.
+func (s *Store) Get(id string) (Artifact, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.artifacts {
+		if a.ID == id {
+			return a, s.blobPath(a.Hash), true
+		}
+	}
+	return Artifact{}, "", false
+}
+
+// List returns the artifacts of a chat, oldest first.
+func (s *Store) List(chatID string) []Artifact {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []Artifact{}
+	for _, a := range s.artifacts {
+		if a.ChatID == chatID {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+// Verify reports whether sig is the signature of the artifact URL for id.
+func (s *Store) Verify(id, sig string) bool {
+	return hmac.Equal([]byte(sig), []byte(s.sign(id)))
+}
+
+func (s *Store) url(id string) string {
+	return "/artifacts/" + id + "?sig=" + s.sign(id)
+}
+
+func (s *Store) sign(id string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// usage returns the bytes stored by a chat. s.mu must be held.
+func (s *Store) usage(chatID string) int64 {
+	var n int64
+	for _, a := range s.artifacts {
+		if a.ChatID == chatID {
+			n += a.Size
+		}
+	}
+	return n
+}
+
+// prune deletes expired artifacts, and their content once no artifact refers to it. s.mu must be held.
+func (s *Store) prune() error {
+	if s.retention <= 0 {
+		return nil
+	}
+
+	n := len(s.artifacts)
+	s.artifacts = slices.DeleteFunc(s.artifacts, func(a Artifact) bool {
+		return time.Since(a.CreatedAt) > s.retention
+	})
+	if len(s.artifacts) == n {
+		return nil
+	}
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, "blobs"))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		referenced := slices.ContainsFunc(s.artifacts, func(a Artifact) bool { return a.Hash == e.Name() })
+		if !referenced {
+			os.Remove(s.blobPath(e.Name()))
+		}
+	}
+	return s.save()
+}
+
+// save writes the index. s.mu must be held.
+func (s *Store) save() error {
+	b, err := json.MarshalIndent(s.artifacts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.indexPath(), b)
+}
+
+func (s *Store) indexPath() string {
+	return filepath.Join(s.dir, "index.json")
+}
+
+func (s *Store) blobPath(id string) string {
+	return filepath.Join(s.dir, "blobs", id)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/zakkor/server/toolfns"
+)
+
+type batchResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	toolResponse
+}
+
+// InvokeBatch runs an array of tool calls concurrently. A failing call does not fail the batch, its error is reported
+// in its own result. Results are returned in the order of the calls, unless stream=1 is set, in which case each result
+// is written as a line of JSON as soon as its call finishes.
+func (tr *ToolHandler) InvokeBatch(w http.ResponseWriter, r *http.Request) {
+	var calls []toolCall
+	if err := json.NewDecoder(io.TeeReader(r.Body, os.Stdout)).Decode(&calls); err != nil {
+		writeError(w, toolfns.Errorf(toolfns.CodeInvalidArguments, "invalid request body: %v", err))
+		return
+	}
+
+	concurrency := *batchConcurrency
+	if q := r.URL.Query().Get("concurrency"); q != "" {
+		n, err := strconv.Atoi(q)
+		if err != nil || n < 1 {
+			writeError(w, toolfns.Errorf(toolfns.CodeInvalidArguments, "invalid concurrency: %s", q))
+			return
+		}
+		concurrency = n
+	}
+
+	results := make(chan batchResult)
+	go tr.runBatch(r.Context(), calls, concurrency, results)
+
+	if r.URL.Query().Get("stream") == "1" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		rc := http.NewResponseController(w)
+		enc := json.NewEncoder(w)
+		for res := range results {
+			enc.Encode(res)
+			rc.Flush()
+		}
+		return
+	}
+
+	ordered := make([]batchResult, len(calls))
+	for res := range results {
+		ordered[res.Index] = res
+	}
+	writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: ordered})
+}
+
+// runBatch sends the result of every call to results, closing it once all calls are done.
+func (tr *ToolHandler) runBatch(ctx context.Context, calls []toolCall, concurrency int, results chan<- batchResult) {
+	defer close(results)
+
+	sem := make(chan struct{}, concurrency)
+	last := make(map[string]chan struct{})
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		// Each locked call waits for the previous call holding the same lock.
+		var wait, done chan struct{}
+		if call.Lock != "" {
+			wait = last[call.Lock]
+			done = make(chan struct{})
+			last[call.Lock] = done
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if done != nil {
+				defer close(done)
+			}
+			if wait != nil {
+				<-wait
+			}
+
+			sem <- struct{}{}
+			out, warnings, err := tr.call(ctx, call, io.Discard)
+			<-sem
+
+			res := batchResult{Index: i, ID: call.ID}
+			res.Warnings = warnings
+			if err != nil {
+				res.Error = err
+			} else {
+				res.OK, res.Result, res.DryRun = true, out, tr.isDryRun(call)
+			}
+			results <- res
+		}()
+	}
+	wg.Wait()
+}
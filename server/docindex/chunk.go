@@ -0,0 +1,163 @@
+package docindex
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxChunkLines and maxChunkBytes bound the size of a chunk. Chunks end early at a blank line once they have
+	// minChunkLines, and before every Markdown heading.
+	maxChunkLines = 40
+	maxChunkBytes = 2000
+	minChunkLines = 15
+)
+
+type span struct {
+	start, end int
+	text       string
+}
+
+// chunkText splits text into passages of whole lines, numbered from 1.
+func chunkText(text string, markdown bool) []span {
+	var (
+		chunks []span
+		cur    []string
+		size   int
+		start  = 1
+	)
+	flush := func(next int) {
+		for len(cur) > 0 && strings.TrimSpace(cur[len(cur)-1]) == "" {
+			cur = cur[:len(cur)-1]
+		}
+		if len(cur) > 0 {
+			chunks = append(chunks, span{start: start, end: start + len(cur) - 1, text: strings.Join(cur, "\n")})
+		}
+		cur, size, start = nil, 0, next
+	}
+
+	inFence := false
+	for i, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		n := i + 1
+		trimmed := strings.TrimSpace(line)
+		if markdown && strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		heading := markdown && !inFence && strings.HasPrefix(trimmed, "#")
+		if len(cur) > 0 && (heading || len(cur) >= maxChunkLines || size+len(line) > maxChunkBytes ||
+			trimmed == "" && len(cur) >= minChunkLines) {
+			flush(n)
+		}
+		if len(cur) == 0 && trimmed == "" {
+			start = n + 1
+			continue
+		}
+		// Minified files have lines longer than a chunk.
+		if len(line) > maxChunkBytes {
+			line = strings.ToValidUTF8(line[:maxChunkBytes], "")
+		}
+		cur = append(cur, line)
+		size += len(line) + 1
+	}
+	flush(start + len(cur))
+	return chunks
+}
+
+// stopWords are left out of the index, since almost every passage contains them.
+var stopWords = map[string]bool{
+	"a": true, "about": true, "an": true, "and": true, "any": true, "are": true, "as": true, "at": true, "be": true,
+	"been": true, "but": true, "by": true, "can": true, "do": true, "does": true, "for": true, "from": true,
+	"had": true, "has": true, "have": true, "how": true, "if": true, "in": true, "into": true, "is": true, "it": true,
+	"its": true, "no": true, "not": true, "of": true, "on": true, "or": true, "our": true, "so": true, "than": true,
+	"that": true, "the": true, "their": true, "then": true, "there": true, "these": true, "they": true, "this": true,
+	"to": true, "was": true, "we": true, "were": true, "what": true, "when": true, "where": true, "which": true,
+	"who": true, "why": true, "will": true, "with": true, "you": true, "your": true,
+}
+
+// tokenize splits text into lower case, stemmed terms. Identifiers like parseConfig or parse_config are indexed both whole
+// and by their words, so that code and prose find each other.
+func tokenize(text string) []string {
+	var terms []string
+	add := func(word string) {
+		if w := strings.ToLower(word); len(w) > 1 && !stopWords[w] {
+			terms = append(terms, stem(w))
+		}
+	}
+
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' })
+	for _, word := range words {
+		word = strings.Trim(word, "_")
+		parts := splitIdentifier(word)
+		if len(parts) > 1 {
+			add(strings.ReplaceAll(word, "_", ""))
+		}
+		for _, p := range parts {
+			add(p)
+		}
+	}
+	return terms
+}
+
+// splitIdentifier splits a word at underscores and where its case changes, e.g. HTTPServerError into HTTP, Server
+// and Error.
+func splitIdentifier(word string) []string {
+	var parts []string
+	for _, w := range strings.Split(word, "_") {
+		runes := []rune(w)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			lowerToUpper := unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i])
+			acronymEnd := i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i]) &&
+				unicode.IsLower(runes[i+1])
+			if lowerToUpper || acronymEnd {
+				parts = append(parts, string(runes[start:i]))
+				start = i
+			}
+		}
+		if start < len(runes) {
+			parts = append(parts, string(runes[start:]))
+		}
+	}
+	return parts
+}
+
+func uniqueTerms(text string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, t := range tokenize(text) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// stem strips the common English suffixes from word, so that e.g. "rolling", "rolled" and "rolls" all become "roll".
+// It is much simpler than a real stemmer, but it only has to map words to the same term as their variants.
+func stem(word string) string {
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "ing") && len(word) > 5:
+		return undouble(word[:len(word)-3])
+	case strings.HasSuffix(word, "ed") && len(word) > 4:
+		return undouble(word[:len(word)-2])
+	case strings.HasSuffix(word, "es") && len(word) > 4 && strings.ContainsAny(word[len(word)-3:len(word)-2], "sxz"),
+		strings.HasSuffix(word, "ches") || strings.HasSuffix(word, "shes"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") &&
+		len(word) > 3:
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// undouble removes the consonant doubled before a suffix, e.g. in "stopped".
+func undouble(word string) string {
+	n := len(word)
+	if n > 2 && word[n-1] == word[n-2] && !strings.ContainsRune("aeioulsz", rune(word[n-1])) {
+		return word[:n-1]
+	}
+	return word
+}
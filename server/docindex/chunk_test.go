@@ -0,0 +1,79 @@
+package docindex
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestChunkText(t *testing.T) {
+	lines := func(n int) string {
+		return strings.TrimSuffix(strings.Repeat("line\n", n), "\n")
+	}
+	tests := []struct {
+		name     string
+		text     string
+		markdown bool
+		want     []span
+	}{
+		{"short", "a\nb\n\nc", false, []span{{1, 4, "a\nb\n\nc"}}},
+		{"leading and trailing blank lines", "\n\na\r\nb\n\n", false, []span{{3, 4, "a\nb"}}},
+		{"headings", "# A\ntext\n## B\nmore", true, []span{{1, 2, "# A\ntext"}, {3, 4, "## B\nmore"}}},
+		{"headings in text", "# A\ntext\n## B\nmore", false, []span{{1, 4, "# A\ntext\n## B\nmore"}}},
+		{"comment in a code block", "# A\n```sh\n# comment\n```", true, []span{{1, 4, "# A\n```sh\n# comment\n```"}}},
+		{"long", lines(100), false, []span{{1, 40, lines(40)}, {41, 80, lines(40)}, {81, 100, lines(20)}}},
+		{"blank line", lines(20) + "\n\n" + lines(5), false, []span{{1, 20, lines(20)}, {22, 26, lines(5)}}},
+	}
+	for _, tt := range tests {
+		if got := chunkText(tt.text, tt.markdown); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: chunkText = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// Lines longer than a chunk are cut, on a rune boundary.
+	got := chunkText(strings.Repeat("é", maxChunkBytes), false)
+	if len(got) != 1 || len(got[0].text) != maxChunkBytes || !strings.HasSuffix(got[0].text, "é") {
+		t.Errorf("chunkText of a long line = %d chunks, want one of %d bytes", len(got), maxChunkBytes)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"The rolling of a log", []string{"roll", "log"}},
+		{"parseConfig", []string{"parseconfig", "parse", "config"}},
+		{"_parse_config_", []string{"parseconfig", "parse", "config"}},
+		{"HTTPServerError", []string{"httpservererror", "http", "server", "error"}},
+		{"v2 API, größe", []string{"v2", "api", "größe"}},
+	}
+	for _, tt := range tests {
+		if got := tokenize(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		"rolling": "roll",
+		"rolled":  "roll",
+		"rolls":   "roll",
+		"running": "run",
+		"stopped": "stop",
+		"queries": "query",
+		"boxes":   "box",
+		"matches": "match",
+		"class":   "class",
+		"status":  "status",
+		"sing":    "sing",
+		"bus":     "bus",
+	}
+	for word, want := range tests {
+		if got := stem(word); got != want {
+			t.Errorf("stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+// Package docindex keeps a full-text index of the documents in a set of directories, like design docs, runbooks and
+// PDFs, and ranks passages of them with BM25. Optionally it also keeps embeddings of the passages, to find the ones
+// that match a query in meaning rather than words.
+package docindex
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Passage is a chunk of a document that matches a query. File is the path of the document, starting with the name
+// of the directory it was found in, and the directories above it if other directories have the same name.
+type Passage struct {
+	File    string  `json:"file"`
+	Line    int     `json:"line"`
+	EndLine int     `json:"end_line"`
+	Score   float64 `json:"score"`
+	// Keyword and Similarity are the BM25 score and the cosine similarity to the query of a passage that
+	// SemanticSearch found, if it was found that way.
+	Keyword    float64 `json:"keyword,omitempty"`
+	Similarity float64 `json:"similarity,omitempty"`
+	Text       string  `json:"text"`
+}
+
+const (
+	// maxFileSize is the largest text file that is indexed. PDFs can be larger, since most of them is not text.
+	maxFileSize    = 8 << 20
+	maxPDFFileSize = 64 << 20
+
+	// BM25 parameters.
+	k1 = 1.2
+	b  = 0.75
+)
+
+// extensions are the kinds of files that are indexed.
+var extensions = map[string]bool{
+	".md": true, ".markdown": true, ".txt": true, ".rst": true, ".adoc": true, ".org": true, ".pdf": true,
+	".go": true, ".py": true, ".js": true, ".ts": true, ".jsx": true, ".tsx": true, ".svelte": true, ".java": true,
+	".kt": true, ".c": true, ".h": true, ".cc": true, ".cpp": true, ".hpp": true, ".rs": true, ".rb": true, ".php": true,
+	".cs": true, ".swift": true, ".sh": true, ".sql": true, ".html": true, ".css": true, ".yaml": true, ".yml": true,
+	".toml": true, ".json": true, ".proto": true, ".tf": true,
+}
+
+type Index struct {
+	roots []string
+	// names are the names of roots in the paths of passages.
+	names []string
+	path  string
+
+	// refreshMu is held by Refresh, which reads the documents without holding mu, so that searches are not blocked.
+	refreshMu sync.Mutex
+	mu        sync.Mutex
+	state     state
+	// postings maps every term to the chunks it occurs in. It is kept in the state file, and in memory by term.
+	postings map[string][]Posting
+
+	// embedder, if set, embeds the chunks for SemanticSearch, in the background until embedCtx is done. embedMu is
+	// held while chunks are embedded, and vecMu guards vectors and embedErr, the error of the last time they were.
+	embedder *Embedder
+	embedCtx context.Context
+	vecPath  string
+	embedMu  sync.Mutex
+	vecMu    sync.Mutex
+	vectors  vectors
+	embedErr error
+}
+
+// state is what the index keeps on disk.
+type state struct {
+	Files    map[string]*File
+	Chunks   map[int]*Chunk
+	Postings map[string][]Posting
+	NextID   int
+	// TotalLen is the sum of the lengths of the chunks, in terms.
+	TotalLen int
+}
+
+// File is an indexed document. Files whose modification time and size did not change are not indexed again.
+type File struct {
+	ModTime time.Time
+	Size    int64
+	// Name is the path of the file in passages. Files are indexed again when it changes, e.g. because another root
+	// with the same name was added.
+	Name   string
+	Chunks []int
+}
+
+// Chunk is a passage of a document, the unit the index ranks.
+type Chunk struct {
+	ID   int
+	File string
+	// Start and End are the first and last line of the chunk.
+	Start, End int
+	Text       string
+	// Len is the number of terms in the chunk.
+	Len int
+	// Hash is the hash of Text, which the chunk's embedding is kept by.
+	Hash string
+}
+
+type Posting struct {
+	Chunk int
+	Freq  int
+}
+
+// Open opens the index kept in dir, creating it if needed, of the documents in roots. It is brought up to date by
+// Refresh.
+func Open(dir string, roots []string) (*Index, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	idx := &Index{path: filepath.Join(dir, "index.gob"), vecPath: filepath.Join(dir, "vectors.gob")}
+	for _, r := range roots {
+		abs, err := filepath.Abs(r)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(idx.roots, abs) {
+			idx.roots = append(idx.roots, abs)
+		}
+	}
+	idx.names = rootNames(idx.roots)
+
+	data, err := os.ReadFile(idx.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	// An index that cannot be read, e.g. because it was written by an older version, is built again.
+	if len(data) == 0 || gob.NewDecoder(bytes.NewReader(data)).Decode(&idx.state) != nil {
+		idx.state = state{Files: map[string]*File{}, Chunks: map[int]*Chunk{}, Postings: map[string][]Posting{}}
+	}
+	idx.postings = idx.state.Postings
+	return idx, nil
+}
+
+// Roots returns the directories the index covers.
+func (idx *Index) Roots() []string {
+	return idx.roots
+}
+
+// rootNames names every root by its base name, or, if other roots have the same one, by as many of the directories
+// above it as tell them apart.
+func rootNames(roots []string) []string {
+	names := make([]string, len(roots))
+	depths := make([]int, len(roots))
+	for i := range roots {
+		depths[i] = 1
+	}
+	for {
+		count := map[string]int{}
+		for i, root := range roots {
+			names[i] = lastElems(root, depths[i])
+			count[names[i]]++
+		}
+		done := true
+		for i, root := range roots {
+			if count[names[i]] > 1 && lastElems(root, depths[i]+1) != names[i] {
+				depths[i]++
+				done = false
+			}
+		}
+		if done {
+			return names
+		}
+	}
+}
+
+// lastElems returns the last n elements of path, joined with slashes.
+func lastElems(path string, n int) string {
+	elems := strings.Split(strings.Trim(filepath.ToSlash(path), "/"), "/")
+	return strings.Join(elems[max(0, len(elems)-n):], "/")
+}
+
+// Refresh indexes the documents that were added or changed since the last refresh, and forgets the ones that were
+// deleted. It returns whether anything changed. Roots that cannot be read are reported, and the documents of the
+// others are still indexed.
+func (idx *Index) Refresh() (bool, error) {
+	idx.refreshMu.Lock()
+	defer idx.refreshMu.Unlock()
+
+	// The documents are listed and read without holding mu, since extracting the text of PDFs takes a while.
+	var (
+		found []document
+		errs  []error
+	)
+	for i, root := range idx.roots {
+		docs, err := walkRoot(root, idx.names[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("index %s: %w", root, err))
+		}
+		found = append(found, docs...)
+	}
+
+	idx.mu.Lock()
+	var stale []*document
+	for i := range found {
+		d := &found[i]
+		if f := idx.state.Files[d.path]; f == nil || !f.ModTime.Equal(d.info.ModTime()) || f.Size != d.info.Size() ||
+			f.Name != d.name {
+			stale = append(stale, d)
+		}
+	}
+	idx.mu.Unlock()
+	for _, d := range stale {
+		d.text, d.ok = readText(d.path, d.info.Size())
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	changed := false
+	for _, d := range stale {
+		idx.remove(d.path)
+		idx.add(d)
+		changed = true
+	}
+	seen := map[string]bool{}
+	for _, d := range found {
+		seen[d.path] = true
+	}
+	for path := range idx.state.Files {
+		if !seen[path] {
+			idx.remove(path)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := idx.save(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+// document is a file Refresh found. text is only read if the file needs to be indexed.
+type document struct {
+	path string
+	// name is the path of the document in passages.
+	name string
+	info fs.FileInfo
+	text string
+	ok   bool
+}
+
+// walkRoot lists the documents in root, which is named name. Unreadable directories are skipped, but a missing root
+// is reported.
+func walkRoot(root, name string) ([]document, error) {
+	var docs []document
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		base := d.Name()
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(base, ".") || base == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !extensions[strings.ToLower(filepath.Ext(base))] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		docs = append(docs, document{path: path, name: filepath.ToSlash(filepath.Join(name, rel)), info: info})
+		return nil
+	})
+	return docs, err
+}
+
+// add indexes the document d. Documents that cannot be read are recorded without chunks, so that they are only read
+// again once they change.
+func (idx *Index) add(d *document) {
+	f := &File{ModTime: d.info.ModTime(), Size: d.info.Size(), Name: d.name}
+	idx.state.Files[d.path] = f
+	if !d.ok {
+		return
+	}
+
+	markdown := slices.Contains([]string{".md", ".markdown"}, strings.ToLower(filepath.Ext(d.path)))
+	for _, c := range chunkText(d.text, markdown) {
+		terms := tokenize(c.text)
+		if len(terms) == 0 {
+			continue
+		}
+		id := idx.state.NextID
+		idx.state.NextID++
+		idx.state.Chunks[id] = &Chunk{ID: id, File: d.name, Start: c.start, End: c.end, Text: c.text, Len: len(terms),
+			Hash: textHash(c.text)}
+		idx.state.TotalLen += len(terms)
+		f.Chunks = append(f.Chunks, id)
+
+		freqs := map[string]int{}
+		for _, t := range terms {
+			freqs[t]++
+		}
+		for t, n := range freqs {
+			idx.postings[t] = append(idx.postings[t], Posting{Chunk: id, Freq: n})
+		}
+	}
+}
+
+// remove forgets the file at path.
+func (idx *Index) remove(path string) {
+	f := idx.state.Files[path]
+	if f == nil {
+		return
+	}
+	delete(idx.state.Files, path)
+	for _, id := range f.Chunks {
+		c := idx.state.Chunks[id]
+		if c == nil {
+			continue
+		}
+		delete(idx.state.Chunks, id)
+		idx.state.TotalLen -= c.Len
+		for _, t := range uniqueTerms(c.Text) {
+			list := slices.DeleteFunc(idx.postings[t], func(p Posting) bool { return p.Chunk == id })
+			if len(list) == 0 {
+				delete(idx.postings, t)
+			} else {
+				idx.postings[t] = list
+			}
+		}
+	}
+}
+
+func (idx *Index) save() error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&idx.state); err != nil {
+		return err
+	}
+	tmp := idx.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.path)
+}
+
+// Search returns the passages that match query best, best first, at most limit of them.
+func (idx *Index) Search(query string, limit int) []Passage {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	scores := idx.scores(query)
+	ids := ranked(scores)
+	passages := []Passage{}
+	for _, id := range ids[:min(limit, len(ids))] {
+		passages = append(passages, idx.passage(id, scores[id]))
+	}
+	return passages
+}
+
+// ranked returns the IDs of the chunks in scores, best first.
+func ranked(scores map[int]float64) []int {
+	ids := make([]int, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b int) int {
+		if scores[a] != scores[b] {
+			if scores[a] > scores[b] {
+				return -1
+			}
+			return 1
+		}
+		return a - b
+	})
+	return ids
+}
+
+// scores returns the BM25 score of every chunk that contains a term of query.
+func (idx *Index) scores(query string) map[int]float64 {
+	scores := map[int]float64{}
+	n := float64(len(idx.state.Chunks))
+	if n == 0 {
+		return scores
+	}
+	avgLen := float64(idx.state.TotalLen) / n
+	for _, t := range uniqueTerms(query) {
+		list := idx.postings[t]
+		if len(list) == 0 {
+			continue
+		}
+		df := float64(len(list))
+		idf := math.Log((n-df+0.5)/(df+0.5) + 1)
+		for _, p := range list {
+			c := idx.state.Chunks[p.Chunk]
+			tf := float64(p.Freq)
+			scores[p.Chunk] += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(c.Len)/avgLen))
+		}
+	}
+	return scores
+}
+
+func (idx *Index) passage(id int, score float64) Passage {
+	c := idx.state.Chunks[id]
+	return Passage{
+		File:    c.File,
+		Line:    c.Start,
+		EndLine: c.End,
+		Score:   round(score),
+		Text:    c.Text,
+	}
+}
+
+// round rounds a score to three decimals, since more precision means nothing to the reader.
+func round(score float64) float64 {
+	return math.Round(score*1000) / 1000
+}
+
+// readText returns the text of the file at path, or false if it is too large or binary.
+func readText(path string, size int64) (string, bool) {
+	if strings.EqualFold(filepath.Ext(path), ".pdf") {
+		if size > maxPDFFileSize {
+			return "", false
+		}
+		text, err := pdfText(path)
+		return text, err == nil && strings.TrimSpace(text) != ""
+	}
+	if size > maxFileSize {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return "", false
+	}
+	return string(data), true
+}
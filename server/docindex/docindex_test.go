@@ -0,0 +1,24 @@
+package docindex
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRootNames(t *testing.T) {
+	tests := []struct {
+		roots []string
+		want  []string
+	}{
+		{[]string{"/srv/docs"}, []string{"docs"}},
+		{[]string{"/a/docs", "/b/docs", "/b/guides"}, []string{"a/docs", "b/docs", "guides"}},
+		{[]string{"/x/a/docs", "/y/a/docs"}, []string{"x/a/docs", "y/a/docs"}},
+		// A root with no directory above it keeps its name, and the others are told apart from it.
+		{[]string{"/docs", "/a/docs"}, []string{"docs", "a/docs"}},
+	}
+	for _, tt := range tests {
+		if got := rootNames(tt.roots); !slices.Equal(got, tt.want) {
+			t.Errorf("rootNames(%q) = %q, want %q", tt.roots, got, tt.want)
+		}
+	}
+}
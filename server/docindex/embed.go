@@ -0,0 +1,122 @@
+package docindex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Embedder gets embeddings from an OpenAI-compatible /v1/embeddings endpoint, e.g. the one of a local Ollama.
+type Embedder struct {
+	// URL is the base URL of the API, e.g. http://localhost:11434, or the URL of the endpoint itself.
+	URL    string
+	Model  string
+	APIKey string
+	Client *http.Client
+}
+
+// embedBatchSize is how many texts are embedded per request.
+const embedBatchSize = 32
+
+func NewEmbedder(url, model, apiKey string) *Embedder {
+	return &Embedder{URL: url, Model: model, APIKey: apiKey, Client: &http.Client{Timeout: 2 * time.Minute}}
+}
+
+func (e *Embedder) endpoint() string {
+	url := strings.TrimRight(e.URL, "/")
+	if strings.HasSuffix(url, "/embeddings") {
+		return url
+	}
+	if strings.HasSuffix(url, "/v1") {
+		return url + "/embeddings"
+	}
+	return url + "/v1/embeddings"
+}
+
+// Embed returns the embeddings of texts, normalized to unit length, in the same order.
+func (e *Embedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var vectors [][]float32
+	for start := 0; start < len(texts); start += embedBatchSize {
+		batch, err := e.embedBatch(ctx, texts[start:min(start+embedBatchSize, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func (e *Embedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": e.Model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("embeddings: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var res struct {
+		Data []embedding `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("embeddings: %w", err)
+	}
+	if len(res.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings: got %d embeddings for %d texts", len(res.Data), len(texts))
+	}
+	slices.SortFunc(res.Data, func(a, b embedding) int { return a.Index - b.Index })
+	vectors := make([][]float32, len(texts))
+	for i, d := range res.Data {
+		vectors[i] = normalize(d.Embedding)
+	}
+	return vectors, nil
+}
+
+type embedding struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+func dot(a, b []float32) float64 {
+	var sum float32
+	for i := range min(len(a), len(b)) {
+		sum += a[i] * b[i]
+	}
+	return float64(sum)
+}
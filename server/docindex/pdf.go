@@ -0,0 +1,378 @@
+package docindex
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/zakkor/server/secrets"
+)
+
+// pdfText extracts the text of the PDF at path with pdftotext, if it is installed. Otherwise it reads the text
+// operators of the content streams itself, which works for most PDFs that documentation tools produce, but not for
+// fonts with custom encodings, whose text is skipped.
+func pdfText(path string) (string, error) {
+	if bin, err := exec.LookPath("pdftotext"); err == nil {
+		cmd := exec.Command(bin, "-q", "-enc", "UTF-8", path, "-")
+		cmd.Env = secrets.ChildEnv(cmd)
+		if out, err := cmd.Output(); err == nil {
+			return strings.ReplaceAll(string(out), "\f", "\n"), nil
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return extractPDFText(data), nil
+}
+
+var (
+	// pdfStream matches the stream keyword after the dictionary of a stream, and not the end of endstream.
+	pdfStream = regexp.MustCompile(`>>\s*stream\r?\n`)
+	// pdfSkipped marks the streams that hold images, fonts or objects rather than page contents.
+	pdfSkipped = regexp.MustCompile(`/Subtype\s*/Image|/FontFile|/Length1|/Type\s*/(?:XRef|ObjStm|Metadata)`)
+)
+
+func extractPDFText(data []byte) string {
+	var out strings.Builder
+	for _, loc := range pdfStream.FindAllIndex(data, -1) {
+		// The dictionary of the stream follows the obj keyword.
+		dictStart := bytes.LastIndex(data[:loc[0]], []byte("obj"))
+		if dictStart < 0 || loc[0]-dictStart > 4096 {
+			continue
+		}
+		dict := data[dictStart:loc[0]]
+		end := bytes.Index(data[loc[1]:], []byte("endstream"))
+		if end < 0 || pdfSkipped.Match(dict) {
+			continue
+		}
+		content := data[loc[1] : loc[1]+end]
+
+		if bytes.Contains(dict, []byte("/Filter")) {
+			if !bytes.Contains(dict, []byte("/FlateDecode")) || bytes.Count(dict, []byte("Decode")) > 1 {
+				continue
+			}
+			r, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				continue
+			}
+			// Streams are often cut short by a few bytes, which leaves the text that was read usable.
+			content, _ = io.ReadAll(io.LimitReader(r, 16<<20))
+		}
+		if text := contentText(content); strings.TrimSpace(text) != "" {
+			out.WriteString(text)
+			out.WriteString("\n")
+		}
+	}
+	return out.String()
+}
+
+// contentText returns the text a content stream shows, with a line break wherever the text moves to a new line.
+func contentText(content []byte) string {
+	var (
+		out      strings.Builder
+		line     strings.Builder
+		operands []any
+		lastY    = "?"
+	)
+	newline := func() {
+		if text := strings.TrimSpace(line.String()); text != "" && readable(text) {
+			out.WriteString(text)
+			out.WriteString("\n")
+		}
+		line.Reset()
+	}
+	show := func(s []byte) {
+		line.WriteString(decodePDFString(s))
+	}
+
+	lex := pdfLexer{data: content}
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			break
+		}
+		op, isOp := tok.(pdfOperator)
+		if !isOp {
+			operands = append(operands, tok)
+			continue
+		}
+		switch op {
+		case "Tj":
+			if s, ok := last(operands).([]byte); ok {
+				show(s)
+			}
+		case "'", `"`:
+			newline()
+			if s, ok := last(operands).([]byte); ok {
+				show(s)
+			}
+		case "TJ":
+			if arr, ok := last(operands).([]any); ok {
+				for _, e := range arr {
+					switch e := e.(type) {
+					case []byte:
+						show(e)
+					case float64:
+						// Large negative adjustments separate words.
+						if e < -200 {
+							line.WriteString(" ")
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if y, ok := operands[len(operands)-1].(float64); ok && y != 0 {
+					newline()
+				} else {
+					line.WriteString(" ")
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				if y := strconv.FormatFloat(toFloat(operands[len(operands)-1]), 'f', -1, 64); y != lastY {
+					newline()
+					lastY = y
+				}
+			}
+		case "T*", "ET":
+			newline()
+		case "ID":
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+	newline()
+	return out.String()
+}
+
+func last(operands []any) any {
+	if len(operands) == 0 {
+		return nil
+	}
+	return operands[len(operands)-1]
+}
+
+func toFloat(v any) float64 {
+	f, _ := v.(float64)
+	return f
+}
+
+// decodePDFString decodes a string of a content stream, which is UTF-16 if it starts with a byte order mark, and
+// otherwise close enough to Latin-1.
+func decodePDFString(s []byte) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		u := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			u = append(u, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	runes := make([]rune, len(s))
+	for i, c := range s {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// readable reports whether text is mostly letters, digits, punctuation and spaces, which text in fonts with custom
+// encodings is not.
+func readable(text string) bool {
+	good, total := 0, 0
+	for _, r := range text {
+		total++
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || unicode.IsPunct(r) ||
+			strings.ContainsRune("$+<=>^`|~", r) {
+			good++
+		}
+	}
+	return good*10 >= total*9
+}
+
+type pdfOperator string
+
+// pdfLexer splits a content stream into operators and their operands: numbers, strings, names and arrays.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func (l *pdfLexer) next() (any, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '(':
+		return l.literal(), true
+	case c == '<' && l.peek(1) == '<', c == '>' && l.peek(1) == '>':
+		l.pos += 2
+		return pdfOperator(string(c) + string(c)), true
+	case c == '<':
+		return l.hex(), true
+	case c == '[':
+		l.pos++
+		var arr []any
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return arr, true
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return arr, true
+			}
+			tok, ok := l.next()
+			if !ok {
+				return arr, true
+			}
+			arr = append(arr, tok)
+		}
+	case c == ']' || c == '{' || c == '}' || c == ')' || c == '>':
+		l.pos++
+		return pdfOperator(string(c)), true
+	}
+
+	start := l.pos
+	if c == '/' {
+		l.pos++
+	}
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !strings.ContainsRune("()<>[]{}/%", rune(l.data[l.pos])) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if c == '/' {
+		return word, true
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, true
+	}
+	return pdfOperator(word), true
+}
+
+func (l *pdfLexer) peek(n int) byte {
+	if l.pos+n < len(l.data) {
+		return l.data[l.pos+n]
+	}
+	return 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+// literal reads a string in parentheses, which can contain balanced parentheses and escapes.
+func (l *pdfLexer) literal() []byte {
+	var s []byte
+	depth := 0
+	for l.pos++; l.pos < len(l.data); l.pos++ {
+		c := l.data[l.pos]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				l.pos++
+				return s
+			}
+			depth--
+		case '\\':
+			l.pos++
+			if l.pos >= len(l.data) {
+				return s
+			}
+			switch e := l.data[l.pos]; e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// A backslash at the end of a line continues the string on the next one.
+				if e == '\r' && l.peek(1) == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					n := 0
+					for i := 0; i < 3 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						n = n*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					l.pos--
+					c = byte(n)
+				} else {
+					c = e
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return s
+}
+
+// hex reads a string of hex digits in angle brackets.
+func (l *pdfLexer) hex() []byte {
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		end = len(l.data) - l.pos
+	}
+	var digits []byte
+	for _, c := range l.data[l.pos+1 : l.pos+end] {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	l.pos += end + 1
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	s := make([]byte, len(digits)/2)
+	for i := range s {
+		n, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		s[i] = byte(n)
+	}
+	return s
+}
+
+// skipInlineImage skips the data of an inline image, which ends with EI.
+func (l *pdfLexer) skipInlineImage() {
+	for i := l.pos; i+2 < len(l.data); i++ {
+		if isPDFSpace(l.data[i]) && l.data[i+1] == 'E' && l.data[i+2] == 'I' &&
+			(i+3 == len(l.data) || isPDFSpace(l.data[i+3])) {
+			l.pos = i + 3
+			return
+		}
+	}
+	l.pos = len(l.data)
+}
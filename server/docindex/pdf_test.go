@@ -0,0 +1,67 @@
+package docindex
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+)
+
+// testPDF returns a PDF with the given streams, each with its dictionary. It has no cross-reference table, which
+// extractPDFText does not need.
+func testPDF(streams ...[2]string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	for i, s := range streams {
+		fmt.Fprintf(&b, "%d 0 obj\n<< %s /Length %d >>\nstream\n%s\nendstream\nendobj\n", i+3, s[0], len(s[1]), s[1])
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func deflate(s string) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.String()
+}
+
+func TestExtractPDFText(t *testing.T) {
+	tests := []struct {
+		name    string
+		streams [][2]string
+		want    string
+	}{
+		{
+			"lines",
+			[][2]string{{"", "BT /F1 12 Tf 72 720 Td (Hello, world) Tj 0 -14 Td (Second line) Tj ET"}},
+			"Hello, world\nSecond line\n\n",
+		},
+		{
+			"every stream once",
+			[][2]string{{"", "BT (First) Tj ET"}, {"", "BT (Second) Tj ET"}, {"", "BT (Third) Tj ET"}},
+			"First\n\nSecond\n\nThird\n\n",
+		},
+		{
+			"compressed",
+			[][2]string{{"/Filter /FlateDecode", deflate("BT [(Sec) 10 (ond) -300 (page)] TJ ET")}},
+			"Second page\n\n",
+		},
+		{
+			"escapes and UTF-16",
+			[][2]string{{"", `BT (\(a\) \101) Tj T* <FEFF00E9> Tj ET`}},
+			"(a) A\né\n\n",
+		},
+		{
+			"images and unsupported filters",
+			[][2]string{{"/Subtype /Image", "BT (pixels) Tj ET"}, {"/Filter /DCTDecode", "BT (jpeg) Tj ET"}},
+			"",
+		},
+	}
+	for _, tt := range tests {
+		if got := extractPDFText(testPDF(tt.streams...)); got != tt.want {
+			t.Errorf("%s: extractPDFText = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package docindex
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+)
+
+const (
+	// candidates is how many passages of the keyword and of the semantic ranking SemanticSearch fuses.
+	candidates = 50
+	// rrfK damps the weight of the first ranks in reciprocal rank fusion. 60 is the usual choice.
+	rrfK = 60
+)
+
+// ErrNoEmbedder is returned by SemanticSearch if the index has no embedder.
+var ErrNoEmbedder = errors.New("docindex: no embedder is set")
+
+// vectors is what the index keeps on disk of the embeddings of its chunks. They are kept by the hash of the text of
+// the chunk, so that chunks that only moved, e.g. because a file was edited above them, are not embedded again.
+type vectors struct {
+	Model  string
+	ByHash map[string][]float32
+}
+
+func textHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:16])
+}
+
+// hash returns the hash of the chunk's text. Chunks indexed before hashes were kept have none yet.
+func (c *Chunk) hash() string {
+	if c.Hash == "" {
+		c.Hash = textHash(c.Text)
+	}
+	return c.Hash
+}
+
+// SetEmbedder makes the index embed its chunks with e, and loads the embeddings it kept of them. Embeddings of
+// another model are dropped. Chunks embedded in the background stop being embedded when ctx is done.
+func (idx *Index) SetEmbedder(ctx context.Context, e *Embedder) error {
+	idx.vecMu.Lock()
+	defer idx.vecMu.Unlock()
+
+	idx.embedder = e
+	idx.embedCtx = ctx
+	data, err := os.ReadFile(idx.vecPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(data) == 0 || gob.NewDecoder(bytes.NewReader(data)).Decode(&idx.vectors) != nil ||
+		idx.vectors.Model != e.Model {
+		idx.vectors = vectors{Model: e.Model, ByHash: map[string][]float32{}}
+	}
+	return nil
+}
+
+// Embed embeds the chunks that have no embedding yet, and forgets the embeddings of the chunks that are gone. The
+// embeddings it got before an error are kept.
+func (idx *Index) Embed(ctx context.Context) error {
+	if idx.embedder == nil {
+		return ErrNoEmbedder
+	}
+	idx.embedMu.Lock()
+	defer idx.embedMu.Unlock()
+	return idx.embed(ctx)
+}
+
+// embedInBackground embeds the chunks that have no embedding yet, unless they are being embedded already.
+func (idx *Index) embedInBackground() {
+	if !idx.embedMu.TryLock() {
+		return
+	}
+	go func() {
+		defer idx.embedMu.Unlock()
+		idx.embed(idx.embedCtx)
+	}()
+}
+
+// embed does the work of Embed, with embedMu held. Its error is kept for SemanticSearch to report.
+func (idx *Index) embed(ctx context.Context) error {
+	idx.mu.Lock()
+	texts := map[string]string{}
+	for _, c := range idx.state.Chunks {
+		texts[c.hash()] = c.Text
+	}
+	idx.mu.Unlock()
+
+	idx.vecMu.Lock()
+	changed := false
+	for h := range idx.vectors.ByHash {
+		if _, ok := texts[h]; !ok {
+			delete(idx.vectors.ByHash, h)
+			changed = true
+		}
+	}
+	var missing []string
+	for h := range texts {
+		if _, ok := idx.vectors.ByHash[h]; !ok {
+			missing = append(missing, h)
+		}
+	}
+	idx.vecMu.Unlock()
+	slices.Sort(missing)
+
+	var err error
+	for start := 0; start < len(missing); start += embedBatchSize {
+		batch := missing[start:min(start+embedBatchSize, len(missing))]
+		input := make([]string, len(batch))
+		for i, h := range batch {
+			input[i] = texts[h]
+		}
+		var vecs [][]float32
+		if vecs, err = idx.embedder.Embed(ctx, input); err != nil {
+			break
+		}
+		idx.vecMu.Lock()
+		for i, h := range batch {
+			idx.vectors.ByHash[h] = vecs[i]
+		}
+		idx.vecMu.Unlock()
+		changed = true
+	}
+
+	if changed {
+		if saveErr := idx.saveVectors(); err == nil {
+			err = saveErr
+		}
+	}
+	idx.vecMu.Lock()
+	idx.embedErr = err
+	idx.vecMu.Unlock()
+	return err
+}
+
+func (idx *Index) saveVectors() error {
+	idx.vecMu.Lock()
+	defer idx.vecMu.Unlock()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&idx.vectors); err != nil {
+		return err
+	}
+	tmp := idx.vecPath + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.vecPath)
+}
+
+// SemanticResults are the passages SemanticSearch found. Warnings tell why they may miss some, e.g. because
+// passages were not embedded yet.
+type SemanticResults struct {
+	Passages []Passage `json:"passages"`
+	Warnings []string  `json:"warnings,omitempty"`
+}
+
+// SemanticSearch returns the passages that match query best, best first, at most limit of them. It ranks the
+// passages both by BM25 and by the similarity of their embeddings to the one of query, and fuses the rankings, so
+// that passages that say the same in other words are found as well as the ones that contain the exact terms.
+//
+// Passages that were not embedded yet are only ranked by BM25, and are embedded in the background. If the query
+// cannot be embedded, all passages are. Both are reported as warnings rather than errors.
+func (idx *Index) SemanticSearch(ctx context.Context, query string, limit int) (SemanticResults, error) {
+	if idx.embedder == nil {
+		return SemanticResults{}, ErrNoEmbedder
+	}
+	var res SemanticResults
+	var q []float32
+	if vecs, err := idx.embedder.Embed(ctx, []string{query}); err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("The query could not be embedded, so passages are only "+
+			"ranked by keyword: %v", err))
+	} else {
+		q = vecs[0]
+	}
+
+	idx.vecMu.Lock()
+	defer idx.vecMu.Unlock()
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	keyword := idx.scores(query)
+	similarity := map[int]float64{}
+	missing := 0
+	for id, c := range idx.state.Chunks {
+		v := idx.vectors.ByHash[c.hash()]
+		switch {
+		case v == nil:
+			missing++
+		case q != nil:
+			similarity[id] = dot(v, q)
+		}
+	}
+	if missing > 0 {
+		warning := fmt.Sprintf("%d of %d passages are not embedded yet, so they are only ranked by keyword.", missing,
+			len(idx.state.Chunks))
+		if idx.embedErr != nil {
+			warning += fmt.Sprintf(" Embedding them failed: %v", idx.embedErr)
+		}
+		res.Warnings = append(res.Warnings, warning)
+		idx.embedInBackground()
+	}
+
+	// Reciprocal rank fusion adds up 1/(rrfK+rank) over the rankings, which needs no calibration of BM25 scores
+	// against similarities.
+	fused := map[int]float64{}
+	for _, scores := range []map[int]float64{keyword, similarity} {
+		ids := ranked(scores)
+		for rank, id := range ids[:min(candidates, len(ids))] {
+			fused[id] += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	ids := ranked(fused)
+	res.Passages = []Passage{}
+	for _, id := range ids[:min(limit, len(ids))] {
+		// The fused score is scaled so that a passage ranked first both ways scores 1.
+		p := idx.passage(id, fused[id]*(rrfK+1)/2)
+		p.Keyword = round(keyword[id])
+		p.Similarity = round(similarity[id])
+		res.Passages = append(res.Passages, p)
+	}
+	return res, nil
+}
@@ -0,0 +1,117 @@
+package docindex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubEmbeddings serves embeddings with one dimension per topic, counting the words of the topic in the text. It
+// fails for texts that contain "fail".
+func stubEmbeddings(t *testing.T) *httptest.Server {
+	topics := [][]string{{"cat", "cats", "kitten", "purr"}, {"dog", "dogs", "puppy", "bark"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		data := []embedding{}
+		for i, text := range req.Input {
+			if strings.Contains(text, "fail") {
+				http.Error(w, "model is overloaded", http.StatusServiceUnavailable)
+				return
+			}
+			v := make([]float32, len(topics)+1)
+			v[len(topics)] = 0.1
+			for _, word := range strings.Fields(strings.ToLower(text)) {
+				for d, topic := range topics {
+					for _, w := range topic {
+						if word == w {
+							v[d]++
+						}
+					}
+				}
+			}
+			data = append(data, embedding{Index: i, Embedding: v})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSemanticSearch(t *testing.T) {
+	docs := t.TempDir()
+	files := map[string]string{"cats.md": "Cats purr when they are content.", "dogs.md": "Dogs bark at the mail."}
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(docs, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	idx, err := Open(t.TempDir(), []string{docs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.SetEmbedder(ctx, NewEmbedder(stubEmbeddings(t).URL, "stub", "")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	first := func(res SemanticResults) string {
+		if len(res.Passages) == 0 {
+			return ""
+		}
+		return filepath.Base(res.Passages[0].File)
+	}
+
+	// Passages that are not embedded yet are ranked by keyword, and embedded in the background.
+	res, err := idx.SemanticSearch(ctx, "dogs", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "2 of 2 passages are not embedded yet") {
+		t.Errorf("warnings = %q, want one about the passages that are not embedded", res.Warnings)
+	}
+	if first(res) != "dogs.md" || res.Passages[0].Similarity != 0 {
+		t.Errorf("passages = %+v, want dogs.md first, ranked by keyword", res.Passages)
+	}
+	// Embed waits for the embedding in the background to finish.
+	if err := idx.Embed(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = idx.SemanticSearch(ctx, "kitten", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 0 {
+		t.Errorf("warnings = %q, want none once the passages are embedded", res.Warnings)
+	}
+	if first(res) != "cats.md" || res.Passages[0].Keyword != 0 || res.Passages[0].Similarity <= 0 {
+		t.Errorf("passages = %+v, want cats.md first, ranked by similarity", res.Passages)
+	}
+
+	// A query that cannot be embedded is ranked by keyword.
+	res, err = idx.SemanticSearch(ctx, "fail bark", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "The query could not be embedded") ||
+		!strings.Contains(res.Warnings[0], "model is overloaded") {
+		t.Errorf("warnings = %q, want one about the query", res.Warnings)
+	}
+	if len(res.Passages) != 1 || first(res) != "dogs.md" {
+		t.Errorf("passages = %+v, want only dogs.md, ranked by keyword", res.Passages)
+	}
+}
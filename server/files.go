@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zakkor/server/toolfns"
+)
+
+type workspaceFile struct {
+	Name string `json:"name"`
+	// Path is relative to the chat's workspace, which tools run in.
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	IsDir bool   `json:"is_dir,omitempty"`
+}
+
+// UploadFiles stores the files of a multipart form in the uploads directory of the form's chat_id workspace. Files
+// never replace earlier uploads; the response has the paths they were stored at.
+func (tr *ToolHandler) UploadFiles(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, *uploadLimit)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(w, toolfns.Errorf(toolfns.CodeDenied, "upload exceeds the limit of %d bytes", maxErr.Limit))
+			return
+		}
+		writeError(w, toolfns.Errorf(toolfns.CodeInvalidArguments, "invalid multipart form: %v", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	chatID := r.FormValue("chat_id")
+	if chatID == "" {
+		chatID = defaultChatID
+	}
+	root, terr := tr.workspace(chatID)
+	if terr != nil {
+		writeError(w, terr)
+		return
+	}
+	if err := tr.Workspaces.CheckQuota(chatID); err != nil {
+		writeError(w, toolfns.Errorf(toolfns.CodeDenied, "%v", err))
+		return
+	}
+
+	dir := filepath.Join(root, "uploads")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		writeError(w, toolfns.Errorf(toolfns.CodeInternal, "create upload directory: %v", err))
+		return
+	}
+
+	uploaded := []workspaceFile{}
+	for _, header := range r.MultipartForm.File["file"] {
+		name := filepath.Base(header.Filename)
+		if name == "." || name == ".." || name == string(filepath.Separator) {
+			writeError(w, toolfns.Errorf(toolfns.CodeInvalidArguments, "invalid file name: %q", header.Filename))
+			return
+		}
+
+		path, err := saveUpload(header, dir, name)
+		if err != nil {
+			writeError(w, toolfns.Errorf(toolfns.CodeInternal, "save %s: %v", name, err))
+			return
+		}
+		uploaded = append(uploaded, newWorkspaceFile(root, path, header.Size, false))
+	}
+	writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: uploaded})
+}
+
+// saveUpload stores the uploaded file in dir under name, or, if a file of that name exists, under name with the first
+// free number appended, like report-2.pdf. It returns the path it was stored at.
+func saveUpload(header *multipart.FileHeader, dir, name string) (string, error) {
+	src, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 1; ; n++ {
+		path := filepath.Join(dir, name)
+		if n > 1 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", base, n, ext))
+		}
+		dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, fs.ErrExist) && n < 1000 {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			dst.Close()
+			os.Remove(path)
+			return "", err
+		}
+		return path, dst.Close()
+	}
+}
+
+// ListFiles lists the directory at the path query parameter within the chat's workspace, or downloads it if it is a
+// file. Workspaces that do not exist yet are not created.
+func (tr *ToolHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	chatID := r.URL.Query().Get("chat_id")
+	if chatID == "" {
+		chatID = defaultChatID
+	}
+	root, terr := tr.existingWorkspace(chatID)
+	if terr != nil {
+		writeError(w, terr)
+		return
+	}
+
+	// Cleaning the path as if it were absolute keeps it inside root.
+	rel := filepath.Clean("/" + r.URL.Query().Get("path"))
+	path := filepath.Join(root, rel)
+
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(w, toolfns.Errorf(toolfns.CodeNotFound, "file not found: %s", strings.TrimPrefix(rel, "/")))
+		return
+	}
+	if err != nil {
+		writeError(w, toolfns.Errorf(toolfns.CodeInternal, "%v", err))
+		return
+	}
+
+	if !info.IsDir() {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		http.ServeFile(w, r, path)
+		return
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		writeError(w, toolfns.Errorf(toolfns.CodeInternal, "%v", err))
+		return
+	}
+	files := []workspaceFile{}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		var size int64
+		if !e.IsDir() {
+			size = info.Size()
+		}
+		files = append(files, newWorkspaceFile(root, filepath.Join(path, e.Name()), size, e.IsDir()))
+	}
+	writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: files})
+}
+
+func newWorkspaceFile(root, path string, size int64, isDir bool) workspaceFile {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+	return workspaceFile{
+		Name:  filepath.Base(path),
+		Path:  filepath.ToSlash(rel),
+		Size:  size,
+		IsDir: isDir,
+	}
+}
@@ -7,8 +7,11 @@ toolchain go1.22.4
 require (
 	github.com/PuerkitoBio/goquery v1.9.2
 	github.com/byte-sat/llum-tools v0.0.0-20240622105019-b64412474dd9
+	github.com/creack/pty v1.1.24
 	github.com/go-chi/chi/v5 v5.0.14
 	github.com/go-chi/cors v1.2.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/hinshun/vt10x v0.0.0-20220119200601-820417d04eec
 	github.com/noonien/codoc v0.0.0-20240519154704-25b5fe95209b
 	github.com/playwright-community/playwright-go v0.4501.0
 	github.com/smacker/go-tree-sitter v0.0.0-20240827094217-dd81d9e9be82
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zakkor/server/ringbuf"
+	"github.com/zakkor/server/toolfns"
+)
+
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// maxJobOutput is how many bytes of output a job view returns at most. Clients read the rest from NextOffset.
+const maxJobOutput = 64 << 10
+
+// Job is a tool call running in the background, independently of the request that started it.
+type Job struct {
+	ID     string
+	Call   toolCall
+	cancel context.CancelFunc
+	// dryRun is set when the result is a preview of the changes the call would make.
+	dryRun bool
+	// output keeps the last of the partial output, so that chatty tools do not grow the job without bound.
+	output *ringbuf.Buffer
+
+	mu         sync.Mutex
+	status     JobStatus
+	createdAt  time.Time
+	finishedAt time.Time
+	result     any
+	warnings   []string
+	err        *toolfns.Error
+}
+
+type JobView struct {
+	ID         string     `json:"id"`
+	Tool       string     `json:"tool"`
+	ChatID     string     `json:"chat_id,omitempty"`
+	Status     JobStatus  `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Output     string     `json:"output,omitempty"`
+	// NextOffset is the offset to read the output from next. Truncated is set when the output at the requested
+	// offset had already been dropped.
+	NextOffset int64 `json:"next_offset"`
+	Truncated  bool  `json:"truncated,omitempty"`
+}
+
+// View returns a snapshot of the job's status and the output it has produced from offset on.
+func (j *Job) View(offset int64) JobView {
+	output, next, truncated := j.output.ReadFrom(offset, maxJobOutput)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	v := JobView{
+		ID:         j.ID,
+		Tool:       j.Call.Name,
+		ChatID:     j.Call.ChatID,
+		Status:     j.status,
+		CreatedAt:  j.createdAt,
+		Output:     string(output),
+		NextOffset: next,
+		Truncated:  truncated,
+	}
+	if !j.finishedAt.IsZero() {
+		finishedAt := j.finishedAt
+		v.FinishedAt = &finishedAt
+	}
+	return v
+}
+
+// Write appends partial output to the job.
+func (j *Job) Write(p []byte) (int, error) {
+	return j.output.Write(p)
+}
+
+// Cancel stops the job. The tool may keep running, but its result is discarded.
+func (j *Job) Cancel() {
+	j.cancel()
+	j.finish(nil, nil, toolfns.Errorf(toolfns.CodeCanceled, "the tool call was canceled"))
+}
+
+func (j *Job) finish(result any, warnings []string, err *toolfns.Error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.status != JobRunning {
+		return
+	}
+
+	j.result, j.warnings, j.err = result, warnings, err
+	j.finishedAt = time.Now()
+	switch {
+	case err == nil:
+		j.status = JobSucceeded
+	case err.Code == toolfns.CodeCanceled:
+		j.status = JobCanceled
+	default:
+		j.status = JobFailed
+	}
+}
+
+func (j *Job) response() (int, toolResponse) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch {
+	case j.status == JobRunning:
+		err := toolfns.Errorf(toolfns.CodePending, "job %s is still running", j.ID)
+		return err.Code.Status(), toolResponse{Error: err}
+	case j.err != nil:
+		return j.err.Code.Status(), toolResponse{Error: j.err, Warnings: j.warnings}
+	default:
+		return http.StatusOK, toolResponse{OK: true, Result: j.result, DryRun: j.dryRun, Warnings: j.warnings}
+	}
+}
+
+// JobStore keeps track of async jobs. Finished jobs are forgotten once they are older than the TTL. Every job keeps
+// the last outputSize bytes of its output, and is canceled when ctx is.
+type JobStore struct {
+	ctx        context.Context
+	ttl        time.Duration
+	outputSize int
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func NewJobStore(ctx context.Context, ttl time.Duration, outputSize int) *JobStore {
+	return &JobStore{
+		ctx:        ctx,
+		ttl:        ttl,
+		outputSize: outputSize,
+		jobs:       make(map[string]*Job),
+	}
+}
+
+// Start runs call with fn in the background and returns its job. The job collects the partial output fn reports.
+// dryRun records whether the result will only be a preview.
+func (s *JobStore) Start(call toolCall, dryRun bool, fn func(context.Context, toolCall, io.Writer) (any, []string, *toolfns.Error)) *Job {
+	ctx, cancel := context.WithCancel(s.ctx)
+	job := &Job{
+		ID:        newJobID(),
+		Call:      call,
+		cancel:    cancel,
+		dryRun:    dryRun,
+		output:    ringbuf.New(s.outputSize),
+		status:    JobRunning,
+		createdAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	s.prune()
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		job.finish(fn(ctx, call, job))
+	}()
+	return job
+}
+
+func (s *JobStore) Get(id string) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	return s.jobs[id]
+}
+
+// prune removes expired jobs. s.mu must be held.
+func (s *JobStore) prune() {
+	for id, job := range s.jobs {
+		job.mu.Lock()
+		expired := !job.finishedAt.IsZero() && time.Since(job.finishedAt) > s.ttl
+		job.mu.Unlock()
+		if expired {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (tr *ToolHandler) job(w http.ResponseWriter, r *http.Request) *Job {
+	id := chi.URLParam(r, "id")
+	job := tr.Jobs.Get(id)
+	if job == nil {
+		writeError(w, toolfns.Errorf(toolfns.CodeNotFound, "job not found: %s", id))
+	}
+	return job
+}
+
+// GetJob responds with the job's status and its output from the offset query parameter on, 0 if it is missing.
+func (tr *ToolHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	offset, err := jobOffset(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if job := tr.job(w, r); job != nil {
+		writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: job.View(offset)})
+	}
+}
+
+func jobOffset(r *http.Request) (int64, *toolfns.Error) {
+	q := r.URL.Query().Get("offset")
+	if q == "" {
+		return 0, nil
+	}
+	offset, err := strconv.ParseInt(q, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, toolfns.Errorf(toolfns.CodeInvalidArguments, "invalid offset: %s", q)
+	}
+	return offset, nil
+}
+
+// GetJobResult responds with the result of a finished job, in the same form as a synchronous tool call.
+func (tr *ToolHandler) GetJobResult(w http.ResponseWriter, r *http.Request) {
+	if job := tr.job(w, r); job != nil {
+		status, resp := job.response()
+		writeJSON(w, status, resp)
+	}
+}
+
+func (tr *ToolHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	if job := tr.job(w, r); job != nil {
+		job.Cancel()
+		writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: job.View(0)})
+	}
+}
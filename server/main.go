@@ -2,46 +2,211 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
-	"github.com/byte-sat/llum-tools/schema"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/zakkor/server/artifacts"
+	"github.com/zakkor/server/docindex"
+	"github.com/zakkor/server/previews"
+	"github.com/zakkor/server/processes"
+	"github.com/zakkor/server/terminals"
 	"github.com/zakkor/server/toolfns"
+	"github.com/zakkor/server/workspaces"
 )
 
 var (
-	password = flag.String("password", "", "Password for basic auth.")
+	password          = flag.String("password", "", "Password for basic auth.")
+	dataDir           = flag.String("data-dir", ".llum", "Directory the tool server keeps its data in.")
+	artifactRetention = flag.Duration("artifact-retention", 7*24*time.Hour, "How long artifacts produced by tools are kept.")
+	artifactQuota     = flag.Int64("artifact-quota", 100<<20, "How many bytes of artifacts a chat can store.")
+	workspaceTemplate = flag.String("workspace-template", "", "Directory copied into every new chat workspace.")
+	workspaceRepo     = flag.String("workspace-repo", "", "Git repository new chat workspaces are created as worktrees of.")
+	workspaceQuota    = flag.Int64("workspace-quota", 1<<30, "How many bytes a chat workspace can use before tool calls in it are refused.")
+	workspaceIdle     = flag.Duration("workspace-idle", 7*24*time.Hour, "How long a chat workspace can go unused before it is deleted.")
+	checkpoints       = flag.Bool("checkpoints", true, "Checkpoint the chat workspace before every tool call that is not read-only.")
+	checkpointLimit   = flag.Int("checkpoint-limit", 200, "How many checkpoints of a chat workspace are kept. Older ones are deleted; 0 keeps all.")
+	snapshotLimit     = flag.Int("snapshot-limit", 20, "How many snapshots of a chat workspace are kept. Older ones are deleted; 0 keeps all.")
+	gitRewrites       = flag.Bool("git-rewrites", false, "Let tools force-push and rewrite git history, e.g. by amending, rebasing or resetting commits. Without it, only git commands written out in a tool call are checked, so a command that runs git through a script, an alias, bash -c or eval is not refused; protect branches on the remote to be sure.")
+	batchConcurrency  = flag.Int("batch-concurrency", 4, "How many calls of a batch run at the same time, unless the request asks otherwise.")
+	jobTTL            = flag.Duration("job-ttl", time.Hour, "How long the results of finished async tool jobs are kept.")
+	jobOutputSize     = flag.Int("job-output-size", 1<<20, "How many bytes of partial output are kept for every async tool job.")
+	previewPorts      = flag.String("preview-ports", "8082-8101", "Range of ports previews of the web apps tools run are served on. Each serves one preview, so that previews run on other origins than the tool server and each other; when all are taken, the least recently used preview gives up its port.")
+	previewURL        = flag.String("preview-url", "", "URL previews are opened at, with the port of the preview, if not the host of the tool server, e.g. behind a reverse proxy.")
+	processLogSize    = flag.Int("process-log-size", 1<<20, "How many bytes of output are kept for every background process.")
+	uploadLimit       = flag.Int64("upload-limit", 50<<20, "Maximum size in bytes of a file upload request.")
+	coerceArgs        = flag.Bool("coerce-args", false, "Convert string tool arguments to the number or boolean the tool expects.")
+	lintersFile       = flag.String("linters", "", "JSON file listing the external linters the Lint tool runs, besides gofmt and go vet.")
+	docDirs           = flag.String("docs", "", "Comma-separated directories of documents SearchDocs indexes, e.g. design docs and runbooks.")
+	docsRefresh       = flag.Duration("docs-refresh", time.Minute, "How often the documents are indexed again, to find the ones that changed.")
+	embeddingsURL     = flag.String("embeddings-url", "", "OpenAI-compatible embeddings API SemanticSearch embeds the documents with, e.g. http://localhost:11434 for Ollama. Its API key is read from LLUM_SECRET_EMBEDDINGS_API_KEY.")
+	embeddingsModel   = flag.String("embeddings-model", "nomic-embed-text", "Model the embeddings API embeds the documents with.")
+	origins           = flag.String("origins", "https://llum.chat,http://localhost:5173", "Comma-separated origins of the web UIs that may attach to terminals, besides the tool server's own. * allows any.")
 )
 
 func main() {
 	flag.Parse()
 
+	// ctx is canceled on shutdown, stopping the work that outlives requests.
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
 	r := chi.NewRouter()
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{"ETag", "X-Tool-Schema-Version"},
 	}))
-	r.Use(authMiddleware)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	th := &ToolHandler{Groups: toolfns.ToolGroups}
-	r.Get("/tool_schema", th.ToolSchema)
-	r.Post("/tool", th.InvokeTool)
+	dir, err := filepath.Abs(*dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := artifacts.Open(filepath.Join(dir, "artifacts"), []byte(*password), *artifactRetention, *artifactQuota)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	wm, err := workspaces.New(dir, workspaces.Options{
+		Template:       *workspaceTemplate,
+		Repo:           *workspaceRepo,
+		Quota:          *workspaceQuota,
+		IdleTimeout:    *workspaceIdle,
+		MaxCheckpoints: *checkpointLimit,
+		MaxSnapshots:   *snapshotLimit,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var linters []toolfns.Linter
+	if *lintersFile != "" {
+		if linters, err = toolfns.LoadLinters(*lintersFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var docs *docindex.Index
+	if *docDirs != "" {
+		var roots []string
+		for _, d := range strings.Split(*docDirs, ",") {
+			// An empty entry, e.g. after a trailing comma, would be the working directory.
+			if d = strings.TrimSpace(d); d != "" {
+				roots = append(roots, d)
+			}
+		}
+		docs, err = docindex.Open(filepath.Join(dir, "docindex"), roots)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *embeddingsURL != "" {
+			// The API key is optional, since local servers like Ollama need none.
+			key, _ := toolfns.EnvSecrets{}.Secret("embeddings_api_key")
+			e := docindex.NewEmbedder(*embeddingsURL, *embeddingsModel, key)
+			if err := docs.SetEmbedder(ctx, e); err != nil {
+				log.Fatal(err)
+			}
+		}
+		// Searches use what is indexed already rather than wait for the documents to be indexed again.
+		go func() {
+			for first := true; ; first = false {
+				changed, err := docs.Refresh()
+				if err != nil {
+					log.Println("index documents:", err)
+				}
+				if *embeddingsURL != "" && (changed || first) {
+					if err := docs.Embed(ctx); err != nil {
+						log.Println("embed documents:", err)
+					}
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(*docsRefresh):
+				}
+			}
+		}()
+	}
+
+	th := &ToolHandler{
+		Groups:     toolfns.ToolGroups,
+		Jobs:       NewJobStore(ctx, *jobTTL, *jobOutputSize),
+		Artifacts:  store,
+		Workspaces: wm,
+		Terminals:  terminals.New(),
+		Processes:  processes.New(*processLogSize),
+		Linters:    linters,
+		Docs:       docs,
+	}
+	ports, err := parsePortRange(*previewPorts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	th.Previews = previews.New(ports, th.Processes.ListensOn)
+	go func() {
+		for range time.Tick(10 * time.Minute) {
+			// Deleted workspaces are left like DeleteWorkspace leaves them, with nothing running in them.
+			err := wm.Cleanup(func(chatID string) {
+				th.Terminals.Close(chatID)
+				th.Processes.StopChat(chatID)
+			})
+			if err != nil {
+				log.Println("clean up workspaces:", err)
+			}
+		}
+	}()
+	// Artifacts are opened by the browser directly, so they authorize with a signed URL instead.
+	r.Get("/artifacts/{id}", th.GetArtifact)
+	// WebSockets opened by browsers cannot carry the Authorization header, so they authorize with their first message.
+	r.Get("/terminals/{chat_id}", th.AttachTerminal)
+	// Previews are served on ports of their own, so they run on other origins than the tool server.
+	r.Get("/preview/{chat_id}/{port}", th.RedirectPreview)
+	r.Get("/preview/{chat_id}/{port}/*", th.RedirectPreview)
+
+	r.Group(func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Get("/tool_schema", th.ToolSchema)
+		r.Post("/tool", th.InvokeTool)
+		r.Post("/tools/batch", th.InvokeBatch)
+		r.Get("/jobs/{id}", th.GetJob)
+		r.Get("/jobs/{id}/result", th.GetJobResult)
+		r.Delete("/jobs/{id}", th.CancelJob)
+		r.Get("/artifacts", th.ListArtifacts)
+		r.Post("/files", th.UploadFiles)
+		r.Get("/files", th.ListFiles)
+		r.Get("/workspaces", th.ListWorkspaces)
+		r.Delete("/workspaces/{chat_id}", th.DeleteWorkspace)
+		r.Get("/workspaces/{chat_id}/export", th.ExportWorkspace)
+		r.Get("/workspaces/{chat_id}/snapshots", th.ListSnapshots)
+		r.Post("/workspaces/{chat_id}/snapshots", th.CreateSnapshot)
+		r.Get("/workspaces/{chat_id}/checkpoints", th.ListCheckpoints)
+		r.Get("/workspaces/{chat_id}/checkpoints/diff", th.DiffCheckpoints)
+		r.Post("/workspaces/{chat_id}/checkpoints/{call_id}/restore", th.RestoreCheckpoint)
+		r.Get("/terminals/{chat_id}/screen", th.GetTerminalScreen)
+		r.Delete("/terminals/{chat_id}", th.CloseTerminal)
+	})
 
 	fmt.Println("Tool server running at http://localhost:8081")
 	httpServer := &http.Server{Addr: ":8081", Handler: r}
@@ -51,6 +216,23 @@ func main() {
 		}
 	}()
 
+	// Previews are opened in iframes, so they authorize with a signed URL, and then a cookie, instead.
+	pr := chi.NewRouter()
+	pr.Use(middleware.RealIP)
+	pr.Use(middleware.Recoverer)
+	pr.HandleFunc("/preview/{chat_id}/{port}", th.ServePreview)
+	pr.HandleFunc("/preview/{chat_id}/{port}/*", th.ServePreview)
+	var previewServers []*http.Server
+	for _, port := range ports {
+		server := &http.Server{Addr: ":" + strconv.Itoa(port), Handler: pr}
+		previewServers = append(previewServers, server)
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
 	// Signal handling
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -58,14 +240,22 @@ func main() {
 	<-c // Block until a signal is received.
 
 	// Graceful shutdown
+	stop()
+	th.Terminals.CloseAll()
+	th.Processes.StopAll()
 	if err := httpServer.Shutdown(context.Background()); err != nil {
 		log.Fatal(err)
 	}
+	for _, server := range previewServers {
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
 
 func authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if *password != "" && r.Header.Get("Authorization") != ("Basic "+*password) {
+		if !authorized(r) {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
@@ -73,62 +263,219 @@ func authMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+func authorized(r *http.Request) bool {
+	if *password == "" {
+		return true
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Basic ")
+	return ok && passwordMatches(given)
+}
+
+// passwordMatches compares in constant time, so that the time a check takes does not reveal the password.
+func passwordMatches(given string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(*password)) == 1
+}
+
 type ToolHandler struct {
-	Groups []*toolfns.Group
+	Groups     []*toolfns.Group
+	Jobs       *JobStore
+	Artifacts  *artifacts.Store
+	Workspaces *workspaces.Manager
+	Terminals  *terminals.Manager
+	Processes  *processes.Manager
+	Previews   *previews.Proxy
+	Linters    []toolfns.Linter
+	Docs       *docindex.Index
 }
 
-func (tr *ToolHandler) ToolSchema(w http.ResponseWriter, r *http.Request) {
-	enc := json.NewEncoder(w)
-	enc.SetIndent("", "  ")
+type toolCall struct {
+	ID     string         `json:"id"`
+	ChatID string         `json:"chat_id"`
+	Name   string         `json:"name"`
+	Args   map[string]any `json:"arguments"`
+	// Lock is set on calls that conflict with each other, e.g. writes to the same file. Calls in a batch that share a
+	// lock run one after the other, in order.
+	Lock string `json:"lock,omitempty"`
+	// DryRun asks the tool to preview its changes instead of making them.
+	DryRun bool `json:"dry_run,omitempty"`
+}
 
-	type encodedGroup struct {
-		Name   string            `json:"name"`
-		Schema []schema.Function `json:"schema"`
+func (tr *ToolHandler) InvokeTool(w http.ResponseWriter, r *http.Request) {
+	var call toolCall
+	if err := json.NewDecoder(io.TeeReader(r.Body, os.Stdout)).Decode(&call); err != nil {
+		writeError(w, toolfns.Errorf(toolfns.CodeInvalidArguments, "invalid request body: %v", err))
+		return
 	}
 
-	var encodedGroups []encodedGroup
-	for _, group := range tr.Groups {
-		encodedGroups = append(encodedGroups, encodedGroup{
-			Name:   group.Name,
-			Schema: group.Repo.Schema(),
-		})
+	if r.URL.Query().Get("async") == "1" {
+		if _, fn := tr.findTool(call.Name); fn == nil {
+			writeError(w, toolfns.Errorf(toolfns.CodeNotFound, "tool not found: %s", call.Name))
+			return
+		}
+		job := tr.Jobs.Start(call, tr.isDryRun(call), tr.call)
+		writeJSON(w, http.StatusAccepted, toolResponse{OK: true, Result: job.View(0)})
+		return
 	}
-	err := enc.Encode(encodedGroups)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+	out, warnings, terr := tr.call(r.Context(), call, io.Discard)
+	if terr != nil {
+		writeJSON(w, terr.Code.Status(), toolResponse{Error: terr, Warnings: warnings})
 		return
 	}
+	writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: out, DryRun: tr.isDryRun(call), Warnings: warnings})
 }
 
-func (tr *ToolHandler) InvokeTool(w http.ResponseWriter, r *http.Request) {
-	var call struct {
-		ChatID string         `json:"chat_id"`
-		Name   string         `json:"name"`
-		Args   map[string]any `json:"arguments"`
+// isDryRun reports whether call only previewed its changes.
+func (tr *ToolHandler) isDryRun(call toolCall) bool {
+	_, fn := tr.findTool(call.Name)
+	return call.DryRun && fn != nil && !fn.Annotations.ReadOnly
+}
+
+// call validates and invokes a tool call, sending any partial output to progress. If ctx is done by the time the
+// tool returns, its result is discarded. Warnings report what went wrong around the call without failing it.
+func (tr *ToolHandler) call(ctx context.Context, call toolCall, progress io.Writer) (any, []string, *toolfns.Error) {
+	if call.ChatID == "" {
+		call.ChatID = defaultChatID
 	}
-	if err := json.NewDecoder(io.TeeReader(r.Body, os.Stdout)).Decode(&call); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+
+	group, fn := tr.findTool(call.Name)
+	if fn == nil {
+		return nil, nil, toolfns.Errorf(toolfns.CodeNotFound, "tool not found: %s", call.Name)
 	}
 
-	var err error
-	for _, group := range tr.Groups {
-		var out any
-		out, err = group.Repo.Invoke(nil, call.Name, call.Args)
-		if err != nil {
-			if strings.HasPrefix(err.Error(), "tool not found") {
-				continue
+	args, err := fn.Validate(call.Args, *coerceArgs)
+	if err != nil {
+		return nil, nil, toToolError(err)
+	}
+	// Read-only tools have nothing to preview, so they run as usual.
+	dryRun := call.DryRun && !fn.Annotations.ReadOnly
+	if dryRun && !fn.Annotations.DryRun {
+		return nil, nil, toolfns.Errorf(toolfns.CodeDenied, "%s does not support dry runs", call.Name)
+	}
+
+	workspace, terr := tr.workspace(call.ChatID)
+	if terr != nil {
+		return nil, nil, terr
+	}
+	var warnings []string
+	// Read-only tools and dry runs cannot change the workspace, so they run regardless of the quota, and do not
+	// need a checkpoint.
+	if !fn.Annotations.ReadOnly && !dryRun {
+		if err := tr.Workspaces.CheckQuota(call.ChatID); err != nil {
+			return nil, nil, toolfns.Errorf(toolfns.CodeDenied, "%v", err)
+		}
+		defer tr.Workspaces.Begin(call.ChatID)()
+		if *checkpoints {
+			if err := tr.checkpoint(call); err != nil {
+				warnings = append(warnings, fmt.Sprintf(
+					"The workspace could not be checkpointed, so this call cannot be reverted: %v", err))
 			}
-			json.NewEncoder(w).Encode(map[string]any{
-				"error": err.Error(),
-			})
-			return
 		}
-		json.NewEncoder(w).Encode(out)
-		return
 	}
 
+	inv := toolfns.NewInvocation(ctx)
+	inv.ChatID = call.ChatID
+	inv.CallID = call.ID
+	inv.Workspace = workspace
+	inv.Logger = slog.Default().With("tool", call.Name, "chat_id", call.ChatID, "call_id", call.ID)
+	inv.Progress = progress
+	inv.Artifacts = tr.Artifacts
+	inv.Terminals = tr.Terminals
+	inv.Processes = tr.Processes
+	inv.Previews = tr.Previews
+	inv.AllowGitRewrites = *gitRewrites
+	inv.Linters = tr.Linters
+	inv.Docs = tr.Docs
+	inv.DryRun = dryRun
+
+	out, err := invoke(group, inv, call.Name, args)
+	if ctx.Err() != nil {
+		return nil, warnings, toToolError(ctx.Err())
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, warnings, toToolError(err)
+	}
+	return out, warnings, nil
+}
+
+func (tr *ToolHandler) findTool(name string) (*toolfns.Group, *toolfns.Function) {
+	for _, group := range tr.Groups {
+		if fn := group.Function(name); fn != nil {
+			return group, fn
+		}
+	}
+	return nil, nil
+}
+
+// invoke calls the named tool, turning a panic inside the tool into an internal error.
+func invoke(group *toolfns.Group, inv *toolfns.Invocation, name string, args map[string]any) (out any, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = toolfns.Errorf(toolfns.CodeInternal, "tool panicked: %v", rec)
+		}
+	}()
+	return group.Invoke(inv, name, args)
+}
+
+type toolResponse struct {
+	OK     bool           `json:"ok"`
+	Result any            `json:"result,omitempty"`
+	Error  *toolfns.Error `json:"error,omitempty"`
+	// DryRun is set when Result is a preview of the changes the call would make.
+	DryRun bool `json:"dry_run,omitempty"`
+	// Warnings report what went wrong around the call without failing it, e.g. a checkpoint that could not be made.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// argumentErrors are the prefixes of the errors llum-tools returns when it cannot convert the arguments of a call.
+var argumentErrors = []string{
+	"missing argument:",
+	"unexpected argument:",
+	"unexpected field:",
+	"cannot convert",
+	"array length mismatch",
+}
+
+// toToolError classifies err, which was returned while invoking a tool.
+func toToolError(err error) *toolfns.Error {
+	var terr *toolfns.Error
+	if errors.As(err, &terr) {
+		return terr
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return toolfns.Errorf(toolfns.CodeCanceled, "the tool call was canceled")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return toolfns.Errorf(toolfns.CodeTimeout, "the tool call timed out")
+	}
+
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		return toolfns.Errorf(toolfns.CodeInvalidArguments, "%v", err)
+	}
+	for _, prefix := range argumentErrors {
+		if strings.Contains(err.Error(), prefix) {
+			return toolfns.Errorf(toolfns.CodeInvalidArguments, "%v", err)
+		}
+	}
+	return toolfns.Errorf(toolfns.CodeToolFailed, "%v", err)
+}
+
+func writeError(w http.ResponseWriter, err *toolfns.Error) {
+	writeJSON(w, err.Code.Status(), toolResponse{Error: err})
+}
+
+// writeJSON encodes v before writing anything, so that encoding failures can still be reported as an internal error.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		status = http.StatusInternalServerError
+		b, _ = json.Marshal(toolResponse{
+			Error: toolfns.Errorf(toolfns.CodeInternal, "encode response: %v", err),
+		})
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zakkor/server/previews"
+	"github.com/zakkor/server/toolfns"
+)
+
+// ServePreview proxies /preview/{chat_id}/{port}/... to the web server a process of the chat runs on port. It is
+// served on the port of -preview-ports assigned to the preview, so that the pages of previews cannot make requests to
+// the tool server or to other previews as them.
+//
+// Iframes cannot set the Authorization header, so the signed URL PreviewURL returns authorizes the preview instead. It
+// is exchanged for a cookie scoped to the preview, which the requests the page makes carry, and which is renewed while
+// they do.
+func (tr *ToolHandler) ServePreview(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "chat_id")
+	if _, err := tr.Workspaces.Path(chatID); err != nil {
+		writeError(w, toWorkspaceError(err))
+		return
+	}
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil || port < 1 || port > 65535 {
+		writeError(w, toolfns.Errorf(toolfns.CodeInvalidArguments, "invalid port: %q", chi.URLParam(r, "port")))
+		return
+	}
+	prefix := previews.Prefix(chatID, port)
+	servingPort := 0
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr); ok {
+		servingPort = addr.Port
+	}
+	if !tr.Previews.Serves(servingPort, chatID, port) {
+		http.Error(w, "This preview is no longer served here. Ask for a new link.", http.StatusNotFound)
+		return
+	}
+
+	if token := r.URL.Query().Get("token"); token != "" {
+		expires, ok := tr.Previews.Verify(chatID, port, token)
+		if !ok {
+			http.Error(w, "The preview link expired. Ask for a new one.", http.StatusUnauthorized)
+			return
+		}
+		setPreviewCookie(w, r, prefix, token, expires)
+
+		// Redirect to the URL without the token, so the app never sees it.
+		q := r.URL.Query()
+		q.Del("token")
+		u := *r.URL
+		u.RawQuery = q.Encode()
+		http.Redirect(w, r, u.RequestURI(), http.StatusFound)
+		return
+	}
+
+	if !authorized(r) {
+		c, err := r.Cookie(previews.CookieName)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		expires, ok := tr.Previews.Verify(chatID, port, c.Value)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if time.Until(expires) < previews.TokenTTL/2 {
+			token, expires := tr.Previews.Token(chatID, port)
+			setPreviewCookie(w, r, prefix, token, expires)
+		}
+	}
+	if !tr.Previews.Owns(chatID, port) {
+		http.Error(w, fmt.Sprintf("No process of this chat listens on port %d.", port), http.StatusForbidden)
+		return
+	}
+	if r.URL.Path == prefix {
+		http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+		return
+	}
+	tr.Previews.Handler(chatID, port, chi.URLParam(r, "*")).ServeHTTP(w, r)
+}
+
+func setPreviewCookie(w http.ResponseWriter, r *http.Request, prefix, token string, expires time.Time) {
+	cookie := &http.Cookie{Name: previews.CookieName, Value: token, Path: prefix + "/", Expires: expires,
+		HttpOnly: true, SameSite: http.SameSiteLaxMode}
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		// The UI may be served from another site, which only sends cookies to its iframes when they allow it.
+		cookie.SameSite, cookie.Secure = http.SameSiteNoneMode, true
+	}
+	http.SetCookie(w, cookie)
+}
+
+// RedirectPreview redirects the preview URLs PreviewURL returns, which are relative to the tool server, to the port
+// the preview is served on.
+func (tr *ToolHandler) RedirectPreview(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "chat_id")
+	if _, err := tr.Workspaces.Path(chatID); err != nil {
+		writeError(w, toWorkspaceError(err))
+		return
+	}
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil || port < 1 || port > 65535 {
+		writeError(w, toolfns.Errorf(toolfns.CodeInvalidArguments, "invalid port: %q", chi.URLParam(r, "port")))
+		return
+	}
+	servingPort := strconv.Itoa(tr.Previews.Port(chatID, port))
+
+	base := &url.URL{Scheme: "http", Host: r.Host}
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		base.Scheme = "https"
+	}
+	if *previewURL != "" {
+		if base, err = url.Parse(*previewURL); err != nil {
+			writeError(w, toolfns.Errorf(toolfns.CodeInternal, "invalid -preview-url: %v", err))
+			return
+		}
+	}
+	base.Host = net.JoinHostPort(base.Hostname(), servingPort)
+	http.Redirect(w, r, strings.TrimRight(base.String(), "/")+r.URL.RequestURI(), http.StatusFound)
+}
+
+// parsePortRange parses a range of ports like 8082-8101, or a single port.
+func parsePortRange(s string) ([]int, error) {
+	first, last, ok := strings.Cut(s, "-")
+	if !ok {
+		last = first
+	}
+	from, err1 := strconv.Atoi(strings.TrimSpace(first))
+	to, err2 := strconv.Atoi(strings.TrimSpace(last))
+	if err1 != nil || err2 != nil || from < 1 || to > 65535 || from > to {
+		return nil, fmt.Errorf("invalid port range: %q", s)
+	}
+	var ports []int
+	for port := from; port <= to; port++ {
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
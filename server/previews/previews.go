@@ -0,0 +1,275 @@
+// Package previews proxies the web servers tools start on local ports, so the user can open them from another device.
+package previews
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// CookieName is the cookie a preview is authorized with once its signed URL was opened. It is scoped to the path of
+// the preview.
+const CookieName = "llum_preview"
+
+// maxHTMLSize is the largest HTML page that is rewritten. Larger pages are passed through as they are.
+const maxHTMLSize = 10 << 20
+
+// TokenTTL is how long a signed preview URL can be opened. The cookie it is exchanged for is renewed while the
+// preview is in use.
+const TokenTTL = time.Hour
+
+// ownershipTTL is how long Owns remembers whether a chat's process listens on a port, since every request of a
+// preview checks it.
+const ownershipTTL = 5 * time.Second
+
+type Proxy struct {
+	// key signs preview URLs, so they can be opened in an iframe without the Authorization header. It is random, so
+	// URLs do not outlive the server.
+	key []byte
+	// owns reports whether a process of the chat listens on the port. Other ports are not proxied.
+	owns func(chatID string, port int) bool
+	// ports are the ports previews are served on. Each serves one preview at a time, so that every preview has an
+	// origin of its own, and the pages of one cannot read another.
+	ports []int
+
+	mu       sync.Mutex
+	owned    map[string]ownership
+	assigned []assignment
+}
+
+type ownership struct {
+	ok        bool
+	checkedAt time.Time
+}
+
+// assignment is the preview a port serves, identified by its prefix.
+type assignment struct {
+	prefix   string
+	lastUsed time.Time
+}
+
+// New creates a proxy that serves previews on ports.
+func New(ports []int, owns func(chatID string, port int) bool) *Proxy {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &Proxy{
+		key:      key,
+		owns:     owns,
+		ports:    ports,
+		owned:    map[string]ownership{},
+		assigned: make([]assignment, len(ports)),
+	}
+}
+
+// Prefix returns the path the preview of port is served under.
+func Prefix(chatID string, port int) string {
+	return "/preview/" + chatID + "/" + strconv.Itoa(port)
+}
+
+// Owns reports whether a process of chatID listens on port, so that its preview may be served.
+func (p *Proxy) Owns(chatID string, port int) bool {
+	key := Prefix(chatID, port)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, o := range p.owned {
+		if time.Since(o.checkedAt) > ownershipTTL {
+			delete(p.owned, k)
+		}
+	}
+	o, ok := p.owned[key]
+	if !ok {
+		o = ownership{ok: p.owns(chatID, port), checkedAt: time.Now()}
+		p.owned[key] = o
+	}
+	return o.ok
+}
+
+// Port returns the port the preview of port is served on. Previews without one are assigned the port of the preview
+// used least recently, which stops serving it.
+func (p *Proxy) Port(chatID string, port int) int {
+	prefix := Prefix(chatID, port)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	oldest := 0
+	for i, a := range p.assigned {
+		if a.prefix == prefix {
+			p.assigned[i].lastUsed = time.Now()
+			return p.ports[i]
+		}
+		if a.lastUsed.Before(p.assigned[oldest].lastUsed) {
+			oldest = i
+		}
+	}
+	p.assigned[oldest] = assignment{prefix: prefix, lastUsed: time.Now()}
+	return p.ports[oldest]
+}
+
+// Serves reports whether the preview of port is served on servingPort.
+func (p *Proxy) Serves(servingPort int, chatID string, port int) bool {
+	i := slices.Index(p.ports, servingPort)
+	if i < 0 {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.assigned[i].prefix != Prefix(chatID, port) {
+		return false
+	}
+	p.assigned[i].lastUsed = time.Now()
+	return true
+}
+
+// URL returns the signed URL of path in the preview of port, relative to the tool server.
+func (p *Proxy) URL(chatID string, port int, path string) string {
+	path, query, _ := strings.Cut(strings.TrimPrefix(path, "/"), "?")
+	q, _ := url.ParseQuery(query)
+	token, _ := p.Token(chatID, port)
+	q.Set("token", token)
+	return Prefix(chatID, port) + "/" + path + "?" + q.Encode()
+}
+
+// Token returns a token that authorizes the preview of port until it expires.
+func (p *Proxy) Token(chatID string, port int) (token string, expires time.Time) {
+	expires = time.Now().Add(TokenTTL).Truncate(time.Second)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + p.sign(chatID, port, exp), expires
+}
+
+// Verify reports whether token authorizes the preview of port, and when it expires.
+func (p *Proxy) Verify(chatID string, port int, token string) (expires time.Time, ok bool) {
+	exp, sig, _ := strings.Cut(token, ".")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || !hmac.Equal([]byte(sig), []byte(p.sign(chatID, port, exp))) {
+		return time.Time{}, false
+	}
+	expires = time.Unix(unix, 0)
+	return expires, time.Now().Before(expires)
+}
+
+func (p *Proxy) sign(chatID string, port int, expires string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(Prefix(chatID, port) + "\x00" + expires))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// Handler proxies requests for path, the part of the URL after the preview's prefix, to port on the loopback
+// interface. WebSocket upgrades are passed through.
+func (p *Proxy) Handler(chatID string, port int, path string) http.Handler {
+	prefix := Prefix(chatID, port)
+	target := &url.URL{Scheme: "http", Host: "127.0.0.1:" + strconv.Itoa(port)}
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.URL.Path = "/" + strings.TrimPrefix(path, "/")
+			r.Out.URL.RawPath = ""
+			r.SetXForwarded()
+			r.Out.Header.Set("X-Forwarded-Prefix", prefix)
+			// The app must not see the credentials of the tool server.
+			r.Out.Header.Del("Authorization")
+			removeCookie(r.Out, CookieName)
+			// Responses are rewritten, which compression would get in the way of.
+			r.Out.Header.Del("Accept-Encoding")
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			return rewriteResponse(resp, prefix, target.Host)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			msg := fmt.Sprintf("Cannot reach the preview: %v", err)
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				msg = fmt.Sprintf("Nothing is listening on port %d. Start the web server first.", port)
+			}
+			http.Error(w, msg, http.StatusBadGateway)
+		},
+	}
+}
+
+func removeCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			r.AddCookie(c)
+		}
+	}
+}
+
+// rewriteResponse makes the response work under prefix: redirects and root-relative URLs in HTML pages get the
+// prefix, and the page can be framed by the UI.
+func rewriteResponse(resp *http.Response, prefix, host string) error {
+	if loc := resp.Header.Get("Location"); loc != "" {
+		resp.Header.Set("Location", rewriteLocation(loc, prefix, host))
+	}
+	resp.Header.Del("X-Frame-Options")
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || resp.Header.Get("Content-Encoding") != "" ||
+		resp.ContentLength > maxHTMLSize {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTMLSize+1))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if len(body) <= maxHTMLSize {
+		body = RewriteHTML(body, prefix)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+func rewriteLocation(loc, prefix, host string) string {
+	u, err := url.Parse(loc)
+	if err != nil {
+		return loc
+	}
+	switch {
+	case u.Host == "" && strings.HasPrefix(u.Path, "/"):
+	case u.Host == host || u.Hostname() == "localhost" && u.Port() == strings.TrimPrefix(host, "127.0.0.1:"):
+		u.Scheme, u.Host = "", ""
+	default:
+		return loc
+	}
+	if !strings.HasPrefix(u.Path, prefix+"/") {
+		u.Path = prefix + u.Path
+		u.RawPath = ""
+	}
+	return u.String()
+}
+
+// rootRelativeRegex matches the start of a root-relative URL in an HTML attribute, but not a protocol-relative one.
+var rootRelativeRegex = regexp.MustCompile(`(?i)(\s(?:href|src|action|formaction|poster|data)\s*=\s*["']?)/([^/])`)
+
+// RewriteHTML prefixes the root-relative URLs of the attributes in page. Relative URLs already resolve under prefix.
+func RewriteHTML(page []byte, prefix string) []byte {
+	var out []byte
+	last := 0
+	for _, m := range rootRelativeRegex.FindAllSubmatchIndex(page, -1) {
+		// The slash that starts the URL.
+		slash := m[3]
+		// Pages that already know their prefix, e.g. from X-Forwarded-Prefix, are left alone.
+		if bytes.HasPrefix(page[slash:], []byte(prefix+"/")) {
+			continue
+		}
+		out = append(out, page[last:slash]...)
+		out = append(out, prefix...)
+		last = slash
+	}
+	return append(out, page[last:]...)
+}
@@ -0,0 +1,120 @@
+package processes
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/zakkor/server/secrets"
+)
+
+// ListensOn reports whether a running process of chatID, or one it started, listens on the TCP port. Processes that
+// left the group of the process that started them, e.g. daemons, are not found.
+func (m *Manager) ListensOn(chatID string, port int) bool {
+	groups := map[int]bool{}
+	m.mu.Lock()
+	for _, p := range m.chats[chatID] {
+		select {
+		case <-p.done:
+		default:
+			groups[p.cmd.Process.Pid] = true
+		}
+	}
+	m.mu.Unlock()
+	if len(groups) == 0 {
+		return false
+	}
+
+	var pids []int
+	if runtime.GOOS == "linux" {
+		pids = procListeners(port, groups)
+	} else {
+		pids = lsofListeners(port)
+	}
+	for _, pid := range pids {
+		if pgid, err := syscall.Getpgid(pid); err == nil && groups[pgid] {
+			return true
+		}
+	}
+	return false
+}
+
+// procListeners returns the processes in groups that have a socket listening on port open, from /proc.
+func procListeners(port int, groups map[int]bool) []int {
+	inodes := map[string]bool{}
+	for _, name := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		listeningInodes(name, port, inodes)
+	}
+	if len(inodes) == 0 {
+		return nil
+	}
+
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	var pids []int
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil {
+			continue
+		}
+		// Only the file descriptors of the processes that could match are read.
+		if pgid, err := syscall.Getpgid(pid); err != nil || !groups[pgid] {
+			continue
+		}
+		fds, _ := os.ReadDir(filepath.Join(dir, "fd"))
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err == nil && strings.HasPrefix(link, "socket:[") && inodes[strings.Trim(link[len("socket:"):], "[]")] {
+				pids = append(pids, pid)
+				break
+			}
+		}
+	}
+	return pids
+}
+
+// listeningInodes adds the inodes of the sockets listening on port in the /proc/net table name to inodes.
+func listeningInodes(name string, port int, inodes map[string]bool) {
+	// In the tables, the state of listening sockets is 0A.
+	const listen = "0A"
+
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Scan() // The header.
+	for s.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...
+		fields := strings.Fields(s.Text())
+		if len(fields) < 10 || fields[3] != listen {
+			continue
+		}
+		_, hexPort, _ := strings.Cut(fields[1], ":")
+		if p, err := strconv.ParseInt(hexPort, 16, 32); err == nil && int(p) == port {
+			inodes[fields[9]] = true
+		}
+	}
+}
+
+// lsofListeners returns the processes listening on port, from lsof, on systems without /proc.
+func lsofListeners(port int) []int {
+	cmd := exec.Command("lsof", "-nP", "-t", "-iTCP:"+strconv.Itoa(port), "-sTCP:LISTEN")
+	cmd.Env = secrets.ChildEnv(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, line := range strings.Fields(string(out)) {
+		if pid, err := strconv.Atoi(line); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
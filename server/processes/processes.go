@@ -0,0 +1,248 @@
+// Package processes runs long-lived commands, like dev servers and watchers, in the background of a chat.
+package processes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/zakkor/server/ringbuf"
+	"github.com/zakkor/server/secrets"
+)
+
+var ErrNotFound = errors.New("process not found")
+
+// stopTimeout is how long a stopped process tree gets to exit before it is killed.
+const stopTimeout = 5 * time.Second
+
+// Info describes a process. ExitCode is only meaningful once Running is false.
+type Info struct {
+	ID        string     `json:"id"`
+	Command   string     `json:"command"`
+	PID       int        `json:"pid"`
+	Running   bool       `json:"running"`
+	ExitCode  int        `json:"exit_code"`
+	StartedAt time.Time  `json:"started_at"`
+	ExitedAt  *time.Time `json:"exited_at,omitempty"`
+}
+
+// Output is a chunk of the output of a process. Truncated is set when the output started at the requested offset had
+// already been dropped from the log.
+type Output struct {
+	Output     string `json:"output"`
+	NextOffset int64  `json:"next_offset"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	Info
+}
+
+type Manager struct {
+	logSize int
+
+	mu     sync.Mutex
+	chats  map[string]map[string]*Process
+	nextID int
+}
+
+// New creates a manager that keeps the last logSize bytes of output of every process.
+func New(logSize int) *Manager {
+	return &Manager{
+		logSize: logSize,
+		chats:   make(map[string]map[string]*Process),
+	}
+}
+
+// Start runs command with bash in dir, as a process of chatID.
+func (m *Manager) Start(chatID, dir, command string) (*Process, error) {
+	cmd := exec.Command("bash", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = secrets.ChildEnv(cmd)
+	// The process leads its own group, so that stopping it reaches everything it started.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// Daemons that left the group can keep the output open, which must not keep the process from being reaped.
+	cmd.WaitDelay = stopTimeout
+
+	p := &Process{
+		Command: command,
+		cmd:     cmd,
+		log:     ringbuf.New(m.logSize),
+		done:    make(chan struct{}),
+	}
+	cmd.Stdout = p.log
+	cmd.Stderr = p.log
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	p.stdin = stdin
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p.startedAt = time.Now()
+	go p.wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	p.ID = fmt.Sprintf("p%d", m.nextID)
+	if m.chats[chatID] == nil {
+		m.chats[chatID] = make(map[string]*Process)
+	}
+	m.chats[chatID][p.ID] = p
+	return p, nil
+}
+
+// Get returns the process of chatID with the given ID.
+func (m *Manager) Get(chatID, id string) (*Process, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.chats[chatID][id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return p, nil
+}
+
+// List returns the processes of chatID, oldest first, including the ones that exited.
+func (m *Manager) List(chatID string) []Info {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := []Info{}
+	for _, p := range m.chats[chatID] {
+		list = append(list, p.Info())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.Before(list[j].StartedAt) })
+	return list
+}
+
+// Stop stops the process tree of the given process and forgets it.
+func (m *Manager) Stop(chatID, id string) (Info, error) {
+	m.mu.Lock()
+	p, ok := m.chats[chatID][id]
+	delete(m.chats[chatID], id)
+	m.mu.Unlock()
+	if !ok {
+		return Info{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	p.stop()
+	return p.Info(), nil
+}
+
+// StopChat stops every process of chatID.
+func (m *Manager) StopChat(chatID string) {
+	m.mu.Lock()
+	procs := m.chats[chatID]
+	delete(m.chats, chatID)
+	m.mu.Unlock()
+	stopAll(procs)
+}
+
+// StopAll stops every process of every chat.
+func (m *Manager) StopAll() {
+	m.mu.Lock()
+	chats := m.chats
+	m.chats = make(map[string]map[string]*Process)
+	m.mu.Unlock()
+	for _, procs := range chats {
+		stopAll(procs)
+	}
+}
+
+func stopAll(procs map[string]*Process) {
+	var wg sync.WaitGroup
+	for _, p := range procs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.stop()
+		}()
+	}
+	wg.Wait()
+}
+
+type Process struct {
+	ID      string
+	Command string
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	log   *ringbuf.Buffer
+
+	startedAt time.Time
+	mu        sync.Mutex
+	exitedAt  time.Time
+	exitCode  int
+
+	done chan struct{}
+}
+
+func (p *Process) wait() {
+	err := p.cmd.Wait()
+	p.mu.Lock()
+	p.exitedAt = time.Now()
+	p.exitCode = p.cmd.ProcessState.ExitCode()
+	if err != nil && p.exitCode == 0 {
+		p.exitCode = -1
+	}
+	p.mu.Unlock()
+	close(p.done)
+}
+
+func (p *Process) Info() Info {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info := Info{
+		ID:        p.ID,
+		Command:   p.Command,
+		PID:       p.cmd.Process.Pid,
+		StartedAt: p.startedAt,
+	}
+	select {
+	case <-p.done:
+		info.ExitCode = p.exitCode
+		exitedAt := p.exitedAt
+		info.ExitedAt = &exitedAt
+	default:
+		info.Running = true
+	}
+	return info
+}
+
+// Read returns up to limit bytes of the output of the process from offset on.
+func (p *Process) Read(offset int64, limit int) Output {
+	data, next, truncated := p.log.ReadFrom(offset, limit)
+	return Output{Output: string(data), NextOffset: next, Truncated: truncated, Info: p.Info()}
+}
+
+// Write sends input to the stdin of the process.
+func (p *Process) Write(input []byte) (int, error) {
+	select {
+	case <-p.done:
+		return 0, fmt.Errorf("process %s has exited", p.ID)
+	default:
+	}
+	return p.stdin.Write(input)
+}
+
+// Done is closed when the process exits.
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// stop asks the process tree to terminate, and kills it if it has not exited after stopTimeout.
+func (p *Process) stop() {
+	pgid := -p.cmd.Process.Pid
+	syscall.Kill(pgid, syscall.SIGTERM)
+	select {
+	case <-p.done:
+	case <-time.After(stopTimeout):
+	}
+	// Children may outlive the leader of the group, so the group is always killed.
+	syscall.Kill(pgid, syscall.SIGKILL)
+	<-p.done
+}
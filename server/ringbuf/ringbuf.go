@@ -0,0 +1,47 @@
+// Package ringbuf keeps the last part of a stream of output, such as the log of a process or the output of a job.
+package ringbuf
+
+import "sync"
+
+// Buffer keeps the last size bytes written to it, and counts every byte so readers can resume at an offset.
+type Buffer struct {
+	size int
+
+	mu    sync.Mutex
+	buf   []byte
+	total int64
+}
+
+func New(size int) *Buffer {
+	return &Buffer{size: size}
+}
+
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total += int64(len(p))
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.size {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.size:]...)
+	}
+	return len(p), nil
+}
+
+// ReadFrom returns up to limit bytes of what was written from offset on, and the offset to continue from. If part of
+// it was dropped, the rest is returned and truncated is set.
+func (b *Buffer) ReadFrom(offset int64, limit int) (data []byte, next int64, truncated bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start := b.total - int64(len(b.buf))
+	if offset < start {
+		offset, truncated = start, true
+	}
+	if offset > b.total {
+		offset = b.total
+	}
+	data = b.buf[offset-start:]
+	if len(data) > limit {
+		data = data[:limit]
+	}
+	return append([]byte(nil), data...), offset + int64(len(data)), truncated
+}
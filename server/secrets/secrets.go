@@ -0,0 +1,18 @@
+// Package secrets keeps the credentials the tool server is given away from the commands it runs.
+package secrets
+
+import (
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// Prefix starts the names of the environment variables that hold secrets, e.g. LLUM_SECRET_GITHUB_TOKEN.
+const Prefix = "LLUM_SECRET_"
+
+// ChildEnv returns the environment cmd would run with, without the secrets of the server, followed by extra. Commands
+// that need a secret are given it in extra under a name of their own. cmd.Dir must be set first, since it sets PWD.
+func ChildEnv(cmd *exec.Cmd, extra ...string) []string {
+	env := slices.DeleteFunc(cmd.Environ(), func(kv string) bool { return strings.HasPrefix(kv, Prefix) })
+	return append(env, extra...)
+}
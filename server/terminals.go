@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/zakkor/server/terminals"
+	"github.com/zakkor/server/toolfns"
+)
+
+var upgrader = websocket.Upgrader{CheckOrigin: allowedOrigin}
+
+// allowedOrigin reports whether a page of the request's Origin may open a WebSocket: the tool server's own pages and
+// the web UIs passed with -origins. Clients that are not browsers send no Origin.
+func allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range strings.Split(*origins, ",") {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// terminalMessage is a control message sent as a text frame. Input can also be sent as binary frames.
+type terminalMessage struct {
+	Type     string `json:"type"` // auth, input, resize or exit
+	Password string `json:"password,omitempty"`
+	Data     string `json:"data,omitempty"`
+	Cols     int    `json:"cols,omitempty"`
+	Rows     int    `json:"rows,omitempty"`
+}
+
+type screenMessage struct {
+	Type string `json:"type"`
+	terminals.Screen
+}
+
+// AttachTerminal connects a WebSocket to a chat's terminal. By default, output is sent as binary frames for a
+// terminal emulator to draw, starting with the recent output. With ?format=screen, the screen is sent as text
+// instead. With ?mode=watch, input is ignored.
+//
+// Browsers cannot set the Authorization header of a WebSocket, so they send an auth message first instead.
+func (tr *ToolHandler) AttachTerminal(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "chat_id")
+	if _, err := tr.Workspaces.Path(chatID); err != nil {
+		writeError(w, toWorkspaceError(err))
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if !authorized(r) {
+		var msg terminalMessage
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != "auth" || !passwordMatches(msg.Password) {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "unauthorized"), time.Now().Add(time.Second))
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+	}
+
+	// The workspace is only created once the client is authorized.
+	dir, terr := tr.workspace(chatID)
+	if terr != nil {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseInternalServerErr, terr.Message), time.Now().Add(time.Second))
+		return
+	}
+	term, err := tr.Terminals.Get(chatID, dir)
+	if err != nil {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseInternalServerErr, err.Error()), time.Now().Add(time.Second))
+		return
+	}
+
+	history, output, stop := term.Watch()
+	defer stop()
+	go tr.pumpTerminal(conn, term, r.URL.Query().Get("format") == "screen", history, output)
+
+	watchOnly := r.URL.Query().Get("mode") == "watch"
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if kind == websocket.BinaryMessage {
+			if !watchOnly {
+				term.Write(data)
+			}
+			continue
+		}
+
+		var msg terminalMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		switch msg.Type {
+		case "input":
+			if !watchOnly {
+				term.Write([]byte(msg.Data))
+			}
+		case "resize":
+			if !watchOnly && msg.Cols > 0 && msg.Rows > 0 {
+				term.Resize(msg.Cols, msg.Rows)
+			}
+		}
+	}
+}
+
+// pumpTerminal sends the output of term to conn until the terminal exits or the watcher is stopped.
+func (tr *ToolHandler) pumpTerminal(conn *websocket.Conn, term *terminals.Session, screen bool, history []byte,
+	output <-chan []byte) {
+	// Screens are sent at most this often, since a burst of output would otherwise send one per chunk.
+	const screenInterval = 50 * time.Millisecond
+
+	send := func(data []byte) error {
+		if screen {
+			return conn.WriteJSON(screenMessage{Type: "screen", Screen: term.Screen()})
+		}
+		return conn.WriteMessage(websocket.BinaryMessage, data)
+	}
+
+	if err := send(history); err != nil {
+		return
+	}
+	for data := range output {
+		if screen {
+			time.Sleep(screenInterval)
+			// Drain what arrived in the meantime, since only the latest screen matters.
+			for drained := false; !drained; {
+				select {
+				case _, ok := <-output:
+					drained = !ok
+				default:
+					drained = true
+				}
+			}
+		}
+		if err := send(data); err != nil {
+			return
+		}
+	}
+
+	select {
+	case <-term.Done():
+		conn.WriteJSON(terminalMessage{Type: "exit"})
+	default:
+	}
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}
+
+func (tr *ToolHandler) GetTerminalScreen(w http.ResponseWriter, r *http.Request) {
+	dir, terr := tr.workspace(chi.URLParam(r, "chat_id"))
+	if terr != nil {
+		writeError(w, terr)
+		return
+	}
+	term, err := tr.Terminals.Get(chi.URLParam(r, "chat_id"), dir)
+	if err != nil {
+		writeError(w, toolfns.Errorf(toolfns.CodeInternal, "%v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: term.Screen()})
+}
+
+func (tr *ToolHandler) CloseTerminal(w http.ResponseWriter, r *http.Request) {
+	tr.Terminals.Close(chi.URLParam(r, "chat_id"))
+	writeJSON(w, http.StatusOK, toolResponse{OK: true})
+}
@@ -0,0 +1,280 @@
+// Package terminals runs an interactive shell on a pseudo-terminal for every chat that asks for one.
+package terminals
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/hinshun/vt10x"
+	"github.com/zakkor/server/secrets"
+)
+
+var ErrClosed = errors.New("terminal closed")
+
+// historySize is how many bytes of recent output are replayed to new watchers, so they can draw the screen.
+const historySize = 64 << 10
+
+type Screen struct {
+	Cols   int      `json:"cols"`
+	Rows   int      `json:"rows"`
+	Title  string   `json:"title,omitempty"`
+	Lines  []string `json:"lines"`
+	Cursor struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+	} `json:"cursor"`
+}
+
+// String returns the lines of the screen, without trailing blank lines.
+func (s Screen) String() string {
+	lines := s.Lines
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+type Manager struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func New() *Manager {
+	return &Manager{sessions: make(map[string]*Session)}
+}
+
+// Get returns chatID's terminal, starting a shell in dir if it has none or its shell exited.
+func (m *Manager) Get(chatID, dir string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[chatID]; ok {
+		select {
+		case <-s.done:
+		default:
+			return s, nil
+		}
+	}
+
+	s, err := start(dir)
+	if err != nil {
+		return nil, err
+	}
+	m.sessions[chatID] = s
+	return s, nil
+}
+
+// Close ends chatID's terminal, if it has one.
+func (m *Manager) Close(chatID string) {
+	m.mu.Lock()
+	s, ok := m.sessions[chatID]
+	delete(m.sessions, chatID)
+	m.mu.Unlock()
+	if ok {
+		s.Close()
+	}
+}
+
+// CloseAll ends every terminal.
+func (m *Manager) CloseAll() {
+	m.mu.Lock()
+	sessions := m.sessions
+	m.sessions = make(map[string]*Session)
+	m.mu.Unlock()
+	for _, s := range sessions {
+		s.Close()
+	}
+}
+
+// Session is a shell running on a pseudo-terminal. Its output is fed to a terminal emulator, so that the screen can
+// be read as text, and to the watchers attached to it.
+type Session struct {
+	cmd *exec.Cmd
+	pty *os.File
+	vt  vt10x.Terminal
+
+	mu         sync.Mutex
+	history    []byte
+	watchers   map[chan []byte]struct{}
+	lastOutput time.Time
+
+	done chan struct{}
+}
+
+func start(dir string) (*Session, error) {
+	cmd := exec.Command("bash", "-i")
+	cmd.Dir = dir
+	cmd.Env = secrets.ChildEnv(cmd, "TERM=xterm-256color")
+
+	const cols, rows = 80, 24
+	f, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: cols, Rows: rows})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		cmd: cmd,
+		pty: f,
+		// The emulator answers queries like the cursor position the way a terminal would.
+		vt:         vt10x.New(vt10x.WithWriter(f), vt10x.WithSize(cols, rows)),
+		watchers:   make(map[chan []byte]struct{}),
+		lastOutput: time.Now(),
+		done:       make(chan struct{}),
+	}
+	go s.read()
+	return s, nil
+}
+
+func (s *Session) read() {
+	buf := make([]byte, 32<<10)
+	var pending []byte
+	for {
+		n, err := s.pty.Read(buf)
+		if n > 0 {
+			data := buf[:n]
+
+			// The emulator only consumes whole UTF-8 sequences.
+			pending = append(pending, data...)
+			written, _ := s.vt.Write(pending)
+			pending = append(pending[:0], pending[written:]...)
+
+			s.mu.Lock()
+			s.history = append(s.history, data...)
+			if len(s.history) > historySize {
+				s.history = append(s.history[:0], s.history[len(s.history)-historySize:]...)
+			}
+			s.lastOutput = time.Now()
+			for ch := range s.watchers {
+				select {
+				case ch <- append([]byte(nil), data...):
+				default:
+					// A watcher that falls behind would see a corrupted screen, so it is dropped instead.
+					delete(s.watchers, ch)
+					close(ch)
+				}
+			}
+			s.mu.Unlock()
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	s.cmd.Wait()
+	close(s.done)
+	s.mu.Lock()
+	for ch := range s.watchers {
+		delete(s.watchers, ch)
+		close(ch)
+	}
+	s.mu.Unlock()
+}
+
+// Watch returns the recent output of the terminal and a channel receiving everything it outputs from then on. The
+// channel is closed when the shell exits, when the watcher falls behind, or when stop is called.
+func (s *Session) Watch() (history []byte, output <-chan []byte, stop func()) {
+	ch := make(chan []byte, 256)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	history = append([]byte(nil), s.history...)
+	select {
+	case <-s.done:
+		close(ch)
+		return history, ch, func() {}
+	default:
+	}
+	s.watchers[ch] = struct{}{}
+
+	return history, ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.watchers[ch]; ok {
+			delete(s.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Write sends input to the shell, as if it was typed.
+func (s *Session) Write(p []byte) (int, error) {
+	select {
+	case <-s.done:
+		return 0, ErrClosed
+	default:
+	}
+	return s.pty.Write(p)
+}
+
+func (s *Session) Resize(cols, rows int) error {
+	if err := pty.Setsize(s.pty, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)}); err != nil {
+		return err
+	}
+	s.vt.Resize(cols, rows)
+	return nil
+}
+
+// Screen returns what the terminal currently displays.
+func (s *Session) Screen() Screen {
+	s.vt.Lock()
+	defer s.vt.Unlock()
+
+	var screen Screen
+	screen.Cols, screen.Rows = s.vt.Size()
+	screen.Title = s.vt.Title()
+	cur := s.vt.Cursor()
+	screen.Cursor.X, screen.Cursor.Y = cur.X, cur.Y
+
+	line := make([]rune, screen.Cols)
+	for y := 0; y < screen.Rows; y++ {
+		for x := range line {
+			line[x] = s.vt.Cell(x, y).Char
+		}
+		screen.Lines = append(screen.Lines, strings.TrimRight(string(line), " \x00"))
+	}
+	return screen
+}
+
+// Settle waits until the terminal has produced no output for quiet, or until max has passed. Output from before the
+// call does not count, so it always waits for at least quiet.
+func (s *Session) Settle(quiet, max time.Duration) {
+	start := time.Now()
+	deadline := start.Add(max)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		last := s.lastOutput
+		s.mu.Unlock()
+		if last.Before(start) {
+			last = start
+		}
+		idle := time.Since(last)
+		if idle >= quiet {
+			return
+		}
+		select {
+		case <-s.done:
+			return
+		case <-time.After(quiet - idle):
+		}
+	}
+}
+
+// Done is closed when the shell exits.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close ends the shell and everything it started.
+func (s *Session) Close() {
+	if s.cmd.Process != nil {
+		// The shell leads its own process group on the terminal, so signalling the group reaches its children.
+		syscall.Kill(-s.cmd.Process.Pid, syscall.SIGHUP)
+	}
+	s.pty.Close()
+}
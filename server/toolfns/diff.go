@@ -0,0 +1,166 @@
+package toolfns
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is how many unchanged lines surround each hunk.
+const diffContext = 3
+
+// maxDiffCells bounds the memory the diff table may use. Larger changes are shown as a single replacement.
+const maxDiffCells = 4 << 20
+
+// Diff returns a unified diff that turns before into after, using path as the name of both sides. It is empty when
+// they are equal.
+func Diff(path, before, after string) string {
+	a, b := splitLines(before), splitLines(after)
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change and extend the hunk until the changes are further apart than twice the context.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				last = i
+			} else if i-last > 2*diffContext {
+				break
+			}
+		}
+		from := max(first-diffContext, start)
+		to := min(last+diffContext+1, len(ops))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", path, path)
+		}
+		writeHunk(&out, ops[from:to])
+		start = to
+	}
+	return out.String()
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+	// aLine and bLine are the 1-based numbers the line would have on either side.
+	aLine, bLine int
+}
+
+func writeHunk(out *strings.Builder, ops []diffOp) {
+	var aCount, bCount int
+	for _, op := range ops {
+		if op.kind != '+' {
+			aCount++
+		}
+		if op.kind != '-' {
+			bCount++
+		}
+	}
+	aStart, bStart := ops[0].aLine, ops[0].bLine
+	// An empty range is numbered after the line preceding it.
+	if aCount == 0 {
+		aStart--
+	}
+	if bCount == 0 {
+		bStart--
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+	for _, op := range ops {
+		out.WriteByte(op.kind)
+		out.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// diffLines returns the operations that turn a into b, based on their longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	// Common prefixes and suffixes are trimmed first, so that the table only covers the changed region.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	am, bm := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	var ops []diffOp
+	ai, bi := 1, 1
+	emit := func(kind byte, line string) {
+		ops = append(ops, diffOp{kind: kind, line: line, aLine: ai, bLine: bi})
+		if kind != '+' {
+			ai++
+		}
+		if kind != '-' {
+			bi++
+		}
+	}
+
+	for _, line := range a[:prefix] {
+		emit(' ', line)
+	}
+
+	if (len(am)+1)*(len(bm)+1) > maxDiffCells {
+		for _, line := range am {
+			emit('-', line)
+		}
+		for _, line := range bm {
+			emit('+', line)
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of am[i:] and bm[j:].
+		cols := len(bm) + 1
+		lcs := make([]int32, (len(am)+1)*cols)
+		for i := len(am) - 1; i >= 0; i-- {
+			for j := len(bm) - 1; j >= 0; j-- {
+				if am[i] == bm[j] {
+					lcs[i*cols+j] = lcs[(i+1)*cols+j+1] + 1
+				} else {
+					lcs[i*cols+j] = max(lcs[(i+1)*cols+j], lcs[i*cols+j+1])
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(am) || j < len(bm) {
+			switch {
+			case i < len(am) && j < len(bm) && am[i] == bm[j]:
+				emit(' ', am[i])
+				i++
+				j++
+			case i < len(am) && (j == len(bm) || lcs[(i+1)*cols+j] >= lcs[i*cols+j+1]):
+				emit('-', am[i])
+				i++
+			default:
+				emit('+', bm[j])
+				j++
+			}
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		emit(' ', line)
+	}
+	return ops
+}
+
+// splitLines splits s after every newline, keeping a final line without one.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,40 @@
+package toolfns
+
+import (
+	"errors"
+
+	"github.com/zakkor/server/docindex"
+)
+
+// Searches the documents the tool server indexes, like design docs, runbooks and PDFs, and returns the passages
+// that match the query best, best first, with their file and lines. Cite the passages you use by file and line.
+// query: The words to search for.
+// limit: How many passages to return at most. [optional, default=5, min=1, max=20]
+// [readonly, idempotent]
+func SearchDocs(inv *Invocation, query string, limit int) ([]docindex.Passage, error) {
+	if inv.Docs == nil {
+		return nil, Errorf(CodeNotFound, "no documents are indexed, the tool server was started without -docs")
+	}
+	return inv.Docs.Search(query, limit), nil
+}
+
+// Searches the indexed documents like SearchDocs, but also finds passages that say what the query means in other
+// words. Passages are ranked by fusing their keyword ranking with their ranking by embedding similarity to the query.
+// Warnings tell when passages could only be ranked by keyword, e.g. because they are still being embedded. Prefer it
+// over SearchDocs when you do not know the terms the documents use.
+// query: What to search for, as words or a question.
+// limit: How many passages to return at most. [optional, default=5, min=1, max=20]
+// [readonly, idempotent, network]
+func SemanticSearch(inv *Invocation, query string, limit int) (docindex.SemanticResults, error) {
+	if inv.Docs == nil {
+		return docindex.SemanticResults{}, Errorf(CodeNotFound, "no documents are indexed, the tool server was started without -docs")
+	}
+	res, err := inv.Docs.SemanticSearch(inv.Context(), query, limit)
+	switch {
+	case errors.Is(err, docindex.ErrNoEmbedder):
+		return res, Errorf(CodeNotFound, "semantic search is off, the tool server was started without -embeddings-url")
+	case err != nil:
+		return res, Errorf(CodeToolFailed, "%v", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,260 @@
+package toolfns
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/zakkor/server/secrets"
+)
+
+// preview describes the change a dry run would have made to path.
+func preview(path, before, after string) string {
+	// The path is shown the way Invocation.Path resolves it.
+	path = strings.TrimPrefix(filepath.Clean("/"+path), "/")
+	diff := Diff(path, before, after)
+	if diff == "" {
+		return "Dry run: " + path + " would not change."
+	}
+	return "Dry run: nothing was changed. This is the diff that would be applied:\n" + diff
+}
+
+// previewShell describes what a dry run of Shell would have run, warning about the parts that look dangerous.
+func previewShell(inv *Invocation, command string) string {
+	var warnings []string
+
+	// bash -n parses the command without running it.
+	cmd := exec.CommandContext(inv.Context(), "bash", "-n", "-c", command)
+	cmd.Env = secrets.ChildEnv(cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		warnings = append(warnings, "syntax error: "+strings.TrimSpace(stderr.String()))
+	}
+
+	commands := parseShell(command)
+	for i, c := range commands {
+		for _, w := range c.warnings() {
+			warnings = append(warnings, c.text+": "+w)
+		}
+		if reason := c.gitRewrite(); reason != "" && !inv.AllowGitRewrites {
+			warnings = append(warnings, c.text+": "+reason+", which the tool server does not allow")
+		}
+		if i > 0 && c.pipedInto() && slices.Contains([]string{"sh", "bash", "zsh", "python", "python3"}, c.name()) &&
+			slices.Contains([]string{"curl", "wget"}, commands[i-1].name()) {
+			warnings = append(warnings, c.text+": runs a script downloaded from the network")
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString("Dry run: the command was not executed.\nCommands:\n")
+	for i, c := range commands {
+		fmt.Fprintf(&out, "  %d. %s\n", i+1, c.text)
+	}
+	if len(warnings) == 0 {
+		out.WriteString("No warnings.\n")
+		return out.String()
+	}
+	out.WriteString("Warnings:\n")
+	for _, w := range warnings {
+		fmt.Fprintf(&out, "  - %s\n", w)
+	}
+	return out.String()
+}
+
+// shellCommand is a simple command of a shell command line.
+type shellCommand struct {
+	text string
+	// separator is the operator that preceded the command, e.g. && or |.
+	separator string
+	words     []string
+	// redirects are the files output is written to.
+	redirects []string
+}
+
+func (c *shellCommand) name() string {
+	if len(c.words) == 0 {
+		return ""
+	}
+	return filepath.Base(c.words[0])
+}
+
+func (c *shellCommand) pipedInto() bool {
+	return c.separator == "|"
+}
+
+func (c *shellCommand) warnings() []string {
+	var warnings []string
+	args := c.words
+	if len(args) > 0 && slices.Contains([]string{"sudo", "doas", "su"}, c.name()) {
+		warnings = append(warnings, "runs with elevated privileges")
+		args = args[1:]
+	}
+
+	var name string
+	if len(args) > 0 {
+		name = filepath.Base(args[0])
+	}
+	flags := func(short string, long ...string) bool {
+		for _, arg := range args[1:] {
+			if slices.Contains(long, arg) ||
+				strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.ContainsAny(arg[1:], short) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch name {
+	case "rm":
+		if flags("rRf", "--recursive", "--force") {
+			warnings = append(warnings, "deletes files without asking for confirmation")
+		} else {
+			warnings = append(warnings, "deletes files")
+		}
+	case "mv", "cp":
+		warnings = append(warnings, "can overwrite existing files")
+	case "chmod", "chown":
+		if flags("R", "--recursive") {
+			warnings = append(warnings, "changes permissions recursively")
+		}
+	case "dd", "mkfs", "shred", "fdisk":
+		warnings = append(warnings, "writes to disks or destroys data directly")
+	case "kill", "pkill", "killall", "shutdown", "reboot":
+		warnings = append(warnings, "stops processes or the machine")
+	case "curl", "wget", "ssh", "scp", "rsync":
+		warnings = append(warnings, "uses the network")
+	case "git":
+		if len(args) > 1 {
+			switch args[1] {
+			case "push":
+				if flags("f", "--force", "--force-with-lease") {
+					warnings = append(warnings, "rewrites the history of a remote repository")
+				} else {
+					warnings = append(warnings, "publishes commits to a remote repository")
+				}
+			case "reset", "checkout", "restore", "clean":
+				warnings = append(warnings, "can discard uncommitted changes")
+			case "clone", "fetch", "pull":
+				warnings = append(warnings, "uses the network")
+			}
+		}
+	case "npm", "pnpm", "yarn", "pip", "pip3", "go", "cargo":
+		if len(args) > 1 && slices.Contains([]string{"install", "add", "get"}, args[1]) {
+			warnings = append(warnings, "downloads and installs packages")
+		}
+	}
+
+	for _, r := range c.redirects {
+		if r != "/dev/null" {
+			warnings = append(warnings, "overwrites "+r)
+		}
+	}
+	// A command can be nothing but a redirect, like "> out.txt".
+	if len(c.words) > 1 {
+		for _, arg := range c.words[1:] {
+			if arg != "/dev/null" && (strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, "~") ||
+				slices.Contains(strings.Split(arg, "/"), "..")) {
+				warnings = append(warnings, "refers to "+arg+", which may be outside the workspace")
+			}
+		}
+	}
+	return warnings
+}
+
+// parseShell splits a command line into simple commands. It understands quoting, escapes, command separators and
+// output redirects, which is enough to describe a command, but not to run one.
+func parseShell(line string) []shellCommand {
+	var (
+		commands []shellCommand
+		cur      shellCommand
+		word     strings.Builder
+		inWord   bool
+		start    int
+		// redirect is set while reading the target of a redirect, to > if it replaces a file.
+		redirect string
+	)
+	endWord := func() {
+		if !inWord {
+			return
+		}
+		if redirect == ">" {
+			cur.redirects = append(cur.redirects, word.String())
+		} else if redirect == "" {
+			cur.words = append(cur.words, word.String())
+		}
+		word.Reset()
+		inWord = false
+		redirect = ""
+	}
+	endCommand := func(end int, separator string) {
+		endWord()
+		cur.text = strings.TrimSpace(line[start:end])
+		if cur.text != "" {
+			commands = append(commands, cur)
+		}
+		cur = shellCommand{separator: separator}
+	}
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == '\\' && i+1 < len(line):
+			i++
+			word.WriteByte(line[i])
+			inWord = true
+		case ch == '\'' || ch == '"':
+			end := strings.IndexByte(line[i+1:], ch)
+			if end < 0 {
+				end = len(line) - i - 1
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case ch == ' ' || ch == '\t':
+			endWord()
+		case ch == '>':
+			// A number right before > is the descriptor being redirected, not an argument.
+			if inWord && redirect == "" && isDigits(word.String()) {
+				word.Reset()
+				inWord = false
+			}
+			endWord()
+			redirect = ">"
+			// >> appends and >& duplicates a descriptor, neither of which replaces a file.
+			if i+1 < len(line) && (line[i+1] == '>' || line[i+1] == '&') {
+				redirect += string(line[i+1])
+				i++
+			}
+		case ch == ';' || ch == '\n' || ch == '|' || ch == '&':
+			separator := string(ch)
+			if i+1 < len(line) && (line[i+1] == '|' || line[i+1] == '&') && (ch == '|' || ch == '&') {
+				separator += string(line[i+1])
+			}
+			endCommand(i, separator)
+			i += len(separator) - 1
+			start = i + 1
+		case ch == '#' && !inWord:
+			endCommand(i, "")
+			if nl := strings.IndexByte(line[i:], '\n'); nl >= 0 {
+				i += nl
+				start = i + 1
+			} else {
+				i = len(line)
+				start = i
+			}
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+	endCommand(len(line), "")
+	return commands
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
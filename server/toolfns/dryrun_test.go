@@ -0,0 +1,97 @@
+package toolfns
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseShell(t *testing.T) {
+	tests := []struct {
+		line       string
+		texts      []string
+		words      [][]string
+		redirects  [][]string
+		separators []string
+	}{
+		{
+			line:       "echo hi",
+			texts:      []string{"echo hi"},
+			words:      [][]string{{"echo", "hi"}},
+			redirects:  [][]string{nil},
+			separators: []string{""},
+		},
+		{
+			line:       `grep -r "a b" . | sort && echo 'done;' > out.txt`,
+			texts:      []string{`grep -r "a b" .`, "sort", `echo 'done;' > out.txt`},
+			words:      [][]string{{"grep", "-r", "a b", "."}, {"sort"}, {"echo", "done;"}},
+			redirects:  [][]string{nil, nil, {"out.txt"}},
+			separators: []string{"", "|", "&&"},
+		},
+		{
+			line:       "make 2>&1 >> log.txt; ls 2> err.txt",
+			texts:      []string{"make 2>&1 >> log.txt", "ls 2> err.txt"},
+			words:      [][]string{{"make"}, {"ls"}},
+			redirects:  [][]string{nil, {"err.txt"}},
+			separators: []string{"", ";"},
+		},
+		{
+			line:       "> out.txt",
+			texts:      []string{"> out.txt"},
+			words:      [][]string{nil},
+			redirects:  [][]string{{"out.txt"}},
+			separators: []string{""},
+		},
+		{
+			line:       "echo a; >x # comment",
+			texts:      []string{"echo a", ">x"},
+			words:      [][]string{{"echo", "a"}, nil},
+			redirects:  [][]string{nil, {"x"}},
+			separators: []string{"", ";"},
+		},
+	}
+	for _, tt := range tests {
+		commands := parseShell(tt.line)
+		if len(commands) != len(tt.texts) {
+			t.Errorf("parseShell(%q) returned %d commands, want %d", tt.line, len(commands), len(tt.texts))
+			continue
+		}
+		for i, c := range commands {
+			if c.text != tt.texts[i] || !slices.Equal(c.words, tt.words[i]) ||
+				!slices.Equal(c.redirects, tt.redirects[i]) || c.separator != tt.separators[i] {
+				t.Errorf("parseShell(%q)[%d] = %q %q %q %q, want %q %q %q %q", tt.line, i,
+					c.text, c.words, c.redirects, c.separator, tt.texts[i], tt.words[i], tt.redirects[i], tt.separators[i])
+			}
+		}
+	}
+}
+
+func TestShellCommandWarnings(t *testing.T) {
+	tests := []struct {
+		line     string
+		warnings []string
+	}{
+		{"ls -la", nil},
+		{"rm -rf build", []string{"deletes files without asking for confirmation"}},
+		{"sudo rm notes.txt", []string{"runs with elevated privileges", "deletes files"}},
+		{"git push --force origin main", []string{"rewrites the history of a remote repository"}},
+		{"npm install left-pad", []string{"downloads and installs packages"}},
+		{"echo hi > out.txt", []string{"overwrites out.txt"}},
+		{"echo hi > /dev/null", nil},
+		{"cat ../secrets /etc/passwd", []string{
+			"refers to ../secrets, which may be outside the workspace",
+			"refers to /etc/passwd, which may be outside the workspace",
+		}},
+		{"> out.txt", []string{"overwrites out.txt"}},
+		{">> log.txt", nil},
+	}
+	for _, tt := range tests {
+		commands := parseShell(tt.line)
+		if len(commands) != 1 {
+			t.Errorf("parseShell(%q) returned %d commands, want 1", tt.line, len(commands))
+			continue
+		}
+		if got := commands[0].warnings(); !slices.Equal(got, tt.warnings) {
+			t.Errorf("warnings of %q = %q, want %q", tt.line, got, tt.warnings)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package toolfns
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ErrorCode classifies why a tool invocation failed.
+type ErrorCode string
+
+const (
+	CodeInvalidArguments ErrorCode = "invalid_arguments"
+	CodeNotFound         ErrorCode = "not_found"
+	CodeTimeout          ErrorCode = "timeout"
+	CodeCanceled         ErrorCode = "canceled"
+	CodePending          ErrorCode = "pending"
+	CodeDenied           ErrorCode = "denied"
+	CodeConflict         ErrorCode = "conflict"
+	CodeToolFailed       ErrorCode = "tool_failed"
+	CodeInternal         ErrorCode = "internal"
+)
+
+type ErrorCodeInfo struct {
+	Code        ErrorCode `json:"code"`
+	Status      int       `json:"status"`
+	Description string    `json:"description"`
+}
+
+// ErrorCodes describes every code a tool invocation can fail with. It is published alongside the tool schema.
+var ErrorCodes = []ErrorCodeInfo{
+	{CodeInvalidArguments, http.StatusBadRequest, "The arguments do not match the tool's parameters. Fix them and call the tool again."},
+	{CodeNotFound, http.StatusNotFound, "No tool or job with the given name or ID exists."},
+	{CodeTimeout, http.StatusGatewayTimeout, "The tool did not finish in time."},
+	{CodeCanceled, http.StatusGone, "The tool call was canceled before it finished."},
+	{CodePending, http.StatusConflict, "The async tool job has not finished yet. Poll it again later."},
+	{CodeDenied, http.StatusForbidden, "The tool refused to perform the requested action."},
+	{CodeConflict, http.StatusPreconditionFailed, "Files changed since the tool last read them. Read them again and retry."},
+	{CodeToolFailed, http.StatusUnprocessableEntity, "The tool ran but reported an error."},
+	{CodeInternal, http.StatusInternalServerError, "The tool server failed unexpectedly."},
+}
+
+// Status returns the HTTP status code a response carrying c should be sent with.
+func (c ErrorCode) Status() int {
+	for _, info := range ErrorCodes {
+		if info.Code == c {
+			return info.Status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is returned by tools that want to control how their failure is reported.
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Details any       `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf creates an *Error with the given code and formatted message.
+func Errorf(code ErrorCode, format string, args ...any) *Error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
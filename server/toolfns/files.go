@@ -0,0 +1,127 @@
+package toolfns
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Reads a file from the workspace and returns its contents. Images, like PNG and JPEG files, are returned as images.
+// path: Path of the file, relative to the workspace.
+// [readonly, idempotent]
+func ReadFile(inv *Invocation, path string) (any, error) {
+	data, err := readFile(inv, path)
+	if err != nil {
+		return nil, err
+	}
+	if ct := http.DetectContentType(data); strings.HasPrefix(ct, "image/") {
+		return Parts{TextPart(fmt.Sprintf("%s is an image (%s, %d bytes).", path, ct, len(data))), ImagePart(ct, data)}, nil
+	}
+	return string(data), nil
+}
+
+// Writes a file in the workspace, creating it and its parent directories if needed and replacing it if it exists.
+// path: Path of the file, relative to the workspace.
+// content: The complete new contents of the file.
+// [destructive, idempotent, dryrun]
+func WriteFile(inv *Invocation, path, content string) (string, error) {
+	before, err := os.ReadFile(inv.Path(path))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	if inv.DryRun {
+		return preview(path, string(before), content), nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(inv.Path(path)), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(inv.Path(path), []byte(content), 0o644); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Wrote %d bytes to %s.", len(content), path), nil
+}
+
+// Edits a file in the workspace by replacing an exact piece of its text. Read the file first, and include enough
+// surrounding lines in old_text to make it unique.
+// path: Path of the file, relative to the workspace.
+// old_text: The text to replace. It must occur exactly once in the file.
+// new_text: The text to replace it with.
+// [destructive, dryrun]
+func EditFile(inv *Invocation, path, old_text, new_text string) (string, error) {
+	data, err := readFile(inv, path)
+	if err != nil {
+		return "", err
+	}
+	before := string(data)
+
+	switch n := strings.Count(before, old_text); {
+	case old_text == "" || n == 0:
+		return "", Errorf(CodeInvalidArguments, "old_text does not occur in %s", path)
+	case n > 1:
+		return "", Errorf(CodeInvalidArguments, "old_text occurs %d times in %s, include more of the surrounding text", n, path)
+	}
+	after := strings.Replace(before, old_text, new_text, 1)
+	if inv.DryRun {
+		return preview(path, before, after), nil
+	}
+
+	if err := os.WriteFile(inv.Path(path), []byte(after), 0o644); err != nil {
+		return "", err
+	}
+	return Diff(path, before, after), nil
+}
+
+// Deletes a file from the workspace.
+// path: Path of the file, relative to the workspace.
+// [destructive, dryrun]
+func DeleteFile(inv *Invocation, path string) (string, error) {
+	data, err := readFile(inv, path)
+	if err != nil {
+		return "", err
+	}
+	if inv.DryRun {
+		return preview(path, string(data), ""), nil
+	}
+
+	if err := os.Remove(inv.Path(path)); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Deleted %s.", path), nil
+}
+
+// Shares a file from the workspace with the user as a link they can open or download, e.g. a build, a report or a
+// screenshot. Sharing the same file again returns the same link.
+// path: Path of the file, relative to the workspace.
+// [dryrun]
+func ShareFile(inv *Invocation, path string) (any, error) {
+	data, err := readFile(inv, path)
+	if err != nil {
+		return nil, err
+	}
+	if inv.DryRun {
+		return fmt.Sprintf("Dry run: nothing was shared. %s (%d bytes) would be shared.", path, len(data)), nil
+	}
+	ct := mime.TypeByExtension(filepath.Ext(path))
+	if ct == "" {
+		ct = http.DetectContentType(data)
+	}
+	part, err := inv.SaveArtifact(filepath.Base(path), ct, data)
+	if err != nil {
+		return nil, err
+	}
+	return Parts{part}, nil
+}
+
+func readFile(inv *Invocation, path string) ([]byte, error) {
+	data, err := os.ReadFile(inv.Path(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Errorf(CodeNotFound, "file not found: %s", path)
+	}
+	return data, err
+}
@@ -1,4 +1,4 @@
-// generated @ 2025-03-08T22:54:18+02:00 by gendoc
+// generated @ 2026-10-19T14:09:33Z by gendoc
 package toolfns
 
 import "github.com/noonien/codoc"
@@ -7,8 +7,226 @@ func init() {
 	codoc.Register(codoc.Package{
 		ID:   "github.com/zakkor/server/toolfns",
 		Name: "toolfns",
-		Doc:  "generated @ 2025-03-08T22:54:11+02:00 by gendoc",
+		Doc:  "generated @ 2026-10-19T14:08:00Z by gendoc",
 		Functions: map[string]codoc.Function{
+			"ApplyReplace": {
+				Name: "ApplyReplace",
+				Doc:  "Applies the hunks of a replacement planned by PreviewReplace, all at once: if a file cannot be written, or changed\nsince the preview, nothing is changed. Returns the diff of the changes.\nid: The ID of the preview.\nhunks: The IDs of the hunks to apply. Leave it out to apply every hunk. [optional]\n[destructive, dryrun]",
+				Args: []string{
+					"inv",
+					"id",
+					"hunks",
+				},
+			},
+			"DeleteFile": {
+				Name: "DeleteFile",
+				Doc:  "Deletes a file from the workspace.\npath: Path of the file, relative to the workspace.\n[destructive, dryrun]",
+				Args: []string{
+					"inv",
+					"path",
+				},
+			},
+			"Diff": {
+				Name: "Diff",
+				Doc:  "Diff returns a unified diff that turns before into after, using path as the name of both sides. It is empty when\nthey are equal.",
+				Args: []string{
+					"path",
+					"before",
+					"after",
+				},
+			},
+			"EditFile": {
+				Name: "EditFile",
+				Doc:  "Edits a file in the workspace by replacing an exact piece of its text. Read the file first, and include enough\nsurrounding lines in old_text to make it unique.\npath: Path of the file, relative to the workspace.\nold_text: The text to replace. It must occur exactly once in the file.\nnew_text: The text to replace it with.\n[destructive, dryrun]",
+				Args: []string{
+					"inv",
+					"path",
+					"old_text",
+					"new_text",
+				},
+			},
+			"Errorf": {
+				Name: "Errorf",
+				Doc:  "Errorf creates an *Error with the given code and formatted message.",
+				Args: []string{
+					"code",
+					"format",
+					"args",
+				},
+			},
+			"FilePart": {
+				Name: "FilePart",
+				Doc:  "FilePart references a file the client can download, rather than including its content.",
+				Args: []string{
+					"name",
+					"contentType",
+					"url",
+				},
+			},
+			"FindFiles": {
+				Name: "FindFiles",
+				Doc:  "Finds files in the workspace whose path fuzzily matches a query, best matches first. The characters of the query\nmust appear in the path in order, but not next to each other, so \"srvmain\" finds server/main.go.\nquery: Part of the path or name of the file. Words separated by spaces must all match.\nlimit: How many paths to return at most. [optional, default=20, min=1, max=200]\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+					"query",
+					"limit",
+				},
+			},
+			"FormatFiles": {
+				Name: "FormatFiles",
+				Doc:  "Formats Go files with gofmt, and returns the diff of the changes.\nfiles: The files or directories to format, relative to the workspace. Directories are formatted recursively, skipping the files .gitignore ignores.\n[destructive, idempotent, dryrun]",
+				Args: []string{
+					"inv",
+					"files",
+				},
+			},
+			"GitBlame": {
+				Name: "GitBlame",
+				Doc:  "Returns the commit that last changed each line of a file.\npath: Path of the file, relative to the workspace.\nstart: The first line to return. [optional, default=1, min=1]\nend: The last line to return. At most 500 lines are returned at a time. [optional, min=1]\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+					"path",
+					"start",
+					"end",
+				},
+			},
+			"GitBranch": {
+				Name: "GitBranch",
+				Doc:  "Lists the local branches, or creates or deletes one.\nname: The branch to create or delete. Leave it out to list the branches. [optional]\nstart: The commit the new branch starts at. [optional, default=HEAD]\ndelete: Delete the branch instead of creating it. [optional]\nforce: Delete the branch even if it is not merged, or move an existing branch to start. This rewrites history, which the server may forbid. [optional]\n[destructive, dryrun]",
+				Args: []string{
+					"inv",
+					"name",
+					"start",
+					"delete",
+					"force",
+				},
+			},
+			"GitCheckout": {
+				Name: "GitCheckout",
+				Doc:  "Switches the workspace to a branch, tag or commit, keeping uncommitted changes. Returns the status afterwards.\nref: The branch, tag or commit to check out.\ncreate: Create ref as a new branch at the current commit and switch to it. [optional]\n[destructive, dryrun]",
+				Args: []string{
+					"inv",
+					"ref",
+					"create",
+				},
+			},
+			"GitCommit": {
+				Name: "GitCommit",
+				Doc:  "Commits the changes to the given files, and nothing else. Untracked files are added and deleted files removed.\nmessage: The commit message.\nfiles: The changed files to commit, one by one, relative to the workspace.\n[destructive, dryrun]",
+				Args: []string{
+					"inv",
+					"message",
+					"files",
+				},
+			},
+			"GitDiff": {
+				Name: "GitDiff",
+				Doc:  "Returns the uncommitted changes of the workspace's git repository, file by file.\npaths: Only show the changes of these files or directories. [optional]\nstaged: Show the staged changes instead of the unstaged ones. [optional]\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+					"paths",
+					"staged",
+				},
+			},
+			"GitLog": {
+				Name: "GitLog",
+				Doc:  "Returns the commits of a branch, newest first.\nref: The branch, tag or commit to start from. [optional, default=HEAD]\npath: Only list the commits that changed this file or directory. [optional]\nlimit: How many commits to return at most. [optional, default=20, min=1, max=200]\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+					"ref",
+					"path",
+					"limit",
+				},
+			},
+			"GitShow": {
+				Name: "GitShow",
+				Doc:  "Returns a commit and the changes it made.\nref: The commit, branch or tag to show. [optional, default=HEAD]\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+					"ref",
+				},
+			},
+			"GitStash": {
+				Name: "GitStash",
+				Doc:  "Saves the uncommitted changes away and restores them later. Returns the stashes afterwards, newest first.\naction: push saves the changes and reverts the workspace to the last commit, pop and apply restore a stash, with pop also dropping it, and drop deletes one. [optional, default=list, enum=list|push|pop|apply|drop]\nmessage: Describes the stash to push. [optional]\nindex: The stash to pop, apply or drop, 0 being the newest. [optional, default=0, min=0]\n[destructive, dryrun]",
+				Args: []string{
+					"inv",
+					"action",
+					"message",
+					"index",
+				},
+			},
+			"GitStatus": {
+				Name: "GitStatus",
+				Doc:  "Returns the current branch and the files with staged, unstaged or untracked changes in the workspace's git\nrepository.\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+				},
+			},
+			"GoDoc": {
+				Name: "GoDoc",
+				Doc:  "Looks up the documentation of a Go package or symbol, as the Go module in the workspace resolves it: the standard\nlibrary, the module's own packages, and the versions of its dependencies that go.mod requires, from the local module\ncache. Works offline. Returns the doc comment and signature of a symbol, and the method set of a type. For a package,\nlists its exported API. Check it before calling APIs you are not sure about.\nname: A package, or a symbol in one, e.g. \"net/http\", \"net/http.Client\", \"net/http.Client.Do\" or \"./internal/store.Open\".\ndir: The directory of the Go module, relative to the workspace. [optional, default=.]\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+					"name",
+					"dir",
+				},
+			},
+			"HTMLPart": {
+				Name: "HTMLPart",
+				Args: []string{
+					"html",
+				},
+			},
+			"ImagePart": {
+				Name: "ImagePart",
+				Doc:  "ImagePart inlines an image as a data URL.",
+				Args: []string{
+					"contentType",
+					"data",
+				},
+			},
+			"ImageURLPart": {
+				Name: "ImageURLPart",
+				Args: []string{
+					"contentType",
+					"url",
+				},
+			},
+			"JSONPart": {
+				Name: "JSONPart",
+				Args: []string{
+					"v",
+				},
+			},
+			"Lint": {
+				Name: "Lint",
+				Doc:  "Checks files for problems, and returns them with their file, line and column. Go files are checked with gofmt and\ngo vet, and files of other languages with the linters the server is configured with. Also returns the diff that\nformats the Go files that are not formatted.\nfiles: The files or directories to check, relative to the workspace. Directories are checked recursively, skipping the files .gitignore ignores.\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+					"files",
+				},
+			},
+			"ListProcesses": {
+				Name: "ListProcesses",
+				Doc:  "Lists the background processes of the chat, including the ones that exited.\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+				},
+			},
+			"LoadLinters": {
+				Name: "LoadLinters",
+				Doc:  "LoadLinters reads the linters Lint runs from a JSON file holding a list of Linter.",
+				Args: []string{
+					"path",
+				},
+			},
+			"MarkdownPart": {
+				Name: "MarkdownPart",
+				Args: []string{
+					"md",
+				},
+			},
 			"NewGroup": {
 				Name: "NewGroup",
 				Args: []string{
@@ -16,23 +234,1532 @@ func init() {
 					"fns",
 				},
 			},
+			"NewInvocation": {
+				Name: "NewInvocation",
+				Args: []string{
+					"ctx",
+				},
+			},
+			"PreviewPart": {
+				Name: "PreviewPart",
+				Doc:  "PreviewPart references a web page the client can open in an iframe.",
+				Args: []string{
+					"name",
+					"url",
+				},
+			},
+			"PreviewReplace": {
+				Name: "PreviewReplace",
+				Doc:  "Plans replacing a regex or literal across the files of the workspace, without changing anything. Returns every\nreplacement as a hunk with an ID and a diff. Pass the preview's ID to ApplyReplace, with the IDs of the hunks to\napply. Files ignored by .gitignore and binary files are skipped.\npattern: The regular expression to replace, in Go syntax, or the text to replace if literal is set.\nreplacement: The text to replace every match with. Unless literal is set, $1 or ${name} insert the groups of the match.\nliteral: Replace pattern as plain text. [optional]\nignore_case: Match upper and lower case letters alike. [optional]\ninclude: Only change the files that match one of these globs, e.g. \"*.go\" or \"src/**/*.ts\". [optional]\nexclude: Skip the files and directories that match one of these globs. [optional]\npath: The directory to change files in, relative to the workspace. [optional, default=.]\n[readonly]",
+				Args: []string{
+					"inv",
+					"pattern",
+					"replacement",
+					"literal",
+					"ignore_case",
+					"include",
+					"exclude",
+					"path",
+				},
+			},
+			"PreviewURL": {
+				Name: "PreviewURL",
+				Doc:  "Shows the user the web app a background process serves on a local port, next to the conversation, and returns\nits URL. The user can open it from another device, unlike localhost URLs. Only ports a process started with\nStartProcess listens on can be previewed, and the URL expires after an hour.\nport: The port the web server listens on. [min=1, max=65535, example=5173]\npath: The page to open. [optional, default=/]\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+					"port",
+					"path",
+				},
+			},
+			"ReadFile": {
+				Name: "ReadFile",
+				Doc:  "Reads a file from the workspace and returns its contents. Images, like PNG and JPEG files, are returned as images.\npath: Path of the file, relative to the workspace.\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+					"path",
+				},
+			},
+			"ReadProcessOutput": {
+				Name: "ReadProcessOutput",
+				Doc:  "Returns the output of a background process from an offset on, and whether it is still running.\nid: The handle StartProcess returned.\noffset: Where to read from: the next_offset of the previous read to get only the new output, or 0 for the whole log. [optional, default=0, min=0]\n[readonly]",
+				Args: []string{
+					"inv",
+					"id",
+					"offset",
+				},
+			},
+			"RunTests": {
+				Name: "RunTests",
+				Doc:  "Runs the tests of the project in the workspace and returns how many passed, failed and were skipped, with the\noutput of every failure. Prefer it over running tests with Shell, whose output is much longer. Supports Go,\nJest and pytest, and detects which one the project uses.\npath: The directory of the project, relative to the workspace. [optional, default=.]\ntests: The Go packages, or test files and directories, to run, relative to path, e.g. \"./server/...\" or \"tests/test_api.py\". All tests run by default. [optional]\nrun: Only run the tests whose names match: a regex for Go and Jest, a -k expression for pytest. [optional]\nframework: The test framework of the project. [optional, default=auto, enum=auto|go|jest|pytest]\ntimeout: How many seconds the tests can run for. [optional, default=600, min=1, max=3600]\n[destructive, network, dryrun]",
+				Args: []string{
+					"inv",
+					"path",
+					"tests",
+					"run",
+					"framework",
+					"timeout",
+				},
+			},
+			"Search": {
+				Name: "Search",
+				Doc:  "Searches the contents of the files in the workspace, and returns the matching lines grouped by file. Files ignored\nby .gitignore, the .git directory and binary files are skipped. Prefer it over grep, which searches everything.\npattern: The regular expression to search for, in Go syntax, or the text to search for if literal is set.\nliteral: Search for pattern as plain text. [optional]\nignore_case: Match upper and lower case letters alike. [optional]\ninclude: Only search the files that match one of these globs, e.g. \"*.go\" or \"src/**/*.ts\". [optional]\nexclude: Skip the files and directories that match one of these globs. [optional]\npath: The directory to search, relative to the workspace. [optional, default=.]\ncontext_lines: How many lines around every match to return. [optional, default=2, min=0, max=10]\nmax_matches: How many matching lines to return at most. [optional, default=100, min=1, max=1000]\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+					"pattern",
+					"literal",
+					"ignore_case",
+					"include",
+					"exclude",
+					"path",
+					"context_lines",
+					"max_matches",
+				},
+			},
+			"SearchDocs": {
+				Name: "SearchDocs",
+				Doc:  "Searches the documents the tool server indexes, like design docs, runbooks and PDFs, and returns the passages\nthat match the query best, best first, with their file and lines. Cite the passages you use by file and line.\nquery: The words to search for.\nlimit: How many passages to return at most. [optional, default=5, min=1, max=20]\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+					"query",
+					"limit",
+				},
+			},
+			"SemanticSearch": {
+				Name: "SemanticSearch",
+				Doc:  "Searches the indexed documents like SearchDocs, but also finds passages that say what the query means in other\nwords. Passages are ranked by fusing their keyword ranking with their ranking by embedding similarity to the query.\nWarnings tell when passages could only be ranked by keyword, e.g. because they are still being embedded. Prefer it\nover SearchDocs when you do not know the terms the documents use.\nquery: What to search for, as words or a question.\nlimit: How many passages to return at most. [optional, default=5, min=1, max=20]\n[readonly, idempotent, network]",
+				Args: []string{
+					"inv",
+					"query",
+					"limit",
+				},
+			},
+			"SendInput": {
+				Name: "SendInput",
+				Doc:  "Writes to the standard input of a background process.\nid: The handle StartProcess returned.\ninput: The text to write. Include a trailing newline to submit a line.\n[destructive, dryrun]",
+				Args: []string{
+					"inv",
+					"id",
+					"input",
+				},
+			},
+			"ShareFile": {
+				Name: "ShareFile",
+				Doc:  "Shares a file from the workspace with the user as a link they can open or download, e.g. a build, a report or a\nscreenshot. Sharing the same file again returns the same link.\npath: Path of the file, relative to the workspace.\n[dryrun]",
+				Args: []string{
+					"inv",
+					"path",
+				},
+			},
 			"Shell": {
 				Name: "Shell",
-				Doc:  "Executes the given bash command and returns the output of the command.\ncommand: The bash command to execute.",
+				Doc:  "Executes the given bash command and returns the output of the command. The command gets no input, so use the\nterminal tools for interactive commands.\ncommand: The bash command to execute.\n[destructive, network, dryrun]",
 				Args: []string{
+					"inv",
 					"command",
 				},
 			},
+			"StartProcess": {
+				Name: "StartProcess",
+				Doc:  "Starts a bash command in the background of the workspace and returns its handle, along with its first output.\nUse it for commands that keep running, like dev servers and watchers, which Shell would wait for forever.\ncommand: The bash command to start.\n[destructive, network, dryrun]",
+				Args: []string{
+					"inv",
+					"command",
+				},
+			},
+			"StopProcess": {
+				Name: "StopProcess",
+				Doc:  "Stops a background process and everything it started, and forgets its handle.\nid: The handle StartProcess returned.\n[destructive, dryrun]",
+				Args: []string{
+					"inv",
+					"id",
+				},
+			},
+			"TerminalScreen": {
+				Name: "TerminalScreen",
+				Doc:  "Returns what the chat's terminal currently displays.\n[readonly, idempotent]",
+				Args: []string{
+					"inv",
+				},
+			},
+			"TerminalSendKeys": {
+				Name: "TerminalSendKeys",
+				Doc:  "Types keys into the chat's terminal and returns its screen once the output settles. Unlike Shell, the terminal\nkeeps running between calls and the user can watch it, so use it for interactive programs like REPLs, editors,\nTUIs or git rebase.\nkeys: The text to type. Special keys are written in angle brackets: <Enter>, <Tab>, <Esc>, <Backspace>, <Delete>, <Up>, <Down>, <Left>, <Right>, <Home>, <End>, <PageUp>, <PageDown>, and Ctrl combinations like <C-c>. [example=\"ls -la<Enter>\"]\nwait: How many seconds to wait for the output to settle at most. [optional, default=5, min=0, max=60]\n[destructive, dryrun]",
+				Args: []string{
+					"inv",
+					"keys",
+					"wait",
+				},
+			},
+			"TestAnnotateFunction": {
+				Name: "TestAnnotateFunction",
+				Args: []string{
+					"t",
+				},
+			},
+			"TestFindLocation": {
+				Name: "TestFindLocation",
+				Args: []string{
+					"t",
+				},
+			},
+			"TestFuzzyScore": {
+				Name: "TestFuzzyScore",
+				Args: []string{
+					"t",
+				},
+			},
+			"TestGoTestEvents": {
+				Name: "TestGoTestEvents",
+				Args: []string{
+					"t",
+				},
+			},
+			"TestParseJestReport": {
+				Name: "TestParseJestReport",
+				Args: []string{
+					"t",
+				},
+			},
+			"TestParsePytestReport": {
+				Name: "TestParsePytestReport",
+				Args: []string{
+					"t",
+				},
+			},
+			"TestParseShell": {
+				Name: "TestParseShell",
+				Args: []string{
+					"t",
+				},
+			},
+			"TestSearchKeepsFirstFiles": {
+				Name: "TestSearchKeepsFirstFiles",
+				Args: []string{
+					"t",
+				},
+			},
+			"TestShellCommandWarnings": {
+				Name: "TestShellCommandWarnings",
+				Args: []string{
+					"t",
+				},
+			},
+			"TestTail": {
+				Name: "TestTail",
+				Args: []string{
+					"t",
+				},
+			},
+			"TestValidate": {
+				Name: "TestValidate",
+				Args: []string{
+					"t",
+				},
+			},
+			"TestWalkFilesRecoversPanics": {
+				Name: "TestWalkFilesRecoversPanics",
+				Args: []string{
+					"t",
+				},
+			},
+			"TextPart": {
+				Name: "TextPart",
+				Args: []string{
+					"text",
+				},
+			},
+			"WriteFile": {
+				Name: "WriteFile",
+				Doc:  "Writes a file in the workspace, creating it and its parent directories if needed and replacing it if it exists.\npath: Path of the file, relative to the workspace.\ncontent: The complete new contents of the file.\n[destructive, idempotent, dryrun]",
+				Args: []string{
+					"inv",
+					"path",
+					"content",
+				},
+			},
+			"annotateFunction": {
+				Name: "annotateFunction",
+				Doc:  "annotateFunction applies the annotations found in the doc comment of fn to its schema f.",
+				Args: []string{
+					"f",
+					"fn",
+				},
+			},
+			"annotateType": {
+				Name: "annotateType",
+				Doc:  "annotateType applies the field comments and tags of the structs reachable from t to def.",
+				Args: []string{
+					"def",
+					"t",
+				},
+			},
+			"annotationValue": {
+				Name: "annotationValue",
+				Doc:  "annotationValue interprets val as JSON, falling back to a plain string.",
+				Args: []string{
+					"val",
+				},
+			},
+			"appendComments": {
+				Name: "appendComments",
+				Args: []string{
+					"list",
+					"groups",
+				},
+			},
+			"argBatches": {
+				Name: "argBatches",
+				Doc:  "argBatches splits args into batches that each fit on a command line.",
+				Args: []string{
+					"args",
+				},
+			},
+			"changedFile": {
+				Name: "changedFile",
+				Args: []string{
+					"xy",
+					"path",
+					"origPath",
+				},
+			},
+			"checkRefs": {
+				Name: "checkRefs",
+				Doc:  "checkRefs refuses refs that git would take for options.",
+				Args: []string{
+					"refs",
+				},
+			},
+			"checkReport": {
+				Name: "checkReport",
+				Args: []string{
+					"t",
+					"res",
+					"failures",
+					"want",
+					"wantFailures",
+				},
+			},
+			"coerce": {
+				Name: "coerce",
+				Doc:  "coerce converts strings to the numbers or booleans t expects, returning val unchanged if that is not possible.",
+				Args: []string{
+					"t",
+					"val",
+				},
+			},
+			"commandLine": {
+				Name: "commandLine",
+				Doc:  "commandLine formats args the way they would be typed in a shell.",
+				Args: []string{
+					"args",
+				},
+			},
+			"compileGlob": {
+				Name: "compileGlob",
+				Doc:  "compileGlob compiles a pattern with the semantics of .gitignore: a pattern without a slash matches a name at any\ndepth, other patterns are relative to the directory they are defined in, and ** matches any number of directories.",
+				Args: []string{
+					"pattern",
+				},
+			},
+			"compilePattern": {
+				Name: "compilePattern",
+				Doc:  "compilePattern compiles the pattern of a search, in which ^ and $ match at line breaks.",
+				Args: []string{
+					"pattern",
+					"literal",
+					"ignoreCase",
+				},
+			},
+			"detectTestFrameworks": {
+				Name: "detectTestFrameworks",
+				Doc:  "detectTestFrameworks returns the test frameworks the project in dir is set up for.",
+				Args: []string{
+					"dir",
+				},
+			},
+			"diffLines": {
+				Name: "diffLines",
+				Doc:  "diffLines returns the operations that turn a into b, based on their longest common subsequence.",
+				Args: []string{
+					"a",
+					"b",
+				},
+			},
+			"fieldName": {
+				Name: "fieldName",
+				Doc:  "fieldName returns the name llum-tools gives to a struct field.",
+				Args: []string{
+					"f",
+				},
+			},
+			"findLocation": {
+				Name: "findLocation",
+				Doc:  "findLocation returns the first file:line in output that re matches and that is in root, skipping installed\ndependencies. Relative paths are resolved against dir. pytest reports the location of the failure last.",
+				Args: []string{
+					"output",
+					"re",
+					"dir",
+					"root",
+				},
+			},
+			"firstFiles": {
+				Name: "firstFiles",
+				Doc:  "firstFiles sorts files by path and keeps the first ones, up to the one that brings their matches over\nmaxMatches. cutoff is the path of that file, if there is one.",
+				Args: []string{
+					"files",
+					"maxMatches",
+				},
+				Results: []string{
+					"kept",
+					"cutoff",
+				},
+			},
+			"float": {
+				Name: "float",
+				Args: []string{
+					"f",
+				},
+			},
+			"fromSchemaDefinition": {
+				Name: "fromSchemaDefinition",
+				Args: []string{
+					"d",
+				},
+			},
+			"fromSchemaFunction": {
+				Name: "fromSchemaFunction",
+				Args: []string{
+					"fn",
+				},
+			},
+			"fuzzyScore": {
+				Name: "fuzzyScore",
+				Doc:  "fuzzyScore scores how well path matches query, which must be lower case. Matches at the start of a word, in the\nfile name and next to each other score higher, and gaps between matches and long paths lower.",
+				Args: []string{
+					"query",
+					"path",
+				},
+			},
+			"gitPaths": {
+				Name: "gitPaths",
+				Doc:  "gitPaths resolves paths like Invocation.Path, but relative to the workspace, which git runs in.",
+				Args: []string{
+					"paths",
+				},
+			},
+			"goVet": {
+				Name: "goVet",
+				Doc:  "goVet runs go vet on the packages of files, in the modules they belong to, and returns the problems it reports in\nfiles.",
+				Args: []string{
+					"inv",
+					"files",
+				},
+			},
+			"gofmtFile": {
+				Name: "gofmtFile",
+				Doc:  "gofmtFile checks that the Go file at rel is formatted. A file that does not parse is reported with its syntax\nerrors, and a file that is not formatted with the diff that formats it.",
+				Args: []string{
+					"inv",
+					"rel",
+				},
+			},
 			"init": {
 				Name: "init",
 			},
+			"isDigits": {
+				Name: "isDigits",
+				Args: []string{
+					"s",
+				},
+			},
+			"joinPath": {
+				Name: "joinPath",
+				Args: []string{
+					"path",
+					"name",
+				},
+			},
+			"jsonType": {
+				Name: "jsonType",
+				Args: []string{
+					"val",
+				},
+			},
+			"lintPaths": {
+				Name: "lintPaths",
+				Doc:  "lintPaths expands files, which may include directories, to the paths of the files, relative to the workspace.",
+				Args: []string{
+					"inv",
+					"files",
+				},
+			},
+			"loadIgnoreRules": {
+				Name: "loadIgnoreRules",
+				Doc:  "loadIgnoreRules reads the .gitignore file of dir, whose path relative to the root is rel.",
+				Args: []string{
+					"parent",
+					"dir",
+					"rel",
+				},
+			},
+			"moduleRoot": {
+				Name: "moduleRoot",
+				Doc:  "moduleRoot returns the closest directory at or above dir, relative to the workspace, that has a go.mod file.",
+				Args: []string{
+					"workspace",
+					"dir",
+				},
+			},
+			"newGoTestEvents": {
+				Name: "newGoTestEvents",
+				Args: []string{
+					"out",
+				},
+			},
+			"normalizeSeverity": {
+				Name: "normalizeSeverity",
+				Doc:  "normalizeSeverity maps the severities linters report to error, warning or info.",
+				Args: []string{
+					"s",
+				},
+			},
+			"parseAnnotations": {
+				Name: "parseAnnotations",
+				Doc:  "parseAnnotations parses a comma separated annotation list. It fails if any item is not a known annotation, so\nthat ordinary bracketed text in a description is left alone.",
+				Args: []string{
+					"s",
+				},
+			},
+			"parseBlame": {
+				Name: "parseBlame",
+				Doc:  "parseBlame parses the output of blame --porcelain, which describes a commit only the first time it appears.",
+				Args: []string{
+					"out",
+				},
+			},
+			"parseCommits": {
+				Name: "parseCommits",
+				Args: []string{
+					"out",
+				},
+			},
+			"parseJestReport": {
+				Name: "parseJestReport",
+				Args: []string{
+					"path",
+					"root",
+					"res",
+				},
+			},
+			"parseKeys": {
+				Name: "parseKeys",
+				Doc:  "parseKeys replaces the names of special keys in keys with the bytes a terminal sends for them. Bracketed text that\nis not a key name is typed as is.",
+				Args: []string{
+					"keys",
+				},
+			},
+			"parseNumstat": {
+				Name: "parseNumstat",
+				Doc:  "parseNumstat parses the output of --numstat -z, in which renamed files have an empty path followed by their old\nand new paths.",
+				Args: []string{
+					"out",
+				},
+			},
+			"parsePytestReport": {
+				Name: "parsePytestReport",
+				Args: []string{
+					"path",
+					"dir",
+					"root",
+					"res",
+				},
+			},
+			"parseShell": {
+				Name: "parseShell",
+				Doc:  "parseShell splits a command line into simple commands. It understands quoting, escapes, command separators and\noutput redirects, which is enough to describe a command, but not to run one.",
+				Args: []string{
+					"line",
+				},
+			},
+			"parseToolAnnotations": {
+				Name: "parseToolAnnotations",
+				Doc:  "parseToolAnnotations parses a tool annotation list, failing on unknown items like parseAnnotations.",
+				Args: []string{
+					"s",
+				},
+			},
+			"parseVetOutput": {
+				Name: "parseVetOutput",
+				Doc:  "parseVetOutput parses the JSON findings and the errors in the output of go vet -json, which ran in dir.",
+				Args: []string{
+					"out",
+					"dir",
+					"workspace",
+				},
+			},
+			"preview": {
+				Name: "preview",
+				Doc:  "preview describes the change a dry run would have made to path.",
+				Args: []string{
+					"path",
+					"before",
+					"after",
+				},
+			},
+			"previewShell": {
+				Name: "previewShell",
+				Doc:  "previewShell describes what a dry run of Shell would have run, warning about the parts that look dangerous.",
+				Args: []string{
+					"inv",
+					"command",
+				},
+			},
+			"readFile": {
+				Name: "readFile",
+				Args: []string{
+					"inv",
+					"path",
+				},
+			},
+			"readFixture": {
+				Name: "readFixture",
+				Doc:  "readFixture returns a report from testdata, with the /ROOT the fixtures were captured in replaced by root.",
+				Args: []string{
+					"t",
+					"name",
+					"root",
+				},
+			},
+			"readTextFile": {
+				Name: "readTextFile",
+				Doc:  "readTextFile reads the file at path, unless it is too large to search or binary.",
+				Args: []string{
+					"path",
+				},
+			},
+			"relativeTo": {
+				Name: "relativeTo",
+				Doc:  "relativeTo makes file, which is absolute or relative to dir, relative to the workspace.",
+				Args: []string{
+					"workspace",
+					"dir",
+					"file",
+				},
+			},
+			"searchFile": {
+				Name: "searchFile",
+				Doc:  "searchFile returns the lines of the file at path that match re, with context lines around them. Binary files and\nfiles without matches are not reported.",
+				Args: []string{
+					"path",
+					"re",
+					"contextLines",
+				},
+			},
+			"splitAnnotations": {
+				Name: "splitAnnotations",
+				Doc:  "splitAnnotations separates a trailing annotation list from desc.",
+				Args: []string{
+					"desc",
+				},
+			},
+			"splitLines": {
+				Name: "splitLines",
+				Doc:  "splitLines splits s after every newline, keeping a final line without one.",
+				Args: []string{
+					"s",
+				},
+			},
+			"splitPatches": {
+				Name: "splitPatches",
+				Args: []string{
+					"out",
+				},
+			},
+			"splitPosition": {
+				Name: "splitPosition",
+				Doc:  "splitPosition splits a position like \"file.go:12:5\" into its parts.",
+				Args: []string{
+					"posn",
+				},
+			},
+			"stripANSI": {
+				Name: "stripANSI",
+				Args: []string{
+					"s",
+				},
+			},
+			"tail": {
+				Name: "tail",
+				Doc:  "tail returns the last lines of output.",
+				Args: []string{
+					"output",
+				},
+			},
+			"testCommand": {
+				Name: "testCommand",
+				Doc:  "testCommand returns the command that runs the tests of framework in dir. Frameworks that report their results in\na file write it to report.",
+				Args: []string{
+					"framework",
+					"dir",
+					"report",
+					"tests",
+					"run",
+				},
+			},
+			"testOutput": {
+				Name: "testOutput",
+				Doc:  "testOutput joins the output of a Go test, leaving out the lines go test prints about running it.",
+				Args: []string{
+					"lines",
+				},
+			},
+			"testProject": {
+				Name: "testProject",
+				Doc:  "testProject creates the given files in a temporary directory, since locations are only reported for files that\nexist, and returns it.",
+				Args: []string{
+					"t",
+					"files",
+				},
+			},
+			"testSearch": {
+				Name: "testSearch",
+				Doc:  "Searches.\nquery: The query.\nmore: More queries. [optional]\nall: Return every match. [optional, default=true]\n[readonly, idempotent, cost=low]",
+				Args: []string{
+					"inv",
+					"query",
+					"more",
+					"all",
+				},
+			},
+			"trimFailureOutput": {
+				Name: "trimFailureOutput",
+				Doc:  "trimFailureOutput keeps the start and the end of long failure output, where the message and the location of the\nfailure usually are.",
+				Args: []string{
+					"output",
+				},
+			},
+			"truncateLine": {
+				Name: "truncateLine",
+				Args: []string{
+					"text",
+				},
+			},
+			"truncateUTF8": {
+				Name: "truncateUTF8",
+				Args: []string{
+					"s",
+					"n",
+				},
+			},
+			"vetPackages": {
+				Name: "vetPackages",
+				Doc:  "vetPackages runs go vet on pkgs in the module at dir, and returns the problems it reports.",
+				Args: []string{
+					"inv",
+					"dir",
+					"pkgs",
+				},
+			},
+			"walkFiles": {
+				Name: "walkFiles",
+				Doc:  "walkFiles calls fn for every file under start, a directory of the workspace, that is not ignored by the\n.gitignore files of the workspace, or excluded. Directories are read in parallel, so fn is called concurrently, by\nas many goroutines at a time as there are CPUs. rel is relative to the workspace and uses slashes. The walk stops\nearly when ctx is done, or when fn panics, which is returned as an error.",
+				Args: []string{
+					"ctx",
+					"workspace",
+					"start",
+					"exclude",
+					"fn",
+				},
+			},
+			"writeFilesAtomically": {
+				Name: "writeFilesAtomically",
+				Doc:  "writeFilesAtomically writes every change, or none of them. The new contents are written to temporary files first,\nwhich are then renamed over the originals. If a rename fails, the files that were already replaced are restored.",
+				Args: []string{
+					"changes",
+				},
+			},
+			"writeFixture": {
+				Name: "writeFixture",
+				Args: []string{
+					"t",
+					"name",
+					"root",
+				},
+			},
+			"writeHunk": {
+				Name: "writeHunk",
+				Args: []string{
+					"out",
+					"ops",
+				},
+			},
 		},
 		Structs: map[string]codoc.Struct{
+			"Annotations": {
+				Name: "Annotations",
+				Doc:  "Annotations describe the behavior of a tool, so that clients can decide which calls need approval.",
+			},
+			"BlameLine": {
+				Name: "BlameLine",
+			},
+			"BranchInfo": {
+				Name: "BranchInfo",
+			},
+			"ChangedFile": {
+				Name: "ChangedFile",
+				Doc:  "ChangedFile is a file with uncommitted changes. Staged and Unstaged are added, modified, deleted, renamed, copied,\ntype_changed, unmerged or untracked, or empty when the file has no such change.",
+				Fields: map[string]codoc.Field{
+					"OrigPath": {
+						Doc: "OrigPath is the path a renamed or copied file had.",
+					},
+				},
+			},
+			"CommitDetails": {
+				Name: "CommitDetails",
+			},
+			"CommitInfo": {
+				Name: "CommitInfo",
+			},
 			"ContentTypeResponse": {
 				Name: "ContentTypeResponse",
 			},
+			"Definition": {
+				Name: "Definition",
+				Methods: map[string]codoc.Function{
+					"IsRequired": {
+						Name: "IsRequired",
+						Doc:  "IsRequired reports whether the named property must be present.",
+						Args: []string{
+							"name",
+						},
+					},
+					"Property": {
+						Name: "Property",
+						Doc:  "Property returns the definition of the named property, or nil if there is none.",
+						Args: []string{
+							"name",
+						},
+					},
+					"zero": {
+						Name: "zero",
+						Doc:  "zero returns the value an optional argument without a default receives when it is omitted.",
+					},
+				},
+			},
+			"Diagnostic": {
+				Name: "Diagnostic",
+				Doc:  "Diagnostic is a problem a linter found. File is relative to the workspace, and is empty when the linter failed as a\nwhole.",
+				Fields: map[string]codoc.Field{
+					"Source": {
+						Doc: "Source is the linter that reported the problem.",
+					},
+				},
+			},
+			"EnvSecrets": {
+				Name: "EnvSecrets",
+				Doc:  "EnvSecrets reads secrets from LLUM_SECRET_<NAME> environment variables.",
+				Methods: map[string]codoc.Function{
+					"Secret": {
+						Name: "Secret",
+						Args: []string{
+							"name",
+						},
+					},
+				},
+			},
+			"Error": {
+				Name: "Error",
+				Doc:  "Error is returned by tools that want to control how their failure is reported.",
+				Methods: map[string]codoc.Function{
+					"Error": {
+						Name: "Error",
+					},
+				},
+			},
+			"ErrorCodeInfo": {
+				Name: "ErrorCodeInfo",
+			},
+			"FieldError": {
+				Name: "FieldError",
+				Doc:  "FieldError describes why a single argument of a tool call is invalid.",
+			},
+			"FileDiff": {
+				Name: "FileDiff",
+				Doc:  "FileDiff is the change to one file. Patch is cut short, and Truncated set, once the patches of a result get too\nlarge.",
+			},
+			"FileMatches": {
+				Name: "FileMatches",
+				Methods: map[string]codoc.Function{
+					"limit": {
+						Name: "limit",
+						Doc:  "limit keeps the first n matching lines and their context.",
+						Args: []string{
+							"n",
+							"contextLines",
+						},
+					},
+				},
+			},
+			"FormatDiff": {
+				Name: "FormatDiff",
+			},
+			"Function": {
+				Name: "Function",
+				Doc:  "Function mirrors schema.Function, using a Definition that supports the JSON schema keywords llum-tools does not emit.",
+				Methods: map[string]codoc.Function{
+					"MarshalJSON": {
+						Name: "MarshalJSON",
+						Doc:  "MarshalJSON keeps the annotations next to the function definition rather than inside it, since providers reject\nunknown function fields.",
+					},
+					"Validate": {
+						Name: "Validate",
+						Doc:  "Validate checks args against the parameters of f. If coerce is set, strings holding numbers or booleans are\nconverted to the type the parameter expects. It returns the (possibly coerced) arguments, or an error with code\nCodeInvalidArguments whose details list every invalid field.",
+						Args: []string{
+							"args",
+							"coerce",
+						},
+					},
+				},
+			},
+			"GoDocResult": {
+				Name: "GoDocResult",
+				Fields: map[string]codoc.Field{
+					"Doc": {
+						Doc: "Doc is the doc comment of the package, or its first sentence when a symbol was asked for.",
+					},
+					"Symbol": {
+						Doc: "Symbol is the symbol that was asked for.",
+					},
+					"Symbols": {
+						Doc: "Symbols is the exported API of the package, when no symbol was asked for.",
+					},
+				},
+			},
+			"GoSymbol": {
+				Name: "GoSymbol",
+				Fields: map[string]codoc.Field{
+					"Doc": {
+						Doc: "Doc is the doc comment of the symbol. Symbols that are listed only get its first sentence.",
+					},
+					"Funcs": {
+						Doc: "Funcs are the functions that return the type, e.g. its constructors.",
+					},
+					"Kind": {
+						Doc: "Kind is const, var, func, type, method or field.",
+					},
+					"Methods": {
+						Doc: "Methods is the method set of the type, including the methods of the types it embeds.",
+					},
+				},
+			},
 			"Group": {
 				Name: "Group",
+				Methods: map[string]codoc.Function{
+					"Describe": {
+						Name: "Describe",
+						Doc:  "Describe sets the description of the group and the name of the feather icon clients display for it.",
+						Args: []string{
+							"description",
+							"icon",
+						},
+					},
+					"Function": {
+						Name: "Function",
+						Doc:  "Function returns the schema of the named tool, or nil if the group does not contain it.",
+						Args: []string{
+							"name",
+						},
+					},
+					"Invoke": {
+						Name: "Invoke",
+						Doc:  "Invoke calls the named tool of the group on behalf of inv.",
+						Args: []string{
+							"inv",
+							"name",
+							"args",
+						},
+					},
+				},
+			},
+			"Invocation": {
+				Name: "Invocation",
+				Doc:  "Invocation describes the tool call being served. Tool functions that need it declare it as their first parameter,\nwhich keeps it out of the schema the model sees.",
+				Fields: map[string]codoc.Field{
+					"AllowGitRewrites": {
+						Doc: "AllowGitRewrites lets tools force-push and rewrite the history of git repositories.",
+					},
+					"Docs": {
+						Doc: "Docs is the index SearchDocs searches, if the server indexes documents.",
+					},
+					"DryRun": {
+						Doc: "DryRun asks the tool to describe what it would change instead of changing it. Tools that honour it are\nannotated with dryrun.",
+					},
+					"Linters": {
+						Doc: "Linters are the external linters Lint runs.",
+					},
+					"Progress": {
+						Doc: "Progress receives partial output, which async jobs report while the tool is still running.",
+					},
+					"Workspace": {
+						Doc: "Workspace is the directory tools should read and write files in.",
+					},
+				},
+				Methods: map[string]codoc.Function{
+					"Context": {
+						Name: "Context",
+						Doc:  "Context is canceled when the caller no longer wants the result, e.g. when an async job is canceled.",
+					},
+					"Path": {
+						Name: "Path",
+						Doc:  "Path resolves name relative to the workspace. Absolute names and names with .. elements stay inside it.",
+						Args: []string{
+							"name",
+						},
+					},
+					"SaveArtifact": {
+						Name: "SaveArtifact",
+						Doc:  "SaveArtifact stores a file produced by the tool and returns a part referencing it, which the client can display.",
+						Args: []string{
+							"name",
+							"contentType",
+							"data",
+						},
+					},
+					"Terminal": {
+						Name: "Terminal",
+						Doc:  "Terminal returns the chat's terminal, starting a shell in the workspace if it has none.",
+					},
+					"checkGitRewrite": {
+						Name: "checkGitRewrite",
+						Doc:  "checkGitRewrite refuses command if it force-pushes or rewrites git history, unless the server allows it. It only\nsees the git commands written out in command, not those run by scripts, aliases, bash -c or eval, so it keeps a\nmodel from rewriting history by mistake rather than on purpose.",
+						Args: []string{
+							"command",
+						},
+					},
+					"findGoPackage": {
+						Name: "findGoPackage",
+						Doc:  "findGoPackage resolves name, a package path that may be followed by a symbol, with go list in the module in dir.\nThe longest prefix of name that is a package wins, since package paths can contain dots too, e.g. gopkg.in/yaml.v3.",
+						Args: []string{
+							"dir",
+							"name",
+						},
+					},
+					"git": {
+						Name: "git",
+						Doc:  "git runs git in the workspace and returns its output. Failures carry what git printed.",
+						Args: []string{
+							"args",
+						},
+					},
+					"gitDiff": {
+						Name: "gitDiff",
+						Doc:  "gitDiff runs a git command that prints a diff, like diff or show, and splits its output by file.",
+						Args: []string{
+							"args",
+							"paths",
+						},
+					},
+					"gitShow": {
+						Name: "gitShow",
+						Args: []string{
+							"ref",
+						},
+					},
+					"gitStatus": {
+						Name: "gitStatus",
+					},
+					"injector": {
+						Name: "injector",
+						Doc:  "injector tells llum-tools which parameters are provided by the server rather than by the model.",
+					},
+					"process": {
+						Name: "process",
+						Args: []string{
+							"id",
+						},
+					},
+					"processes": {
+						Name: "processes",
+					},
+				},
+			},
+			"LintReport": {
+				Name: "LintReport",
+				Fields: map[string]codoc.Field{
+					"Formatting": {
+						Doc: "Formatting holds the diff that formats every file that is not formatted, which FormatFiles applies.",
+					},
+					"Linters": {
+						Doc: "Linters are the linters that checked the files.",
+					},
+				},
+			},
+			"Linter": {
+				Name: "Linter",
+				Doc:  "Linter is an external linter Lint runs, configured with the -linters flag of the server.",
+				Fields: map[string]codoc.Field{
+					"Command": {
+						Doc: "Command runs the linter, in the workspace, with the paths of the files to check appended.",
+					},
+					"Extensions": {
+						Doc: "Extensions are the extensions of the files the linter checks, e.g. \".py\". It checks every file if empty.",
+					},
+					"Pattern": {
+						Doc: "Pattern matches a problem in the output of the linter, with the named groups file, line, col, severity, message\nand rule. The default matches lines like \"file:line:col: severity: message [rule]\", which most linters can print.",
+					},
+					"Secrets": {
+						Doc: "Secrets are the names of secrets the linter needs, e.g. a license key. Each is passed in the environment\nvariable of its name in upper case.",
+					},
+					"Severity": {
+						Doc: "Severity is the severity of problems whose severity the output does not include.",
+					},
+				},
+				Methods: map[string]codoc.Function{
+					"run": {
+						Name: "run",
+						Doc:  "run runs the linter on files, and returns the problems it reports. Long lists of files are split across runs, so\nthat they fit on the command line.",
+						Args: []string{
+							"inv",
+							"files",
+						},
+					},
+					"runBatch": {
+						Name: "runBatch",
+						Doc:  "runBatch runs the linter once on files.",
+						Args: []string{
+							"inv",
+							"files",
+						},
+					},
+				},
+			},
+			"Part": {
+				Name: "Part",
+				Doc:  "Part is one piece of a rich tool result.",
+				Fields: map[string]codoc.Field{
+					"Content": {
+						Doc: "Content is the text, markdown or HTML of the part, or a data URL for inline images.",
+					},
+				},
+				Methods: map[string]codoc.Function{
+					"fallback": {
+						Name: "fallback",
+						Doc:  "fallback describes the part in plain text, for models that cannot take it as is.",
+					},
+				},
+			},
+			"Property": {
+				Name: "Property",
+			},
+			"ReplaceFile": {
+				Name: "ReplaceFile",
+			},
+			"ReplaceHunk": {
+				Name: "ReplaceHunk",
+				Doc:  "ReplaceHunk is a single replacement. Diff shows the lines of the match before and after it.",
+			},
+			"ReplacePreview": {
+				Name: "ReplacePreview",
+				Fields: map[string]codoc.Field{
+					"ID": {
+						Doc: "ID identifies the planned replacement for ApplyReplace.",
+					},
+				},
+			},
+			"RepoStatus": {
+				Name: "RepoStatus",
+				Doc:  "RepoStatus is the state of the git repository in the workspace.",
+				Fields: map[string]codoc.Field{
+					"Branch": {
+						Doc: "Branch is empty when HEAD is detached.",
+					},
+					"Commit": {
+						Doc: "Commit is empty before the first commit.",
+					},
+				},
+			},
+			"SearchLine": {
+				Name: "SearchLine",
+				Doc:  "SearchLine is a matching line, or a line of context around one.",
+			},
+			"SearchResult": {
+				Name: "SearchResult",
+				Fields: map[string]codoc.Field{
+					"Matches": {
+						Doc: "Matches is the number of matching lines in Files.",
+					},
+					"Truncated": {
+						Doc: "Truncated is set when more lines matched than were returned.",
+					},
+				},
+			},
+			"StashEntry": {
+				Name: "StashEntry",
+			},
+			"TestFailure": {
+				Name: "TestFailure",
+				Fields: map[string]codoc.Field{
+					"Location": {
+						Doc: "Location is the file:line, relative to the workspace, the failure was reported at.",
+					},
+					"Name": {
+						Doc: "Name is empty when the suite failed as a whole, e.g. because it did not compile.",
+					},
+					"Suite": {
+						Doc: "Suite is the Go package, test file or Python class of the test.",
+					},
+				},
+			},
+			"TestReport": {
+				Name: "TestReport",
+				Fields: map[string]codoc.Field{
+					"Failures": {
+						Doc: "Failures lists the failing tests, and the suites that failed without running their tests.",
+					},
+					"Output": {
+						Doc: "Output is the end of the command's output, when it failed without reporting a failing test, e.g. because the\ntests could not be run.",
+					},
+					"Truncated": {
+						Doc: "Truncated is set when more tests failed than are listed.",
+					},
+				},
+			},
+			"annotations": {
+				Name: "annotations",
+				Methods: map[string]codoc.Function{
+					"apply": {
+						Name: "apply",
+						Args: []string{
+							"def",
+						},
+					},
+					"isOptional": {
+						Name: "isOptional",
+					},
+				},
+			},
+			"diffOp": {
+				Name: "diffOp",
+				Fields: map[string]codoc.Field{
+					"aLine": {
+						Doc: "aLine and bLine are the 1-based numbers the line would have on either side.",
+					},
+					"bLine": {
+						Doc: "aLine and bLine are the 1-based numbers the line would have on either side.",
+					},
+					"kind": {
+						Comment: "' ', '-' or '+'",
+					},
+				},
+			},
+			"fileChange": {
+				Name: "fileChange",
+			},
+			"glob": {
+				Name: "glob",
+				Doc:  "glob is a compiled .gitignore pattern. The include and exclude globs of tools use the same syntax.",
+				Methods: map[string]codoc.Function{
+					"match": {
+						Name: "match",
+						Args: []string{
+							"rel",
+							"isDir",
+						},
+					},
+				},
+			},
+			"goDocPackage": {
+				Name: "goDocPackage",
+			},
+			"goDocPrinter": {
+				Name: "goDocPrinter",
+				Doc:  "goDocPrinter formats the declarations of a package.",
+				Methods: map[string]codoc.Function{
+					"doc": {
+						Name: "doc",
+						Args: []string{
+							"p",
+							"text",
+							"short",
+						},
+					},
+					"field": {
+						Name: "field",
+						Doc:  "field finds a field of a struct type, or a method of an interface type.",
+						Args: []string{
+							"t",
+							"name",
+						},
+					},
+					"function": {
+						Name: "function",
+						Args: []string{
+							"p",
+							"f",
+							"short",
+						},
+					},
+					"listing": {
+						Name: "listing",
+						Doc:  "listing returns the exported API of p, with the first sentence of every doc comment.",
+						Args: []string{
+							"p",
+						},
+					},
+					"lookup": {
+						Name: "lookup",
+						Doc:  "lookup finds symbol in p: a const, var, func or type, or a method or field of a type, e.g. Client.Do.",
+						Args: []string{
+							"p",
+							"symbol",
+						},
+					},
+					"print": {
+						Name: "print",
+						Doc:  "print formats node with the comments of its fields and specs, but not its own doc comment.",
+						Args: []string{
+							"node",
+						},
+					},
+					"typ": {
+						Name: "typ",
+						Args: []string{
+							"p",
+							"t",
+							"short",
+						},
+					},
+					"value": {
+						Name: "value",
+						Args: []string{
+							"p",
+							"v",
+							"kind",
+							"short",
+						},
+					},
+				},
+			},
+			"goPackage": {
+				Name: "goPackage",
+			},
+			"goTest": {
+				Name: "goTest",
+			},
+			"goTestEvent": {
+				Name: "goTestEvent",
+			},
+			"goTestEvents": {
+				Name: "goTestEvents",
+				Doc:  "goTestEvents collects the events go test -json writes, and forwards the output they carry to out.",
+				Fields: map[string]codoc.Field{
+					"builds": {
+						Doc: "builds holds the output of the builds that failed, by import path.",
+					},
+				},
+				Methods: map[string]codoc.Function{
+					"Write": {
+						Name: "Write",
+						Args: []string{
+							"p",
+						},
+					},
+					"failedSubtest": {
+						Name: "failedSubtest",
+						Args: []string{
+							"t",
+						},
+					},
+					"line": {
+						Name: "line",
+						Args: []string{
+							"line",
+						},
+					},
+					"report": {
+						Name: "report",
+						Doc:  "report counts the tests and returns the failures. A test whose subtests failed is only counted, since its own\noutput is only the names of the subtests.",
+						Args: []string{
+							"res",
+							"dir",
+							"root",
+						},
+					},
+				},
+			},
+			"ignoreRules": {
+				Name: "ignoreRules",
+				Doc:  "ignoreRules are the patterns of the .gitignore file of a directory, on top of the rules of its parent.",
+				Fields: map[string]codoc.Field{
+					"dir": {
+						Doc: "dir is the directory, relative to the root of the walk, with a trailing slash unless it is the root.",
+					},
+				},
+				Methods: map[string]codoc.Function{
+					"ignored": {
+						Name: "ignored",
+						Doc:  "ignored reports whether rel is ignored. The last pattern that matches decides, and patterns of deeper directories\ntake precedence.",
+						Args: []string{
+							"rel",
+							"isDir",
+						},
+					},
+				},
+			},
+			"jestReport": {
+				Name: "jestReport",
+			},
+			"junitCase": {
+				Name: "junitCase",
+			},
+			"junitReport": {
+				Name: "junitReport",
+			},
+			"junitResult": {
+				Name: "junitResult",
+			},
+			"planStore": {
+				Name: "planStore",
+				Methods: map[string]codoc.Function{
+					"add": {
+						Name: "add",
+						Args: []string{
+							"chatID",
+							"files",
+						},
+					},
+					"get": {
+						Name: "get",
+						Args: []string{
+							"chatID",
+							"id",
+						},
+					},
+					"remove": {
+						Name: "remove",
+						Args: []string{
+							"chatID",
+							"id",
+						},
+					},
+				},
+			},
+			"plannedFile": {
+				Name: "plannedFile",
+				Fields: map[string]codoc.Field{
+					"data": {
+						Doc: "data is the content the hunks were planned for, until the preview is made.",
+					},
+					"hash": {
+						Doc: "hash is the SHA-256 of the content the hunks were planned for.",
+					},
+					"path": {
+						Doc: "path is relative to the workspace.",
+					},
+				},
+				Methods: map[string]codoc.Function{
+					"apply": {
+						Name: "apply",
+						Doc:  "apply applies the hunks with the given IDs, or all of them if ids is empty, to data.",
+						Args: []string{
+							"data",
+							"ids",
+						},
+					},
+					"selected": {
+						Name: "selected",
+						Doc:  "selected reports whether any of the hunks with the given IDs, or any hunk if ids is empty, is one of f's.",
+						Args: []string{
+							"ids",
+						},
+					},
+				},
+			},
+			"plannedHunk": {
+				Name: "plannedHunk",
+				Methods: map[string]codoc.Function{
+					"diff": {
+						Name: "diff",
+						Doc:  "diff shows the lines the hunk changes in data, before and after the replacement.",
+						Args: []string{
+							"data",
+						},
+					},
+				},
+			},
+			"shellCommand": {
+				Name: "shellCommand",
+				Doc:  "shellCommand is a simple command of a shell command line.",
+				Fields: map[string]codoc.Field{
+					"redirects": {
+						Doc: "redirects are the files output is written to.",
+					},
+					"separator": {
+						Doc: "separator is the operator that preceded the command, e.g. && or |.",
+					},
+				},
+				Methods: map[string]codoc.Function{
+					"gitRewrite": {
+						Name: "gitRewrite",
+						Doc:  "gitRewrite describes how the command rewrites git history, or returns an empty string if it does not.",
+					},
+					"name": {
+						Name: "name",
+					},
+					"pipedInto": {
+						Name: "pipedInto",
+					},
+					"warnings": {
+						Name: "warnings",
+					},
+				},
+			},
+			"storedPlan": {
+				Name: "storedPlan",
+			},
+			"testQuery": {
+				Name: "testQuery",
+				Doc:  "testQuery is annotated both in its field comments and its tags. Like the docs of testSearch, its comments are read\nby codoc along with the rest of the package.",
+				Fields: map[string]codoc.Field{
+					"Pattern": {
+						Doc: "The pattern to search for.",
+					},
+					"Sort": {
+						Comment: "How to sort the matches. [optional, enum=name|size]",
+					},
+				},
+			},
+			"validator": {
+				Name: "validator",
+				Methods: map[string]codoc.Function{
+					"fail": {
+						Name: "fail",
+						Args: []string{
+							"path",
+							"format",
+							"args",
+						},
+					},
+					"validate": {
+						Name: "validate",
+						Args: []string{
+							"path",
+							"def",
+							"val",
+						},
+					},
+					"validateObject": {
+						Name: "validateObject",
+						Args: []string{
+							"path",
+							"def",
+							"obj",
+						},
+					},
+				},
+			},
+			"vetFinding": {
+				Name: "vetFinding",
 			},
 		},
 	})
@@ -0,0 +1,721 @@
+package toolfns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zakkor/server/secrets"
+)
+
+// RepoStatus is the state of the git repository in the workspace.
+type RepoStatus struct {
+	// Branch is empty when HEAD is detached.
+	Branch string `json:"branch"`
+	// Commit is empty before the first commit.
+	Commit   string        `json:"commit,omitempty"`
+	Upstream string        `json:"upstream,omitempty"`
+	Ahead    int           `json:"ahead"`
+	Behind   int           `json:"behind"`
+	Files    []ChangedFile `json:"files"`
+}
+
+// ChangedFile is a file with uncommitted changes. Staged and Unstaged are added, modified, deleted, renamed, copied,
+// type_changed, unmerged or untracked, or empty when the file has no such change.
+type ChangedFile struct {
+	Path string `json:"path"`
+	// OrigPath is the path a renamed or copied file had.
+	OrigPath string `json:"orig_path,omitempty"`
+	Staged   string `json:"staged,omitempty"`
+	Unstaged string `json:"unstaged,omitempty"`
+}
+
+// FileDiff is the change to one file. Patch is cut short, and Truncated set, once the patches of a result get too
+// large.
+type FileDiff struct {
+	Path      string `json:"path"`
+	OrigPath  string `json:"orig_path,omitempty"`
+	Status    string `json:"status"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary,omitempty"`
+	Patch     string `json:"patch,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+type CommitInfo struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Email   string `json:"email"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+	Body    string `json:"body,omitempty"`
+}
+
+type CommitDetails struct {
+	CommitInfo
+	Files []FileDiff `json:"files"`
+}
+
+type BlameLine struct {
+	Line    int    `json:"line"`
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Summary string `json:"summary"`
+	Text    string `json:"text"`
+}
+
+type BranchInfo struct {
+	Name     string `json:"name"`
+	Current  bool   `json:"current,omitempty"`
+	Upstream string `json:"upstream,omitempty"`
+	Commit   string `json:"commit"`
+	Subject  string `json:"subject"`
+}
+
+type StashEntry struct {
+	Index   int    `json:"index"`
+	Message string `json:"message"`
+}
+
+const (
+	// maxGitPatchSize is how many bytes of patches a single result includes.
+	maxGitPatchSize = 64 << 10
+	maxBlameLines   = 500
+)
+
+// Returns the current branch and the files with staged, unstaged or untracked changes in the workspace's git
+// repository.
+// [readonly, idempotent]
+func GitStatus(inv *Invocation) (RepoStatus, error) {
+	return inv.gitStatus()
+}
+
+// Returns the uncommitted changes of the workspace's git repository, file by file.
+// paths: Only show the changes of these files or directories. [optional]
+// staged: Show the staged changes instead of the unstaged ones. [optional]
+// [readonly, idempotent]
+func GitDiff(inv *Invocation, paths []string, staged bool) ([]FileDiff, error) {
+	args := []string{"diff"}
+	if staged {
+		args = append(args, "--cached")
+	}
+	return inv.gitDiff(args, gitPaths(paths))
+}
+
+// Returns the commits of a branch, newest first.
+// ref: The branch, tag or commit to start from. [optional, default=HEAD]
+// path: Only list the commits that changed this file or directory. [optional]
+// limit: How many commits to return at most. [optional, default=20, min=1, max=200]
+// [readonly, idempotent]
+func GitLog(inv *Invocation, ref, path string, limit int) ([]CommitInfo, error) {
+	if err := checkRefs(ref); err != nil {
+		return nil, err
+	}
+	args := []string{"log", "-n", strconv.Itoa(limit), "--format=" + commitFormat, ref, "--"}
+	if path != "" {
+		args = append(args, gitPaths([]string{path})...)
+	}
+	out, err := inv.git(args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseCommits(out), nil
+}
+
+// Returns a commit and the changes it made.
+// ref: The commit, branch or tag to show. [optional, default=HEAD]
+// [readonly, idempotent]
+func GitShow(inv *Invocation, ref string) (CommitDetails, error) {
+	return inv.gitShow(ref)
+}
+
+// Returns the commit that last changed each line of a file.
+// path: Path of the file, relative to the workspace.
+// start: The first line to return. [optional, default=1, min=1]
+// end: The last line to return. At most 500 lines are returned at a time. [optional, min=1]
+// [readonly, idempotent]
+func GitBlame(inv *Invocation, path string, start, end int) ([]BlameLine, error) {
+	if end == 0 || end-start >= maxBlameLines {
+		end = start + maxBlameLines - 1
+	}
+	if end < start {
+		return nil, Errorf(CodeInvalidArguments, "end %d is before start %d", end, start)
+	}
+	data, err := readFile(inv, path)
+	if err != nil {
+		return nil, err
+	}
+	lines := bytes.Count(data, []byte("\n"))
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		lines++
+	}
+	end = min(end, lines)
+	if start > end {
+		return []BlameLine{}, nil
+	}
+
+	out, err := inv.git(append([]string{"blame", "--porcelain", "-L", fmt.Sprintf("%d,%d", start, end), "--"},
+		gitPaths([]string{path})...)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseBlame(out), nil
+}
+
+// Lists the local branches, or creates or deletes one.
+// name: The branch to create or delete. Leave it out to list the branches. [optional]
+// start: The commit the new branch starts at. [optional, default=HEAD]
+// delete: Delete the branch instead of creating it. [optional]
+// force: Delete the branch even if it is not merged, or move an existing branch to start. This rewrites history, which the server may forbid. [optional]
+// [destructive, dryrun]
+func GitBranch(inv *Invocation, name, start string, delete, force bool) (any, error) {
+	if name != "" {
+		if err := checkRefs(name, start); err != nil {
+			return nil, err
+		}
+		var args []string
+		switch {
+		case delete && force:
+			args = []string{"branch", "-D", name}
+		case delete:
+			args = []string{"branch", "-d", name}
+		case force:
+			args = []string{"branch", "-f", name, start}
+		default:
+			args = []string{"branch", name, start}
+		}
+		if force && !inv.AllowGitRewrites {
+			return nil, Errorf(CodeDenied, "forcing git branch rewrites history, which the tool server does not allow")
+		}
+		if inv.DryRun {
+			return "Dry run: nothing was changed. This would run: git " + strings.Join(args, " "), nil
+		}
+		if _, err := inv.git(args...); err != nil {
+			return nil, err
+		}
+	}
+
+	out, err := inv.git("for-each-ref",
+		"--format=%(HEAD)%00%(refname:short)%00%(upstream:short)%00%(objectname)%00%(subject)", "refs/heads")
+	if err != nil {
+		return nil, err
+	}
+	branches := []BranchInfo{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 5 {
+			continue
+		}
+		branches = append(branches, BranchInfo{
+			Name:     fields[1],
+			Current:  fields[0] == "*",
+			Upstream: fields[2],
+			Commit:   fields[3],
+			Subject:  fields[4],
+		})
+	}
+	return branches, nil
+}
+
+// Switches the workspace to a branch, tag or commit, keeping uncommitted changes. Returns the status afterwards.
+// ref: The branch, tag or commit to check out.
+// create: Create ref as a new branch at the current commit and switch to it. [optional]
+// [destructive, dryrun]
+func GitCheckout(inv *Invocation, ref string, create bool) (any, error) {
+	if err := checkRefs(ref); err != nil {
+		return nil, err
+	}
+	args := []string{"checkout", ref, "--"}
+	if create {
+		args = []string{"checkout", "-b", ref}
+	}
+	if inv.DryRun {
+		status, err := inv.gitStatus()
+		if err != nil {
+			return nil, err
+		}
+		from := status.Branch
+		if from == "" {
+			from = status.Commit
+		}
+		msg := fmt.Sprintf("Dry run: nothing was changed. The workspace would switch from %s to %s", from, ref)
+		if create {
+			msg += ", a new branch"
+		}
+		return fmt.Sprintf("%s, and keep the changes to %d files.", msg, len(status.Files)), nil
+	}
+
+	if _, err := inv.git(args...); err != nil {
+		return nil, err
+	}
+	return inv.gitStatus()
+}
+
+// Commits the changes to the given files, and nothing else. Untracked files are added and deleted files removed.
+// message: The commit message.
+// files: The changed files to commit, one by one, relative to the workspace.
+// [destructive, dryrun]
+func GitCommit(inv *Invocation, message string, files []string) (any, error) {
+	if len(files) == 0 {
+		return nil, Errorf(CodeInvalidArguments, "list the files to commit")
+	}
+	status, err := inv.gitStatus()
+	if err != nil {
+		return nil, err
+	}
+	changed := map[string]bool{}
+	for _, f := range status.Files {
+		changed[f.Path] = true
+		if f.OrigPath != "" {
+			changed[f.OrigPath] = true
+		}
+	}
+	paths := gitPaths(files)
+	for _, p := range paths {
+		if !changed[p] {
+			return nil, Errorf(CodeInvalidArguments, "%s is not a changed file, the commit only includes the files it lists",
+				p)
+		}
+	}
+
+	if inv.DryRun {
+		return fmt.Sprintf("Dry run: nothing was committed. This commit would be made:\n%s\n\nFiles:\n  %s", message,
+			strings.Join(paths, "\n  ")), nil
+	}
+	if _, err := inv.git(append([]string{"add", "--all", "--"}, paths...)...); err != nil {
+		return nil, err
+	}
+	// --only commits the listed files even if other changes are staged.
+	if _, err := inv.git(append([]string{"commit", "--only", "-m", message, "--"}, paths...)...); err != nil {
+		return nil, err
+	}
+	return inv.gitShow("HEAD")
+}
+
+// Saves the uncommitted changes away and restores them later. Returns the stashes afterwards, newest first.
+// action: push saves the changes and reverts the workspace to the last commit, pop and apply restore a stash, with pop also dropping it, and drop deletes one. [optional, default=list, enum=list|push|pop|apply|drop]
+// message: Describes the stash to push. [optional]
+// index: The stash to pop, apply or drop, 0 being the newest. [optional, default=0, min=0]
+// [destructive, dryrun]
+func GitStash(inv *Invocation, action, message string, index int) (any, error) {
+	var args []string
+	switch action {
+	case "push":
+		args = []string{"stash", "push"}
+		if message != "" {
+			args = append(args, "-m", message)
+		}
+	case "pop", "apply", "drop":
+		args = []string{"stash", action, fmt.Sprintf("stash@{%d}", index)}
+	}
+	if args != nil {
+		if inv.DryRun {
+			return "Dry run: nothing was changed. This would run: git " + strings.Join(args, " "), nil
+		}
+		if _, err := inv.git(args...); err != nil {
+			return nil, err
+		}
+	}
+
+	out, err := inv.git("stash", "list", "--format=%gs")
+	if err != nil {
+		return nil, err
+	}
+	stashes := []StashEntry{}
+	for i, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line != "" {
+			stashes = append(stashes, StashEntry{Index: i, Message: line})
+		}
+	}
+	return stashes, nil
+}
+
+// git runs git in the workspace and returns its output. Failures carry what git printed.
+func (inv *Invocation) git(args ...string) (string, error) {
+	cmd := exec.CommandContext(inv.Context(), "git", append([]string{"-c", "core.quotePath=false", "--literal-pathspecs",
+		"--no-pager"}, args...)...)
+	cmd.Dir = inv.Workspace
+	cmd.Env = secrets.ChildEnv(cmd, "GIT_TERMINAL_PROMPT=0", "GIT_OPTIONAL_LOCKS=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", err
+		}
+		return "", Errorf(CodeToolFailed, "git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func (inv *Invocation) gitStatus() (RepoStatus, error) {
+	out, err := inv.git("status", "--porcelain=v2", "--branch", "--untracked-files=all", "-z")
+	if err != nil {
+		return RepoStatus{}, err
+	}
+
+	status := RepoStatus{Files: []ChangedFile{}}
+	records := strings.Split(out, "\x00")
+	for i := 0; i < len(records); i++ {
+		rec := records[i]
+		switch {
+		case strings.HasPrefix(rec, "# branch.oid "):
+			if oid := strings.TrimPrefix(rec, "# branch.oid "); oid != "(initial)" {
+				status.Commit = oid
+			}
+		case strings.HasPrefix(rec, "# branch.head "):
+			if head := strings.TrimPrefix(rec, "# branch.head "); head != "(detached)" {
+				status.Branch = head
+			}
+		case strings.HasPrefix(rec, "# branch.upstream "):
+			status.Upstream = strings.TrimPrefix(rec, "# branch.upstream ")
+		case strings.HasPrefix(rec, "# branch.ab "):
+			fmt.Sscanf(strings.TrimPrefix(rec, "# branch.ab "), "+%d -%d", &status.Ahead, &status.Behind)
+		case strings.HasPrefix(rec, "1 "):
+			fields := strings.SplitN(rec, " ", 9)
+			if len(fields) == 9 {
+				status.Files = append(status.Files, changedFile(fields[1], fields[8], ""))
+			}
+		case strings.HasPrefix(rec, "2 "):
+			fields := strings.SplitN(rec, " ", 10)
+			// The original path is the next record.
+			if len(fields) == 10 && i+1 < len(records) {
+				i++
+				status.Files = append(status.Files, changedFile(fields[1], fields[9], records[i]))
+			}
+		case strings.HasPrefix(rec, "u "):
+			fields := strings.SplitN(rec, " ", 11)
+			if len(fields) == 11 {
+				status.Files = append(status.Files, ChangedFile{Path: fields[10], Staged: "unmerged", Unstaged: "unmerged"})
+			}
+		case strings.HasPrefix(rec, "? "):
+			status.Files = append(status.Files, ChangedFile{Path: rec[2:], Unstaged: "untracked"})
+		}
+	}
+	return status, nil
+}
+
+var gitChanges = map[byte]string{
+	'M': "modified",
+	'T': "type_changed",
+	'A': "added",
+	'D': "deleted",
+	'R': "renamed",
+	'C': "copied",
+	'U': "unmerged",
+}
+
+func changedFile(xy, path, origPath string) ChangedFile {
+	return ChangedFile{Path: path, OrigPath: origPath, Staged: gitChanges[xy[0]], Unstaged: gitChanges[xy[1]]}
+}
+
+func (inv *Invocation) gitShow(ref string) (CommitDetails, error) {
+	if err := checkRefs(ref); err != nil {
+		return CommitDetails{}, err
+	}
+	out, err := inv.git("log", "-n", "1", "--format="+commitFormat, ref, "--")
+	if err != nil {
+		return CommitDetails{}, err
+	}
+	commits := parseCommits(out)
+	if len(commits) == 0 {
+		return CommitDetails{}, Errorf(CodeNotFound, "commit not found: %s", ref)
+	}
+	files, err := inv.gitDiff([]string{"show", "--format=", commits[0].Hash}, nil)
+	if err != nil {
+		return CommitDetails{}, err
+	}
+	return CommitDetails{CommitInfo: commits[0], Files: files}, nil
+}
+
+// gitDiff runs a git command that prints a diff, like diff or show, and splits its output by file.
+func (inv *Invocation) gitDiff(args, paths []string) ([]FileDiff, error) {
+	args = append(args, "-M", "--no-color", "--no-ext-diff")
+	stats, err := inv.git(slices.Concat(args, []string{"--numstat", "-z", "--"}, paths)...)
+	if err != nil {
+		return nil, err
+	}
+	patches, err := inv.git(slices.Concat(args, []string{"--"}, paths)...)
+	if err != nil {
+		return nil, err
+	}
+
+	files := parseNumstat(stats)
+	budget := maxGitPatchSize
+	for i, patch := range splitPatches(patches) {
+		if i >= len(files) {
+			break
+		}
+		f := &files[i]
+		switch {
+		case strings.Contains(patch, "\nnew file mode "):
+			f.Status = "added"
+		case strings.Contains(patch, "\ndeleted file mode "):
+			f.Status = "deleted"
+		case strings.Contains(patch, "\nrename from "):
+			f.Status = "renamed"
+		case strings.Contains(patch, "\ncopy from "):
+			f.Status = "copied"
+		}
+		if len(patch) > budget {
+			// Cut at a line boundary, so that the patch stays readable.
+			patch = patch[:strings.LastIndexByte(patch[:budget], '\n')+1]
+			f.Truncated = true
+		}
+		budget -= len(patch)
+		f.Patch = patch
+	}
+	return files, nil
+}
+
+// parseNumstat parses the output of --numstat -z, in which renamed files have an empty path followed by their old
+// and new paths.
+func parseNumstat(out string) []FileDiff {
+	files := []FileDiff{}
+	records := strings.Split(out, "\x00")
+	for i := 0; i < len(records); i++ {
+		fields := strings.SplitN(records[i], "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		f := FileDiff{Path: fields[2], Status: "modified"}
+		if fields[0] == "-" {
+			f.Binary = true
+		} else {
+			f.Additions, _ = strconv.Atoi(fields[0])
+			f.Deletions, _ = strconv.Atoi(fields[1])
+		}
+		if f.Path == "" && i+2 < len(records) {
+			f.OrigPath, f.Path = records[i+1], records[i+2]
+			i += 2
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+var patchStartRegex = regexp.MustCompile(`(?m)^diff --git `)
+
+func splitPatches(out string) []string {
+	starts := patchStartRegex.FindAllStringIndex(out, -1)
+	patches := make([]string, len(starts))
+	for i, s := range starts {
+		end := len(out)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		patches[i] = out[s[0]:end]
+	}
+	return patches
+}
+
+// commitFormat separates the fields of a commit with NULs and ends it with a record separator, since subjects and
+// bodies can contain anything else.
+const commitFormat = "%H%x00%an%x00%ae%x00%aI%x00%s%x00%b%x1e"
+
+func parseCommits(out string) []CommitInfo {
+	commits := []CommitInfo{}
+	for _, rec := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimLeft(rec, "\n"), "\x00")
+		if len(fields) != 6 {
+			continue
+		}
+		commits = append(commits, CommitInfo{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Email:   fields[2],
+			Date:    fields[3],
+			Subject: fields[4],
+			Body:    strings.TrimSpace(fields[5]),
+		})
+	}
+	return commits
+}
+
+// parseBlame parses the output of blame --porcelain, which describes a commit only the first time it appears.
+func parseBlame(out string) []BlameLine {
+	commits := map[string]*BlameLine{}
+	lines := []BlameLine{}
+	var cur *BlameLine
+	for _, line := range strings.Split(out, "\n") {
+		if text, ok := strings.CutPrefix(line, "\t"); ok {
+			if cur != nil {
+				cur.Text = text
+				lines = append(lines, *cur)
+			}
+			continue
+		}
+
+		key, val, _ := strings.Cut(line, " ")
+		if cur == nil && len(key) != 40 && len(key) != 64 {
+			continue
+		}
+		switch key {
+		case "author":
+			cur.Author = val
+		case "author-time":
+			sec, _ := strconv.ParseInt(val, 10, 64)
+			cur.Date = time.Unix(sec, 0).UTC().Format(time.RFC3339)
+		case "summary":
+			cur.Summary = val
+		default:
+			// A header line: <hash> <original line> <final line> [<lines in group>]
+			fields := strings.Fields(line)
+			if len(fields) < 3 || len(key) != 40 && len(key) != 64 {
+				continue
+			}
+			if commits[key] == nil {
+				commits[key] = &BlameLine{Hash: key}
+			}
+			cur = commits[key]
+			cur.Line, _ = strconv.Atoi(fields[2])
+		}
+	}
+	return lines
+}
+
+// checkRefs refuses refs that git would take for options.
+func checkRefs(refs ...string) error {
+	for _, ref := range refs {
+		if strings.HasPrefix(ref, "-") {
+			return Errorf(CodeInvalidArguments, "invalid ref: %s", ref)
+		}
+	}
+	return nil
+}
+
+// gitPaths resolves paths like Invocation.Path, but relative to the workspace, which git runs in.
+func gitPaths(paths []string) []string {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if p = strings.TrimPrefix(filepath.Clean("/"+p), "/"); p == "" {
+			p = "."
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// checkGitRewrite refuses command if it force-pushes or rewrites git history, unless the server allows it. It only
+// sees the git commands written out in command, not those run by scripts, aliases, bash -c or eval, so it keeps a
+// model from rewriting history by mistake rather than on purpose.
+func (inv *Invocation) checkGitRewrite(command string) error {
+	if inv.AllowGitRewrites {
+		return nil
+	}
+	for _, c := range parseShell(command) {
+		if reason := c.gitRewrite(); reason != "" {
+			return Errorf(CodeDenied, "%s: %s, which the tool server does not allow", c.text, reason)
+		}
+	}
+	return nil
+}
+
+// gitRewrite describes how the command rewrites git history, or returns an empty string if it does not.
+func (c *shellCommand) gitRewrite() string {
+	args := c.words
+	if len(args) > 0 && slices.Contains([]string{"sudo", "doas"}, c.name()) {
+		args = args[1:]
+	}
+	if len(args) == 0 || filepath.Base(args[0]) != "git" {
+		return ""
+	}
+
+	// Skip the global options, some of which take a value.
+	args = args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if slices.Contains([]string{"-C", "-c", "--git-dir", "--work-tree", "--namespace"}, args[0]) {
+			args = args[1:]
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	sub, args := args[0], args[1:]
+	// has reports whether any of the short flags, or one of the long ones, is set.
+	has := func(short string, long ...string) bool {
+		for _, arg := range args {
+			if arg == "--" {
+				break
+			}
+			name, _, _ := strings.Cut(arg, "=")
+			if slices.Contains(long, name) ||
+				short != "" && strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.ContainsAny(arg[1:], short) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch sub {
+	case "push":
+		if has("f", "--force", "--force-with-lease", "--force-if-includes", "--mirror") {
+			return "force-pushes"
+		}
+		if has("d", "--delete", "--prune") {
+			return "deletes remote branches"
+		}
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "+") {
+				return "force-pushes"
+			}
+			if strings.HasPrefix(arg, ":") {
+				return "deletes remote branches"
+			}
+		}
+	case "commit":
+		if has("", "--amend") {
+			return "amends a commit"
+		}
+	case "rebase":
+		if !has("", "--abort", "--quit") {
+			return "rebases commits"
+		}
+	case "reset":
+		if has("", "--hard", "--soft", "--mixed", "--keep", "--merge") {
+			return "resets the branch, which can discard commits"
+		}
+		for _, arg := range args {
+			if arg == "--" {
+				break
+			}
+			if strings.ContainsAny(arg, "~^") || strings.Contains(arg, "@{") {
+				return "moves the branch to another commit"
+			}
+		}
+	case "branch":
+		if has("DfMC", "--force") {
+			return "deletes or moves branches that may have unmerged commits"
+		}
+	case "checkout":
+		if has("B", "--force-create") {
+			return "resets a branch"
+		}
+	case "switch":
+		if has("C", "--force-create") {
+			return "resets a branch"
+		}
+	case "tag":
+		if has("f", "--force") {
+			return "moves a tag"
+		}
+	case "filter-branch", "filter-repo", "replace", "update-ref":
+		return "rewrites history"
+	case "reflog":
+		if len(args) > 0 && slices.Contains([]string{"expire", "delete"}, args[0]) {
+			return "deletes history"
+		}
+	}
+	return ""
+}
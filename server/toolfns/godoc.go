@@ -0,0 +1,361 @@
+package toolfns
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/zakkor/server/secrets"
+)
+
+type GoDocResult struct {
+	ImportPath string `json:"import_path"`
+	Package    string `json:"package"`
+	// Doc is the doc comment of the package, or its first sentence when a symbol was asked for.
+	Doc string `json:"doc,omitempty"`
+	// Symbol is the symbol that was asked for.
+	Symbol *GoSymbol `json:"symbol,omitempty"`
+	// Symbols is the exported API of the package, when no symbol was asked for.
+	Symbols []GoSymbol `json:"symbols,omitempty"`
+}
+
+type GoSymbol struct {
+	Name string `json:"name"`
+	// Kind is const, var, func, type, method or field.
+	Kind      string `json:"kind"`
+	Signature string `json:"signature"`
+	// Doc is the doc comment of the symbol. Symbols that are listed only get its first sentence.
+	Doc string `json:"doc,omitempty"`
+	// Funcs are the functions that return the type, e.g. its constructors.
+	Funcs []GoSymbol `json:"funcs,omitempty"`
+	// Methods is the method set of the type, including the methods of the types it embeds.
+	Methods []GoSymbol `json:"methods,omitempty"`
+}
+
+// Looks up the documentation of a Go package or symbol, as the Go module in the workspace resolves it: the standard
+// library, the module's own packages, and the versions of its dependencies that go.mod requires, from the local module
+// cache. Works offline. Returns the doc comment and signature of a symbol, and the method set of a type. For a package,
+// lists its exported API. Check it before calling APIs you are not sure about.
+// name: A package, or a symbol in one, e.g. "net/http", "net/http.Client", "net/http.Client.Do" or "./internal/store.Open".
+// dir: The directory of the Go module, relative to the workspace. [optional, default=.]
+// [readonly, idempotent]
+func GoDoc(inv *Invocation, name, dir string) (GoDocResult, error) {
+	if name == "" || strings.Contains(name, "...") {
+		return GoDocResult{}, Errorf(CodeInvalidArguments, "invalid name: %q", name)
+	}
+	pkg, symbol, err := inv.findGoPackage(inv.Path(dir), name)
+	if err != nil {
+		return GoDocResult{}, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, f := range pkg.files {
+		file, err := parser.ParseFile(fset, filepath.Join(pkg.dir, f), nil, parser.ParseComments)
+		if err != nil {
+			return GoDocResult{}, Errorf(CodeToolFailed, "cannot parse %s: %v", f, err)
+		}
+		files = append(files, file)
+	}
+	p, err := doc.NewFromFiles(fset, files, pkg.importPath, doc.AllMethods)
+	if err != nil {
+		return GoDocResult{}, Errorf(CodeToolFailed, "cannot read the documentation of %s: %v", pkg.importPath, err)
+	}
+
+	res := GoDocResult{ImportPath: pkg.importPath, Package: p.Name}
+	d := goDocPrinter{fset: fset}
+	if symbol == "" {
+		res.Doc = strings.TrimSpace(p.Doc)
+		res.Symbols = d.listing(p)
+		return res, nil
+	}
+	res.Doc = p.Synopsis(p.Doc)
+	s, ok := d.lookup(p, symbol)
+	if !ok {
+		return GoDocResult{}, Errorf(CodeNotFound, "%s has no exported symbol %s", pkg.importPath, symbol)
+	}
+	res.Symbol = &s
+	return res, nil
+}
+
+type goDocPackage struct {
+	importPath string
+	dir        string
+	files      []string
+}
+
+// findGoPackage resolves name, a package path that may be followed by a symbol, with go list in the module in dir.
+// The longest prefix of name that is a package wins, since package paths can contain dots too, e.g. gopkg.in/yaml.v3.
+func (inv *Invocation) findGoPackage(dir, name string) (goDocPackage, string, error) {
+	// The candidates split the last element of the path at each of its dots, longest package first.
+	candidates := []string{name}
+	last := strings.LastIndexByte(name, '/') + 1
+	for i := len(name) - 1; i > last; i-- {
+		if name[i] == '.' && name[i-1] != '.' {
+			candidates = append(candidates, name[:i])
+		}
+	}
+
+	cmd := exec.CommandContext(inv.Context(), "go", append([]string{"list", "-e",
+		"-json=ImportPath,Dir,GoFiles,CgoFiles,Error"}, candidates...)...)
+	cmd.Dir = dir
+	// The module cache is the only source of packages, and go.mod is not changed.
+	cmd.Env = secrets.ChildEnv(cmd, "GOFLAGS=", "GOPROXY=off")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return goDocPackage{}, "", Errorf(CodeToolFailed, "cannot run go list: %v", err)
+		}
+		return goDocPackage{}, "", Errorf(CodeNotFound, "cannot resolve %s: %s", name, strings.TrimSpace(stderr.String()))
+	}
+
+	// go list prints a JSON object for every candidate, in order.
+	var lastErr string
+	dec := json.NewDecoder(&stdout)
+	for i := 0; i < len(candidates); i++ {
+		var pkg struct {
+			ImportPath string
+			Dir        string
+			GoFiles    []string
+			CgoFiles   []string
+			Error      *struct{ Err string }
+		}
+		if err := dec.Decode(&pkg); err != nil {
+			break
+		}
+		files := append(pkg.GoFiles, pkg.CgoFiles...)
+		if pkg.Error != nil || pkg.Dir == "" || len(files) == 0 {
+			if pkg.Error != nil {
+				lastErr = pkg.Error.Err
+			}
+			continue
+		}
+		symbol := strings.TrimPrefix(name[len(candidates[i]):], ".")
+		return goDocPackage{importPath: pkg.ImportPath, dir: pkg.Dir, files: files}, symbol, nil
+	}
+	if lastErr == "" {
+		lastErr = "no such package"
+	}
+	return goDocPackage{}, "", Errorf(CodeNotFound,
+		"cannot resolve %s: %s. Packages of dependencies must be required by go.mod and downloaded to the module cache",
+		name, lastErr)
+}
+
+// goDocPrinter formats the declarations of a package.
+type goDocPrinter struct {
+	fset *token.FileSet
+}
+
+// listing returns the exported API of p, with the first sentence of every doc comment.
+func (d goDocPrinter) listing(p *doc.Package) []GoSymbol {
+	var symbols []GoSymbol
+	for _, v := range p.Consts {
+		symbols = append(symbols, d.value(p, v, "const", true))
+	}
+	for _, v := range p.Vars {
+		symbols = append(symbols, d.value(p, v, "var", true))
+	}
+	for _, f := range p.Funcs {
+		symbols = append(symbols, d.function(p, f, true))
+	}
+	for _, t := range p.Types {
+		symbols = append(symbols, d.typ(p, t, true))
+	}
+	return symbols
+}
+
+// lookup finds symbol in p: a const, var, func or type, or a method or field of a type, e.g. Client.Do.
+func (d goDocPrinter) lookup(p *doc.Package, symbol string) (GoSymbol, bool) {
+	typeName, member, _ := strings.Cut(symbol, ".")
+	for _, t := range p.Types {
+		if t.Name != typeName {
+			continue
+		}
+		if member == "" {
+			return d.typ(p, t, false), true
+		}
+		for _, m := range t.Methods {
+			if m.Name == member {
+				s := d.function(p, m, false)
+				s.Name = t.Name + "." + m.Name
+				return s, true
+			}
+		}
+		return d.field(t, member)
+	}
+	if member != "" {
+		return GoSymbol{}, false
+	}
+
+	for _, f := range p.Funcs {
+		if f.Name == symbol {
+			return d.function(p, f, false), true
+		}
+	}
+	// Constants and variables of a type are grouped with it.
+	values := [][]*doc.Value{p.Consts, p.Vars}
+	for _, t := range p.Types {
+		values = append(values, t.Consts, t.Vars)
+		for _, f := range t.Funcs {
+			if f.Name == symbol {
+				return d.function(p, f, false), true
+			}
+		}
+	}
+	for _, group := range values {
+		for _, v := range group {
+			for _, n := range v.Names {
+				if n == symbol {
+					kind := "const"
+					if v.Decl.Tok == token.VAR {
+						kind = "var"
+					}
+					return d.value(p, v, kind, false), true
+				}
+			}
+		}
+	}
+	return GoSymbol{}, false
+}
+
+func (d goDocPrinter) value(p *doc.Package, v *doc.Value, kind string, short bool) GoSymbol {
+	s := GoSymbol{
+		Name:      strings.Join(v.Names, ", "),
+		Kind:      kind,
+		Signature: d.print(v.Decl),
+		Doc:       d.doc(p, v.Doc, short),
+	}
+	// Long groups of constants are cut in listings, like go doc does.
+	if lines := strings.Split(s.Signature, "\n"); short && len(lines) > 1 {
+		s.Signature = lines[0] + " ..."
+	}
+	return s
+}
+
+func (d goDocPrinter) function(p *doc.Package, f *doc.Func, short bool) GoSymbol {
+	decl := *f.Decl
+	decl.Body = nil
+	decl.Doc = nil
+	s := GoSymbol{Name: f.Name, Kind: "func", Signature: d.print(&decl), Doc: d.doc(p, f.Doc, short)}
+	if f.Recv != "" {
+		s.Kind = "method"
+	}
+	return s
+}
+
+func (d goDocPrinter) typ(p *doc.Package, t *doc.Type, short bool) GoSymbol {
+	s := GoSymbol{Name: t.Name, Kind: "type", Signature: d.print(t.Decl), Doc: d.doc(p, t.Doc, short)}
+	if short {
+		// Listings show the kind of struct and interface types, not their fields.
+		for _, spec := range t.Decl.Specs {
+			ts, ok := spec.(*ast.TypeSpec)
+			if !ok || ts.Name.Name != t.Name {
+				continue
+			}
+			switch ts.Type.(type) {
+			case *ast.StructType:
+				s.Signature = "type " + t.Name + " struct{ ... }"
+			case *ast.InterfaceType:
+				s.Signature = "type " + t.Name + " interface{ ... }"
+			}
+		}
+	}
+	for _, f := range t.Funcs {
+		s.Funcs = append(s.Funcs, d.function(p, f, true))
+	}
+	for _, m := range t.Methods {
+		s.Methods = append(s.Methods, d.function(p, m, true))
+	}
+	return s
+}
+
+// field finds a field of a struct type, or a method of an interface type.
+func (d goDocPrinter) field(t *doc.Type, name string) (GoSymbol, bool) {
+	var list *ast.FieldList
+	kind := "field"
+	for _, spec := range t.Decl.Specs {
+		if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == t.Name {
+			switch typ := ts.Type.(type) {
+			case *ast.StructType:
+				list = typ.Fields
+			case *ast.InterfaceType:
+				list, kind = typ.Methods, "method"
+			}
+		}
+	}
+	if list == nil {
+		return GoSymbol{}, false
+	}
+	for _, f := range list.List {
+		for _, n := range f.Names {
+			if n.Name != name {
+				continue
+			}
+			sig := name + " " + d.print(f.Type)
+			if kind == "method" {
+				sig = name + strings.TrimPrefix(d.print(f.Type), "func")
+			}
+			text := f.Doc.Text()
+			if text == "" {
+				text = f.Comment.Text()
+			}
+			return GoSymbol{Name: t.Name + "." + name, Kind: kind, Signature: sig, Doc: strings.TrimSpace(text)}, true
+		}
+	}
+	return GoSymbol{}, false
+}
+
+func (d goDocPrinter) doc(p *doc.Package, text string, short bool) string {
+	if short {
+		return p.Synopsis(text)
+	}
+	return strings.TrimSpace(text)
+}
+
+// print formats node with the comments of its fields and specs, but not its own doc comment.
+func (d goDocPrinter) print(node ast.Node) string {
+	var comments []*ast.CommentGroup
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Field:
+			comments = appendComments(comments, n.Doc, n.Comment)
+		case *ast.ValueSpec:
+			comments = appendComments(comments, n.Doc, n.Comment)
+		case *ast.TypeSpec:
+			comments = appendComments(comments, n.Comment)
+		}
+		return true
+	})
+	if decl, ok := node.(*ast.GenDecl); ok && decl.Doc != nil {
+		copied := *decl
+		copied.Doc = nil
+		node = &copied
+	}
+
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, d.fset, &printer.CommentedNode{Node: node, Comments: comments}); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+func appendComments(list []*ast.CommentGroup, groups ...*ast.CommentGroup) []*ast.CommentGroup {
+	for _, g := range groups {
+		if g != nil {
+			list = append(list, g)
+		}
+	}
+	return list
+}
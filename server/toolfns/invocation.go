@@ -0,0 +1,121 @@
+package toolfns
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/byte-sat/llum-tools/tools"
+	"github.com/zakkor/server/artifacts"
+	"github.com/zakkor/server/docindex"
+	"github.com/zakkor/server/previews"
+	"github.com/zakkor/server/processes"
+	"github.com/zakkor/server/secrets"
+	"github.com/zakkor/server/terminals"
+)
+
+// Invocation describes the tool call being served. Tool functions that need it declare it as their first parameter,
+// which keeps it out of the schema the model sees.
+type Invocation struct {
+	ChatID string
+	CallID string
+	// Workspace is the directory tools should read and write files in.
+	Workspace string
+	Logger    *slog.Logger
+	Secrets   Secrets
+	// Progress receives partial output, which async jobs report while the tool is still running.
+	Progress  io.Writer
+	Artifacts *artifacts.Store
+	Terminals *terminals.Manager
+	Processes *processes.Manager
+	Previews  *previews.Proxy
+	// Docs is the index SearchDocs searches, if the server indexes documents.
+	Docs *docindex.Index
+	// DryRun asks the tool to describe what it would change instead of changing it. Tools that honour it are
+	// annotated with dryrun.
+	DryRun bool
+	// AllowGitRewrites lets tools force-push and rewrite the history of git repositories.
+	AllowGitRewrites bool
+	// Linters are the external linters Lint runs.
+	Linters []Linter
+
+	ctx context.Context
+}
+
+func NewInvocation(ctx context.Context) *Invocation {
+	return &Invocation{
+		Logger:   slog.Default(),
+		Secrets:  EnvSecrets{},
+		Progress: io.Discard,
+		ctx:      ctx,
+	}
+}
+
+// Context is canceled when the caller no longer wants the result, e.g. when an async job is canceled.
+func (inv *Invocation) Context() context.Context {
+	return inv.ctx
+}
+
+// Path resolves name relative to the workspace. Absolute names and names with .. elements stay inside it.
+func (inv *Invocation) Path(name string) string {
+	return filepath.Join(inv.Workspace, filepath.Clean("/"+name))
+}
+
+// Terminal returns the chat's terminal, starting a shell in the workspace if it has none.
+func (inv *Invocation) Terminal() (*terminals.Session, error) {
+	if inv.Terminals == nil {
+		return nil, Errorf(CodeInternal, "terminals are not available")
+	}
+	return inv.Terminals.Get(inv.ChatID, inv.Workspace)
+}
+
+// SaveArtifact stores a file produced by the tool and returns a part referencing it, which the client can display.
+func (inv *Invocation) SaveArtifact(name, contentType string, data []byte) (Part, error) {
+	if inv.Artifacts == nil {
+		return Part{}, Errorf(CodeInternal, "the artifact store is not available")
+	}
+
+	a, err := inv.Artifacts.Put(inv.ChatID, name, contentType, data)
+	if errors.Is(err, artifacts.ErrQuotaExceeded) {
+		return Part{}, Errorf(CodeDenied, "cannot save %s: %v", name, err)
+	}
+	if err != nil {
+		return Part{}, err
+	}
+
+	if strings.HasPrefix(contentType, "image/") {
+		p := ImageURLPart(contentType, a.URL)
+		p.Name = name
+		return p, nil
+	}
+	return FilePart(name, contentType, a.URL), nil
+}
+
+// injector tells llum-tools which parameters are provided by the server rather than by the model.
+func (inv *Invocation) injector() *tools.Injector {
+	inj, err := tools.Inject(inv)
+	if err != nil {
+		panic(err)
+	}
+	return inj
+}
+
+// Secrets gives tools access to credentials without exposing them to the model.
+type Secrets interface {
+	Secret(name string) (string, error)
+}
+
+// EnvSecrets reads secrets from LLUM_SECRET_<NAME> environment variables.
+type EnvSecrets struct{}
+
+func (EnvSecrets) Secret(name string) (string, error) {
+	val, ok := os.LookupEnv(secrets.Prefix + strings.ToUpper(name))
+	if !ok {
+		return "", Errorf(CodeNotFound, "secret not set: %s", name)
+	}
+	return val, nil
+}
@@ -0,0 +1,566 @@
+package toolfns
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/scanner"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zakkor/server/secrets"
+)
+
+type LintReport struct {
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	// Formatting holds the diff that formats every file that is not formatted, which FormatFiles applies.
+	Formatting []FormatDiff `json:"formatting,omitempty"`
+	// Linters are the linters that checked the files.
+	Linters []string `json:"linters"`
+}
+
+// Diagnostic is a problem a linter found. File is relative to the workspace, and is empty when the linter failed as a
+// whole.
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Col      int    `json:"col,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Rule     string `json:"rule,omitempty"`
+	// Source is the linter that reported the problem.
+	Source string `json:"source"`
+}
+
+type FormatDiff struct {
+	File string `json:"file"`
+	Diff string `json:"diff"`
+}
+
+// Linter is an external linter Lint runs, configured with the -linters flag of the server.
+type Linter struct {
+	Name string `json:"name"`
+	// Command runs the linter, in the workspace, with the paths of the files to check appended.
+	Command []string `json:"command"`
+	// Extensions are the extensions of the files the linter checks, e.g. ".py". It checks every file if empty.
+	Extensions []string `json:"extensions,omitempty"`
+	// Pattern matches a problem in the output of the linter, with the named groups file, line, col, severity, message
+	// and rule. The default matches lines like "file:line:col: severity: message [rule]", which most linters can print.
+	Pattern string `json:"pattern,omitempty"`
+	// Severity is the severity of problems whose severity the output does not include.
+	Severity string `json:"severity,omitempty"`
+	// Secrets are the names of secrets the linter needs, e.g. a license key. Each is passed in the environment
+	// variable of its name in upper case.
+	Secrets []string `json:"secrets,omitempty"`
+
+	re *regexp.Regexp
+}
+
+var defaultLinterPattern = `^(?P<file>[^:\s][^:]*):(?P<line>\d+):(?:(?P<col>\d+):)?\s*` +
+	`(?:(?i:(?P<severity>error|warning|info|note|hint)):\s*)?(?P<message>.+?)(?:\s+\[(?P<rule>[^\]]+)\])?$`
+
+// LoadLinters reads the linters Lint runs from a JSON file holding a list of Linter.
+func LoadLinters(path string) ([]Linter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var linters []Linter
+	if err := json.Unmarshal(data, &linters); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for i := range linters {
+		l := &linters[i]
+		if l.Name == "" || len(l.Command) == 0 {
+			return nil, fmt.Errorf("%s: linter %d needs a name and a command", path, i)
+		}
+		if l.Pattern == "" {
+			l.Pattern = defaultLinterPattern
+		}
+		if l.re, err = regexp.Compile(l.Pattern); err != nil {
+			return nil, fmt.Errorf("%s: pattern of %s: %w", path, l.Name, err)
+		}
+	}
+	return linters, nil
+}
+
+// Checks files for problems, and returns them with their file, line and column. Go files are checked with gofmt and
+// go vet, and files of other languages with the linters the server is configured with. Also returns the diff that
+// formats the Go files that are not formatted.
+// files: The files or directories to check, relative to the workspace. Directories are checked recursively, skipping the files .gitignore ignores.
+// [readonly, idempotent]
+func Lint(inv *Invocation, files []string) (LintReport, error) {
+	paths, err := lintPaths(inv, files)
+	if err != nil {
+		return LintReport{}, err
+	}
+
+	res := LintReport{Diagnostics: []Diagnostic{}, Linters: []string{}}
+	var goFiles []string
+	for _, p := range paths {
+		if strings.HasSuffix(p, ".go") {
+			goFiles = append(goFiles, p)
+		}
+	}
+	if len(goFiles) > 0 {
+		res.Linters = append(res.Linters, "gofmt", "vet")
+		unparsed := map[string]bool{}
+		for _, p := range goFiles {
+			diags, diff, err := gofmtFile(inv, p)
+			if err != nil {
+				return LintReport{}, err
+			}
+			res.Diagnostics = append(res.Diagnostics, diags...)
+			if diff != "" {
+				res.Formatting = append(res.Formatting, FormatDiff{File: p, Diff: diff})
+			}
+			if len(diags) > 0 && diags[0].Rule == "syntax" {
+				unparsed[p] = true
+			}
+		}
+		diags, err := goVet(inv, goFiles)
+		if err != nil {
+			return LintReport{}, err
+		}
+		for _, d := range diags {
+			// go vet reports the syntax errors gofmt already did.
+			if !unparsed[d.File] {
+				res.Diagnostics = append(res.Diagnostics, d)
+			}
+		}
+	}
+
+	for _, l := range inv.Linters {
+		var checked []string
+		for _, p := range paths {
+			if len(l.Extensions) == 0 || slices.Contains(l.Extensions, path.Ext(p)) {
+				checked = append(checked, p)
+			}
+		}
+		if len(checked) == 0 {
+			continue
+		}
+		res.Linters = append(res.Linters, l.Name)
+		diags, err := l.run(inv, checked)
+		if err != nil {
+			return LintReport{}, err
+		}
+		res.Diagnostics = append(res.Diagnostics, diags...)
+	}
+
+	slices.SortStableFunc(res.Diagnostics, func(a, b Diagnostic) int {
+		if a.File != b.File {
+			return strings.Compare(a.File, b.File)
+		}
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Col - b.Col
+	})
+	return res, nil
+}
+
+// Formats Go files with gofmt, and returns the diff of the changes.
+// files: The files or directories to format, relative to the workspace. Directories are formatted recursively, skipping the files .gitignore ignores.
+// [destructive, idempotent, dryrun]
+func FormatFiles(inv *Invocation, files []string) (string, error) {
+	paths, err := lintPaths(inv, files)
+	if err != nil {
+		return "", err
+	}
+
+	// Every file is formatted before any is written, so that a file that does not parse leaves all of them as they
+	// were.
+	var diff strings.Builder
+	formatted := map[string][]byte{}
+	for _, p := range paths {
+		if !strings.HasSuffix(p, ".go") {
+			continue
+		}
+		before, err := readFile(inv, p)
+		if err != nil {
+			return "", err
+		}
+		after, err := format.Source(before)
+		if err != nil {
+			return "", Errorf(CodeToolFailed, "cannot format %s, no file was changed: %v", p, err)
+		}
+		if bytes.Equal(before, after) {
+			continue
+		}
+		diff.WriteString(Diff(p, string(before), string(after)))
+		formatted[p] = after
+	}
+	if !inv.DryRun {
+		for p, after := range formatted {
+			if err := os.WriteFile(inv.Path(p), after, 0o644); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	switch {
+	case diff.Len() == 0:
+		return "The files are already formatted.", nil
+	case inv.DryRun:
+		return "Dry run: nothing was changed. This is the diff that would be applied:\n" + diff.String(), nil
+	}
+	return diff.String(), nil
+}
+
+// lintPaths expands files, which may include directories, to the paths of the files, relative to the workspace.
+func lintPaths(inv *Invocation, files []string) ([]string, error) {
+	if len(files) == 0 {
+		return nil, Errorf(CodeInvalidArguments, "no files given")
+	}
+	seen := map[string]bool{}
+	var paths []string
+	for _, name := range files {
+		rel := strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+name)), "/")
+		if rel == "" {
+			rel = "."
+		}
+		info, err := os.Stat(inv.Path(rel))
+		if err != nil {
+			return nil, Errorf(CodeNotFound, "file not found: %s", name)
+		}
+		if !info.IsDir() {
+			if !seen[rel] {
+				seen[rel] = true
+				paths = append(paths, rel)
+			}
+			continue
+		}
+
+		var (
+			mu    sync.Mutex
+			found []string
+		)
+		err = walkFiles(inv.Context(), inv.Workspace, rel, nil, func(rel string, d fs.DirEntry) {
+			mu.Lock()
+			found = append(found, rel)
+			mu.Unlock()
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range found {
+			if !seen[f] {
+				seen[f] = true
+				paths = append(paths, f)
+			}
+		}
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// gofmtFile checks that the Go file at rel is formatted. A file that does not parse is reported with its syntax
+// errors, and a file that is not formatted with the diff that formats it.
+func gofmtFile(inv *Invocation, rel string) ([]Diagnostic, string, error) {
+	before, err := readFile(inv, rel)
+	if err != nil {
+		return nil, "", err
+	}
+	after, err := format.Source(before)
+	var list scanner.ErrorList
+	if errors.As(err, &list) {
+		var diags []Diagnostic
+		for _, e := range list {
+			diags = append(diags, Diagnostic{File: rel, Line: e.Pos.Line, Col: e.Pos.Column, Severity: "error",
+				Message: e.Msg, Rule: "syntax", Source: "gofmt"})
+		}
+		return diags, "", nil
+	}
+	if err != nil {
+		return []Diagnostic{{File: rel, Severity: "error", Message: err.Error(), Source: "gofmt"}}, "", nil
+	}
+	if bytes.Equal(before, after) {
+		return nil, "", nil
+	}
+
+	// The first line that changes is where the file needs formatting.
+	a, b := strings.Split(string(before), "\n"), strings.Split(string(after), "\n")
+	line := 1
+	for line <= min(len(a), len(b)) && a[line-1] == b[line-1] {
+		line++
+	}
+	diag := Diagnostic{File: rel, Line: line, Severity: "warning", Message: "the file is not formatted with gofmt",
+		Rule: "gofmt", Source: "gofmt"}
+	return []Diagnostic{diag}, Diff(rel, string(before), string(after)), nil
+}
+
+// goVet runs go vet on the packages of files, in the modules they belong to, and returns the problems it reports in
+// files.
+func goVet(inv *Invocation, files []string) ([]Diagnostic, error) {
+	// The packages to vet, relative to the module root, by module root.
+	modules := map[string][]string{}
+	var roots []string
+	for _, f := range files {
+		root, ok := moduleRoot(inv.Workspace, path.Dir(f))
+		if !ok {
+			continue
+		}
+		rel, err := filepath.Rel(root, path.Dir(f))
+		if err != nil {
+			continue
+		}
+		pkg := "."
+		if rel != "." {
+			pkg = "./" + filepath.ToSlash(rel)
+		}
+		if _, ok := modules[root]; !ok {
+			roots = append(roots, root)
+		}
+		if !slices.Contains(modules[root], pkg) {
+			modules[root] = append(modules[root], pkg)
+		}
+	}
+
+	checked := map[string]bool{}
+	for _, f := range files {
+		checked[f] = true
+	}
+	var diags []Diagnostic
+	for _, root := range roots {
+		for _, pkgs := range argBatches(modules[root]) {
+			found, err := vetPackages(inv, inv.Path(root), pkgs)
+			if err != nil {
+				return nil, err
+			}
+			for _, d := range found {
+				if d.File == "" || checked[d.File] {
+					diags = append(diags, d)
+				}
+			}
+		}
+	}
+	return diags, nil
+}
+
+// vetPackages runs go vet on pkgs in the module at dir, and returns the problems it reports.
+func vetPackages(inv *Invocation, dir string, pkgs []string) ([]Diagnostic, error) {
+	cmd := exec.CommandContext(inv.Context(), "go", append([]string{"vet", "-json"}, pkgs...)...)
+	cmd.Dir = dir
+	cmd.Env = secrets.ChildEnv(cmd)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, Errorf(CodeToolFailed, "cannot run go vet: %v", err)
+	}
+
+	// go vet prints its findings as JSON to stdout, or to stderr before Go 1.25, and errors as text to stderr.
+	found := parseVetOutput(stdout.String(), dir, inv.Workspace)
+	found = append(found, parseVetOutput(stderr.String(), dir, inv.Workspace)...)
+	if exitErr != nil && len(found) == 0 {
+		found = append(found, Diagnostic{Severity: "error", Message: "go vet failed: " + tail(stderr.String()),
+			Source: "vet"})
+	}
+	return found, nil
+}
+
+// moduleRoot returns the closest directory at or above dir, relative to the workspace, that has a go.mod file.
+func moduleRoot(workspace, dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(workspace, dir, "go.mod")); err == nil {
+			return dir, true
+		}
+		if dir == "." || dir == "/" || dir == "" {
+			return "", false
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+type vetFinding struct {
+	Posn    string `json:"posn"`
+	Message string `json:"message"`
+}
+
+// vetError matches the errors go vet prints when a package does not build, e.g. "vet: a/a.go:3:12: undefined: x".
+var vetError = regexp.MustCompile(`^(?:vet: )?([^:\s][^:]*\.go):(\d+):(?:(\d+):)?\s*(.+)$`)
+
+// parseVetOutput parses the JSON findings and the errors in the output of go vet -json, which ran in dir.
+func parseVetOutput(out, dir, workspace string) []Diagnostic {
+	var diags []Diagnostic
+	var object []string
+	sc := bufio.NewScanner(strings.NewReader(out))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "{" || len(object) > 0 && line != "}":
+			object = append(object, line)
+		case line == "}":
+			// Findings are grouped by package, and then by analyzer.
+			var findings map[string]map[string][]vetFinding
+			if json.Unmarshal([]byte(strings.Join(append(object, line), "\n")), &findings) == nil {
+				for _, analyzers := range findings {
+					for analyzer, list := range analyzers {
+						for _, f := range list {
+							file, line, col := splitPosition(f.Posn)
+							diags = append(diags, Diagnostic{File: relativeTo(workspace, dir, file), Line: line, Col: col,
+								Severity: "warning", Message: f.Message, Rule: analyzer, Source: "vet"})
+						}
+					}
+				}
+			}
+			object = nil
+		default:
+			if m := vetError.FindStringSubmatch(line); m != nil {
+				line, _ := strconv.Atoi(m[2])
+				col, _ := strconv.Atoi(m[3])
+				diags = append(diags, Diagnostic{File: relativeTo(workspace, dir, m[1]), Line: line, Col: col,
+					Severity: "error", Message: m[4], Rule: "compile", Source: "vet"})
+			}
+		}
+	}
+	return diags
+}
+
+// splitPosition splits a position like "file.go:12:5" into its parts.
+func splitPosition(posn string) (string, int, int) {
+	parts := strings.Split(posn, ":")
+	nums := []int{}
+	for len(parts) > 1 && len(nums) < 2 {
+		n, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil {
+			break
+		}
+		nums = append([]int{n}, nums...)
+		parts = parts[:len(parts)-1]
+	}
+	nums = append(nums, 0, 0)
+	return strings.Join(parts, ":"), nums[0], nums[1]
+}
+
+// relativeTo makes file, which is absolute or relative to dir, relative to the workspace.
+func relativeTo(workspace, dir, file string) string {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	rel, err := filepath.Rel(workspace, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return file
+	}
+	return filepath.ToSlash(rel)
+}
+
+// argBatches splits args into batches that each fit on a command line.
+func argBatches(args []string) [][]string {
+	const (
+		// maxBatchArgs and maxBatchBytes stay well below the limits of the command line of every platform.
+		maxBatchArgs  = 500
+		maxBatchBytes = 64 << 10
+	)
+	var batches [][]string
+	start, size := 0, 0
+	for i, arg := range args {
+		if i > start && (i-start == maxBatchArgs || size+len(arg)+1 > maxBatchBytes) {
+			batches = append(batches, args[start:i])
+			start, size = i, 0
+		}
+		size += len(arg) + 1
+	}
+	if start < len(args) {
+		batches = append(batches, args[start:])
+	}
+	return batches
+}
+
+// run runs the linter on files, and returns the problems it reports. Long lists of files are split across runs, so
+// that they fit on the command line.
+func (l *Linter) run(inv *Invocation, files []string) ([]Diagnostic, error) {
+	var diags []Diagnostic
+	for _, batch := range argBatches(files) {
+		found, err := l.runBatch(inv, batch)
+		if err != nil {
+			return nil, err
+		}
+		diags = append(diags, found...)
+	}
+	return diags, nil
+}
+
+// runBatch runs the linter once on files.
+func (l *Linter) runBatch(inv *Invocation, files []string) ([]Diagnostic, error) {
+	cmd := exec.CommandContext(inv.Context(), l.Command[0], append(l.Command[1:], files...)...)
+	cmd.Dir = inv.Workspace
+	cmd.Env = secrets.ChildEnv(cmd, "NO_COLOR=1", "FORCE_COLOR=0")
+	for _, name := range l.Secrets {
+		val, err := inv.Secrets.Secret(name)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, strings.ToUpper(name)+"="+val)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	// Linters exit with an error when they find problems.
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, Errorf(CodeToolFailed, "cannot run %s: %v", l.Name, err)
+	}
+
+	names := l.re.SubexpNames()
+	var diags []Diagnostic
+	for _, line := range strings.Split(stripANSI(out.String()), "\n") {
+		m := l.re.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		d := Diagnostic{Source: l.Name}
+		for i, name := range names {
+			switch name {
+			case "file":
+				d.File = relativeTo(inv.Workspace, inv.Workspace, m[i])
+			case "line":
+				d.Line, _ = strconv.Atoi(m[i])
+			case "col":
+				d.Col, _ = strconv.Atoi(m[i])
+			case "severity":
+				d.Severity = normalizeSeverity(m[i])
+			case "message":
+				d.Message = m[i]
+			case "rule":
+				d.Rule = m[i]
+			}
+		}
+		if d.Severity == "" {
+			d.Severity = normalizeSeverity(l.Severity)
+		}
+		diags = append(diags, d)
+	}
+	if exitErr != nil && len(diags) == 0 && out.Len() > 0 {
+		diags = append(diags, Diagnostic{Severity: "error",
+			Message: fmt.Sprintf("%s failed: %s", l.Name, tail(out.String())), Source: l.Name})
+	}
+	return diags, nil
+}
+
+// normalizeSeverity maps the severities linters report to error, warning or info.
+func normalizeSeverity(s string) string {
+	switch s = strings.ToLower(s); s {
+	case "error", "fatal", "e", "f":
+		return "error"
+	case "info", "note", "hint", "i", "convention", "refactor":
+		return "info"
+	}
+	return "warning"
+}
@@ -0,0 +1,249 @@
+package toolfns
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/noonien/codoc"
+)
+
+// argRegex matches the argument description lines llum-tools reads from function docs.
+var argRegex = regexp.MustCompile(`(?m)^([a-zA-Z_][a-zA-Z0-9_]*): (.+)$`)
+
+// annotationRegex matches the bracketed list that parameters and struct fields can end their description with, e.g.
+//
+//	// count: How many lines to return. [optional, default=20, min=1, max=500, example=100]
+//	// mode: How the pattern is matched. [enum=literal|regex]
+//
+// Struct fields can carry the same list in a `tool:"..."` tag instead of their comment. Fields are required unless
+// they are marked optional, have a default, or are tagged `json:",omitempty"`.
+var annotationRegex = regexp.MustCompile(`\s*\[([^\[\]]*)\]\s*$`)
+
+// toolAnnotationRegex matches the line of tool annotations a function doc can contain, e.g.
+//
+//	// [readonly, idempotent, network, cost=low]
+//
+// destructive marks tools that can delete or overwrite data. dryrun marks tools that honour Invocation.DryRun. cost
+// is free-form, typically low, medium or high.
+var toolAnnotationRegex = regexp.MustCompile(`(?m)^\[([^\[\]]*)\]$`)
+
+// parseToolAnnotations parses a tool annotation list, failing on unknown items like parseAnnotations.
+func parseToolAnnotations(s string) (Annotations, bool) {
+	var a Annotations
+	for _, item := range strings.Split(s, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(item), "=")
+		switch key {
+		case "readonly":
+			a.ReadOnly = true
+		case "destructive":
+			a.Destructive = true
+		case "idempotent":
+			a.Idempotent = true
+		case "network":
+			a.RequiresNetwork = true
+		case "dryrun":
+			a.DryRun = true
+		case "cost":
+			a.Cost = val
+		default:
+			return Annotations{}, false
+		}
+	}
+	return a, true
+}
+
+type annotations struct {
+	optional bool
+	dflt     any
+	enum     []string
+	min      *float64
+	max      *float64
+	examples []any
+}
+
+// parseAnnotations parses a comma separated annotation list. It fails if any item is not a known annotation, so
+// that ordinary bracketed text in a description is left alone.
+func parseAnnotations(s string) (annotations, bool) {
+	var a annotations
+	for _, item := range strings.Split(s, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(item), "=")
+		switch key {
+		case "optional":
+			a.optional = true
+		case "default":
+			a.dflt = annotationValue(val)
+		case "enum":
+			a.enum = strings.Split(val, "|")
+		case "min", "max":
+			n, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return annotations{}, false
+			}
+			if key == "min" {
+				a.min = &n
+			} else {
+				a.max = &n
+			}
+		case "example":
+			a.examples = append(a.examples, annotationValue(val))
+		default:
+			return annotations{}, false
+		}
+	}
+	return a, true
+}
+
+// annotationValue interprets val as JSON, falling back to a plain string.
+func annotationValue(val string) any {
+	var v any
+	if err := json.Unmarshal([]byte(val), &v); err != nil {
+		return val
+	}
+	return v
+}
+
+// splitAnnotations separates a trailing annotation list from desc.
+func splitAnnotations(desc string) (string, annotations) {
+	loc := annotationRegex.FindStringSubmatchIndex(desc)
+	if loc == nil {
+		return desc, annotations{}
+	}
+	a, ok := parseAnnotations(desc[loc[2]:loc[3]])
+	if !ok {
+		return desc, annotations{}
+	}
+	return desc[:loc[0]], a
+}
+
+func (a annotations) apply(def *Definition) {
+	if a.dflt != nil {
+		def.Default = a.dflt
+	}
+	if a.enum != nil {
+		def.Enum = a.enum
+	}
+	if a.min != nil {
+		def.Minimum = a.min
+	}
+	if a.max != nil {
+		def.Maximum = a.max
+	}
+	def.Examples = append(def.Examples, a.examples...)
+}
+
+func (a annotations) isOptional() bool {
+	return a.optional || a.dflt != nil
+}
+
+// annotateFunction applies the annotations found in the doc comment of fn to its schema f.
+func annotateFunction(f *Function, fn any) {
+	fnv := reflect.ValueOf(fn)
+	doc := codoc.GetFunction(runtime.FuncForPC(fnv.Pointer()).Name())
+	if doc == nil {
+		return
+	}
+
+	for _, match := range toolAnnotationRegex.FindAllStringSubmatch(doc.Doc, -1) {
+		if a, ok := parseToolAnnotations(match[1]); ok {
+			f.Annotations = a
+			// llum-tools keeps the line in the description of functions without arguments.
+			f.Description = strings.TrimSpace(strings.Replace(f.Description, match[0], "", 1))
+			break
+		}
+	}
+
+	argDescs := make(map[string]string)
+	for _, match := range argRegex.FindAllStringSubmatch(doc.Doc, -1) {
+		argDescs[match[1]] = match[2]
+	}
+
+	params := &f.Parameters
+	for i, name := range doc.Args {
+		prop := params.Property(name)
+		if prop == nil {
+			continue
+		}
+
+		if desc, ok := argDescs[name]; ok {
+			desc, a := splitAnnotations(desc)
+			prop.Description = desc
+			a.apply(prop)
+			if a.isOptional() {
+				params.Required = slices.DeleteFunc(params.Required, func(req string) bool { return req == name })
+			}
+		}
+		annotateType(prop, fnv.Type().In(i))
+	}
+}
+
+// annotateType applies the field comments and tags of the structs reachable from t to def.
+func annotateType(def *Definition, t reflect.Type) {
+	switch t.Kind() {
+	case reflect.Pointer:
+		annotateType(def, t.Elem())
+
+	case reflect.Array, reflect.Slice, reflect.Map:
+		if def.Items != nil {
+			annotateType(def.Items, t.Elem())
+		}
+
+	case reflect.Struct:
+		st := codoc.GetStruct(t.PkgPath() + "." + t.Name())
+		def.Required = nil
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			prop := def.Property(fieldName(f))
+			if !f.IsExported() || prop == nil {
+				continue
+			}
+
+			var a annotations
+			if st != nil {
+				doc := st.Fields[f.Name].Doc
+				if doc == "" {
+					doc = st.Fields[f.Name].Comment
+				}
+				if doc != "" {
+					prop.Description, a = splitAnnotations(doc)
+				}
+			}
+			a.apply(prop)
+
+			optional := a.isOptional()
+			if tag, ok := f.Tag.Lookup("tool"); ok {
+				if a, ok := parseAnnotations(tag); ok {
+					a.apply(prop)
+					optional = optional || a.isOptional()
+				}
+			}
+			_, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !optional && !slices.Contains(strings.Split(opts, ","), "omitempty") {
+				def.Required = append(def.Required, fieldName(f))
+			}
+
+			annotateType(prop, f.Type)
+		}
+	}
+}
+
+// fieldName returns the name llum-tools gives to a struct field.
+func fieldName(f reflect.StructField) string {
+	var name string
+	if tag := f.Tag.Get("llm"); tag != "" {
+		name, _, _ = strings.Cut(tag, ",")
+	} else if tag := f.Tag.Get("json"); tag != "" {
+		name, _, _ = strings.Cut(tag, ",")
+	}
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
@@ -0,0 +1,66 @@
+package toolfns
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// testQuery is annotated both in its field comments and its tags. Like the docs of testSearch, its comments are read
+// by codoc along with the rest of the package.
+type testQuery struct {
+	// The pattern to search for.
+	Pattern string   `json:"pattern"`
+	Limit   int      `json:"limit" tool:"optional, default=3, min=1, max=9"`
+	Mode    string   `json:"mode" tool:"enum=fast|slow"`
+	Tags    []string `json:"tags,omitempty"`
+	Sort    string   `json:"sort"` // How to sort the matches. [optional, enum=name|size]
+}
+
+// Searches.
+// query: The query.
+// more: More queries. [optional]
+// all: Return every match. [optional, default=true]
+// [readonly, idempotent, cost=low]
+func testSearch(inv *Invocation, query testQuery, more []testQuery, all bool) error { return nil }
+
+func TestAnnotateFunction(t *testing.T) {
+	f := NewGroup("Test", testSearch).Functions[0]
+
+	if want := (Annotations{ReadOnly: true, Idempotent: true, Cost: "low"}); f.Annotations != want {
+		t.Errorf("annotations = %+v, want %+v", f.Annotations, want)
+	}
+	if want := []string{"query"}; !slices.Equal(f.Parameters.Required, want) {
+		t.Errorf("required parameters = %v, want %v", f.Parameters.Required, want)
+	}
+	if all := f.Parameters.Property("all"); all == nil || all.Default != true || all.Description != "Return every match." {
+		t.Errorf("all = %+v, want an optional parameter that defaults to true", all)
+	}
+
+	for _, name := range []string{"query", "more"} {
+		query := f.Parameters.Property(name)
+		if query == nil {
+			t.Fatalf("parameter %s is missing", name)
+		}
+		if query.Items != nil {
+			query = query.Items
+		}
+		if want := []string{"pattern", "mode"}; !slices.Equal(query.Required, want) {
+			t.Errorf("%s: required fields = %v, want %v", name, query.Required, want)
+		}
+		limit := query.Property("limit")
+		if limit == nil || limit.Default != float64(3) || *limit.Minimum != 1 || *limit.Maximum != 9 {
+			t.Errorf("%s: limit = %+v, want a default of 3 between 1 and 9", name, limit)
+		}
+		if mode := query.Property("mode"); mode == nil || !slices.Equal(mode.Enum, []string{"fast", "slow"}) {
+			t.Errorf("%s: mode = %+v, want enum fast|slow", name, mode)
+		}
+		sort := query.Property("sort")
+		if sort == nil || sort.Description != "How to sort the matches." || !reflect.DeepEqual(sort.Enum, []string{"name", "size"}) {
+			t.Errorf("%s: sort = %+v, want its description and enum from its comment", name, sort)
+		}
+		if pattern := query.Property("pattern"); pattern == nil || pattern.Description != "The pattern to search for." {
+			t.Errorf("%s: pattern = %+v, want its description from its doc", name, pattern)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package toolfns
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type PartType string
+
+const (
+	PartText     PartType = "text"
+	PartMarkdown PartType = "markdown"
+	PartHTML     PartType = "html"
+	PartImage    PartType = "image"
+	PartFile     PartType = "file"
+	PartJSON     PartType = "json"
+	PartPreview  PartType = "preview"
+)
+
+// Part is one piece of a rich tool result.
+type Part struct {
+	Type        PartType `json:"type"`
+	ContentType string   `json:"contentType,omitempty"`
+	// Content is the text, markdown or HTML of the part, or a data URL for inline images.
+	Content string `json:"content,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Name    string `json:"name,omitempty"`
+	JSON    any    `json:"json,omitempty"`
+}
+
+func TextPart(text string) Part {
+	return Part{Type: PartText, ContentType: "text/plain", Content: text}
+}
+
+func MarkdownPart(md string) Part {
+	return Part{Type: PartMarkdown, ContentType: "text/markdown", Content: md}
+}
+
+func HTMLPart(html string) Part {
+	return Part{Type: PartHTML, ContentType: "text/html", Content: html}
+}
+
+// ImagePart inlines an image as a data URL.
+func ImagePart(contentType string, data []byte) Part {
+	return Part{
+		Type:        PartImage,
+		ContentType: contentType,
+		Content:     "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data),
+	}
+}
+
+func ImageURLPart(contentType, url string) Part {
+	return Part{Type: PartImage, ContentType: contentType, URL: url}
+}
+
+// FilePart references a file the client can download, rather than including its content.
+func FilePart(name, contentType, url string) Part {
+	return Part{Type: PartFile, ContentType: contentType, Name: name, URL: url}
+}
+
+func JSONPart(v any) Part {
+	return Part{Type: PartJSON, ContentType: "application/json", JSON: v}
+}
+
+// PreviewPart references a web page the client can open in an iframe.
+func PreviewPart(name, url string) Part {
+	return Part{Type: PartPreview, ContentType: "text/html", Name: name, URL: url}
+}
+
+// fallback describes the part in plain text, for models that cannot take it as is.
+func (p Part) fallback() string {
+	switch p.Type {
+	case PartText, PartMarkdown:
+		return p.Content
+	case PartHTML:
+		return "[HTML document shown to the user]"
+	case PartImage:
+		if p.URL != "" {
+			return fmt.Sprintf("[%s image: %s]", p.ContentType, p.URL)
+		}
+		return fmt.Sprintf("[%s image shown to the user]", p.ContentType)
+	case PartFile:
+		return fmt.Sprintf("[file %s (%s): %s]", p.Name, p.ContentType, p.URL)
+	case PartPreview:
+		return fmt.Sprintf("[preview of %s shown to the user: %s]", p.Name, p.URL)
+	case PartJSON:
+		b, err := json.Marshal(p.JSON)
+		if err != nil {
+			return fmt.Sprintf("[invalid JSON: %v]", err)
+		}
+		return string(b)
+	default:
+		return ""
+	}
+}
+
+// Parts is a tool result made of several parts.
+type Parts []Part
+
+// MarshalJSON encodes the parts like a ContentTypeResponse with the multipart/mixed content type, whose content is a
+// plain text rendition of all parts.
+func (p Parts) MarshalJSON() ([]byte, error) {
+	fallbacks := make([]string, 0, len(p))
+	for _, part := range p {
+		if fb := part.fallback(); fb != "" {
+			fallbacks = append(fallbacks, fb)
+		}
+	}
+
+	type alias []Part
+	return json.Marshal(struct {
+		ContentTypeResponse
+		Parts alias `json:"parts"`
+	}{
+		ContentTypeResponse: ContentTypeResponse{
+			ContentType: "multipart/mixed",
+			Content:     strings.Join(fallbacks, "\n\n"),
+		},
+		Parts: alias(p),
+	})
+}
@@ -0,0 +1,148 @@
+package toolfns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/zakkor/server/processes"
+)
+
+// Starts a bash command in the background of the workspace and returns its handle, along with its first output.
+// Use it for commands that keep running, like dev servers and watchers, which Shell would wait for forever.
+// command: The bash command to start.
+// [destructive, network, dryrun]
+func StartProcess(inv *Invocation, command string) (processes.Output, error) {
+	if inv.DryRun {
+		return processes.Output{Output: previewShell(inv, command)}, nil
+	}
+	if err := inv.checkGitRewrite(command); err != nil {
+		return processes.Output{}, err
+	}
+
+	pm, err := inv.processes()
+	if err != nil {
+		return processes.Output{}, err
+	}
+	p, err := pm.Start(inv.ChatID, inv.Workspace, command)
+	if err != nil {
+		return processes.Output{}, err
+	}
+
+	// Most commands report whether they started, or why they did not, right away.
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+	case <-inv.Context().Done():
+	}
+	return p.Read(0, maxProcessOutput), nil
+}
+
+// Returns the output of a background process from an offset on, and whether it is still running.
+// id: The handle StartProcess returned.
+// offset: Where to read from: the next_offset of the previous read to get only the new output, or 0 for the whole log. [optional, default=0, min=0]
+// [readonly]
+func ReadProcessOutput(inv *Invocation, id string, offset int) (processes.Output, error) {
+	p, err := inv.process(id)
+	if err != nil {
+		return processes.Output{}, err
+	}
+	return p.Read(int64(offset), maxProcessOutput), nil
+}
+
+// Writes to the standard input of a background process.
+// id: The handle StartProcess returned.
+// input: The text to write. Include a trailing newline to submit a line.
+// [destructive, dryrun]
+func SendInput(inv *Invocation, id, input string) (string, error) {
+	p, err := inv.process(id)
+	if err != nil {
+		return "", err
+	}
+	if inv.DryRun {
+		return "Dry run: nothing was written. This would be written to " + id + ": " + input, nil
+	}
+	if _, err := p.Write([]byte(input)); err != nil {
+		return "", Errorf(CodeToolFailed, "%v", err)
+	}
+	return "Wrote " + id + "'s input.", nil
+}
+
+// Lists the background processes of the chat, including the ones that exited.
+// [readonly, idempotent]
+func ListProcesses(inv *Invocation) ([]processes.Info, error) {
+	pm, err := inv.processes()
+	if err != nil {
+		return nil, err
+	}
+	return pm.List(inv.ChatID), nil
+}
+
+// Stops a background process and everything it started, and forgets its handle.
+// id: The handle StartProcess returned.
+// [destructive, dryrun]
+func StopProcess(inv *Invocation, id string) (string, error) {
+	p, err := inv.process(id)
+	if err != nil {
+		return "", err
+	}
+	if inv.DryRun {
+		return "Dry run: nothing was stopped. " + id + " (" + p.Command + ") and everything it started would be stopped.", nil
+	}
+
+	info, err := inv.Processes.Stop(inv.ChatID, id)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Stopped %s, which exited with code %d.", id, info.ExitCode), nil
+}
+
+// Shows the user the web app a background process serves on a local port, next to the conversation, and returns
+// its URL. The user can open it from another device, unlike localhost URLs. Only ports a process started with
+// StartProcess listens on can be previewed, and the URL expires after an hour.
+// port: The port the web server listens on. [min=1, max=65535, example=5173]
+// path: The page to open. [optional, default=/]
+// [readonly, idempotent]
+func PreviewURL(inv *Invocation, port int, path string) (any, error) {
+	// The result is Parts, but go/doc would take a function declared to return Parts for its constructor, and codoc
+	// would not document it.
+	if inv.Previews == nil {
+		return nil, Errorf(CodeInternal, "previews are not available")
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return nil, Errorf(CodeNotFound, "nothing is listening on port %d, start the web server first", port)
+	}
+	conn.Close()
+	if !inv.Previews.Owns(inv.ChatID, port) {
+		return nil, Errorf(CodeDenied,
+			"port %d is not served by a process of this chat, start the web server with StartProcess", port)
+	}
+
+	return Parts{PreviewPart("port "+strconv.Itoa(port), inv.Previews.URL(inv.ChatID, port, path))}, nil
+}
+
+// maxProcessOutput is how much output a single read returns, so that a chatty process does not flood the context.
+const maxProcessOutput = 16 << 10
+
+func (inv *Invocation) processes() (*processes.Manager, error) {
+	if inv.Processes == nil {
+		return nil, Errorf(CodeInternal, "background processes are not available")
+	}
+	return inv.Processes, nil
+}
+
+func (inv *Invocation) process(id string) (*processes.Process, error) {
+	pm, err := inv.processes()
+	if err != nil {
+		return nil, err
+	}
+	p, err := pm.Get(inv.ChatID, id)
+	if errors.Is(err, processes.ErrNotFound) {
+		return nil, Errorf(CodeNotFound, "%v", err)
+	}
+	return p, err
+}
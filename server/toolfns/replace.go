@@ -0,0 +1,364 @@
+package toolfns
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ReplacePreview struct {
+	// ID identifies the planned replacement for ApplyReplace.
+	ID    string        `json:"id"`
+	Files []ReplaceFile `json:"files"`
+	Hunks int           `json:"hunks"`
+}
+
+type ReplaceFile struct {
+	Path  string        `json:"path"`
+	Hunks []ReplaceHunk `json:"hunks"`
+}
+
+// ReplaceHunk is a single replacement. Diff shows the lines of the match before and after it.
+type ReplaceHunk struct {
+	ID   string `json:"id"`
+	Line int    `json:"line"`
+	Diff string `json:"diff"`
+}
+
+const (
+	// maxReplaceHunks is how many replacements a single preview can plan.
+	maxReplaceHunks = 1000
+	// replacePlanTTL is how long ApplyReplace can apply a preview after it was made.
+	replacePlanTTL = time.Hour
+)
+
+// Plans replacing a regex or literal across the files of the workspace, without changing anything. Returns every
+// replacement as a hunk with an ID and a diff. Pass the preview's ID to ApplyReplace, with the IDs of the hunks to
+// apply. Files ignored by .gitignore and binary files are skipped.
+// pattern: The regular expression to replace, in Go syntax, or the text to replace if literal is set.
+// replacement: The text to replace every match with. Unless literal is set, $1 or ${name} insert the groups of the match.
+// literal: Replace pattern as plain text. [optional]
+// ignore_case: Match upper and lower case letters alike. [optional]
+// include: Only change the files that match one of these globs, e.g. "*.go" or "src/**/*.ts". [optional]
+// exclude: Skip the files and directories that match one of these globs. [optional]
+// path: The directory to change files in, relative to the workspace. [optional, default=.]
+// [readonly]
+func PreviewReplace(inv *Invocation, pattern, replacement string, literal, ignore_case bool, include, exclude []string,
+	path string) (ReplacePreview, error) {
+	re, err := compilePattern(pattern, literal, ignore_case)
+	if err != nil {
+		return ReplacePreview{}, err
+	}
+	includes, err := compileGlobs(include)
+	if err != nil {
+		return ReplacePreview{}, err
+	}
+	excludes, err := compileGlobs(exclude)
+	if err != nil {
+		return ReplacePreview{}, err
+	}
+
+	var (
+		mu    sync.Mutex
+		files []plannedFile
+	)
+	err = walkFiles(inv.Context(), inv.Workspace, gitPaths([]string{path})[0], excludes, func(rel string, d fs.DirEntry) {
+		if includes != nil && !includes.match(rel, false) {
+			return
+		}
+		data, ok := readTextFile(filepath.Join(inv.Workspace, rel))
+		if !ok {
+			return
+		}
+		f := plannedFile{path: rel, hash: sha256.Sum256(data), data: data}
+		for _, m := range re.FindAllSubmatchIndex(data, -1) {
+			repl := []byte(replacement)
+			if !literal {
+				repl = re.Expand(nil, repl, data, m)
+			}
+			if !bytes.Equal(repl, data[m[0]:m[1]]) {
+				f.hunks = append(f.hunks, plannedHunk{start: m[0], end: m[1], replacement: repl})
+			}
+		}
+		if len(f.hunks) == 0 {
+			return
+		}
+		mu.Lock()
+		files = append(files, f)
+		mu.Unlock()
+	})
+	if err != nil {
+		return ReplacePreview{}, err
+	}
+
+	slices.SortFunc(files, func(a, b plannedFile) int { return strings.Compare(a.path, b.path) })
+	res := ReplacePreview{Files: []ReplaceFile{}}
+	for i := range files {
+		f := &files[i]
+		data := f.data
+		// The plan is kept until it is applied, which only needs the hash of the content.
+		f.data = nil
+		rf := ReplaceFile{Path: f.path}
+		for j := range f.hunks {
+			h := &f.hunks[j]
+			res.Hunks++
+			h.id = fmt.Sprintf("h%d", res.Hunks)
+			rf.Hunks = append(rf.Hunks, ReplaceHunk{
+				ID:   h.id,
+				Line: bytes.Count(data[:h.start], []byte("\n")) + 1,
+				Diff: h.diff(data),
+			})
+		}
+		res.Files = append(res.Files, rf)
+	}
+	if res.Hunks > maxReplaceHunks {
+		return ReplacePreview{}, Errorf(CodeInvalidArguments,
+			"the pattern matches %d times, more than %d, narrow it down with path or include", res.Hunks, maxReplaceHunks)
+	}
+
+	res.ID = replacePlans.add(inv.ChatID, files)
+	return res, nil
+}
+
+// Applies the hunks of a replacement planned by PreviewReplace, all at once: if a file cannot be written, or changed
+// since the preview, nothing is changed. Returns the diff of the changes.
+// id: The ID of the preview.
+// hunks: The IDs of the hunks to apply. Leave it out to apply every hunk. [optional]
+// [destructive, dryrun]
+func ApplyReplace(inv *Invocation, id string, hunks []string) (string, error) {
+	plan, ok := replacePlans.get(inv.ChatID, id)
+	if !ok {
+		return "", Errorf(CodeNotFound, "replace preview not found: %s, it may have expired or been applied already", id)
+	}
+	selected := map[string]bool{}
+	for _, h := range hunks {
+		selected[h] = true
+	}
+	for _, f := range plan {
+		for _, h := range f.hunks {
+			delete(selected, h.id)
+		}
+	}
+	if len(selected) > 0 {
+		var unknown []string
+		for h := range selected {
+			unknown = append(unknown, h)
+		}
+		slices.Sort(unknown)
+		return "", Errorf(CodeInvalidArguments, "unknown hunks: %s", strings.Join(unknown, ", "))
+	}
+
+	var (
+		changes []fileChange
+		changed []string
+		diff    strings.Builder
+	)
+	for _, f := range plan {
+		// Files none of whose hunks are applied may have changed since.
+		if !f.selected(hunks) {
+			continue
+		}
+		abs := filepath.Join(inv.Workspace, f.path)
+		before, err := os.ReadFile(abs)
+		if err != nil || sha256.Sum256(before) != f.hash {
+			changed = append(changed, f.path)
+			continue
+		}
+		after := f.apply(before, hunks)
+		if bytes.Equal(before, after) {
+			continue
+		}
+		changes = append(changes, fileChange{path: abs, before: before, after: after})
+		diff.WriteString(Diff(f.path, string(before), string(after)))
+	}
+	if len(changed) > 0 {
+		err := Errorf(CodeConflict, "%s changed since the preview, preview the replacement again",
+			strings.Join(changed, ", "))
+		err.Details = changed
+		return "", err
+	}
+	if inv.DryRun {
+		return "Dry run: nothing was changed. This is the diff that would be applied:\n" + diff.String(), nil
+	}
+
+	if err := writeFilesAtomically(changes); err != nil {
+		return "", err
+	}
+	replacePlans.remove(inv.ChatID, id)
+	return diff.String(), nil
+}
+
+type plannedFile struct {
+	// path is relative to the workspace.
+	path string
+	// hash is the SHA-256 of the content the hunks were planned for.
+	hash [32]byte
+	// data is the content the hunks were planned for, until the preview is made.
+	data  []byte
+	hunks []plannedHunk
+}
+
+type plannedHunk struct {
+	id          string
+	start, end  int
+	replacement []byte
+}
+
+// selected reports whether any of the hunks with the given IDs, or any hunk if ids is empty, is one of f's.
+func (f *plannedFile) selected(ids []string) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	for _, h := range f.hunks {
+		if slices.Contains(ids, h.id) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply applies the hunks with the given IDs, or all of them if ids is empty, to data.
+func (f *plannedFile) apply(data []byte, ids []string) []byte {
+	var out []byte
+	last := 0
+	for _, h := range f.hunks {
+		if len(ids) > 0 && !slices.Contains(ids, h.id) {
+			continue
+		}
+		out = append(out, data[last:h.start]...)
+		out = append(out, h.replacement...)
+		last = h.end
+	}
+	return append(out, data[last:]...)
+}
+
+// diff shows the lines the hunk changes in data, before and after the replacement.
+func (h *plannedHunk) diff(data []byte) string {
+	start := bytes.LastIndexByte(data[:h.start], '\n') + 1
+	end := len(data)
+	if i := bytes.IndexByte(data[h.end:], '\n'); i >= 0 {
+		end = h.end + i
+	}
+	before := string(data[start:end])
+	after := string(data[start:h.start]) + string(h.replacement) + string(data[h.end:end])
+
+	var out strings.Builder
+	for _, line := range strings.Split(before, "\n") {
+		out.WriteString("-" + line + "\n")
+	}
+	for _, line := range strings.Split(after, "\n") {
+		out.WriteString("+" + line + "\n")
+	}
+	return out.String()
+}
+
+type fileChange struct {
+	path          string
+	before, after []byte
+}
+
+// writeFilesAtomically writes every change, or none of them. The new contents are written to temporary files first,
+// which are then renamed over the originals. If a rename fails, the files that were already replaced are restored.
+func writeFilesAtomically(changes []fileChange) error {
+	temps := make([]string, len(changes))
+	cleanup := func() {
+		for _, t := range temps {
+			if t != "" {
+				os.Remove(t)
+			}
+		}
+	}
+	for i, c := range changes {
+		info, err := os.Stat(c.path)
+		if err != nil {
+			cleanup()
+			return err
+		}
+		f, err := os.CreateTemp(filepath.Dir(c.path), "."+filepath.Base(c.path)+".*")
+		if err != nil {
+			cleanup()
+			return err
+		}
+		temps[i] = f.Name()
+		_, err = f.Write(c.after)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Chmod(f.Name(), info.Mode().Perm())
+		}
+		if err != nil {
+			cleanup()
+			return err
+		}
+	}
+
+	for i, c := range changes {
+		if err := os.Rename(temps[i], c.path); err != nil {
+			cleanup()
+			for _, done := range changes[:i] {
+				os.WriteFile(done.path, done.before, 0o644)
+			}
+			return err
+		}
+		temps[i] = ""
+	}
+	return nil
+}
+
+// replacePlans keeps the replacements PreviewReplace planned until ApplyReplace applies them.
+var replacePlans = &planStore{plans: map[string]storedPlan{}}
+
+type planStore struct {
+	mu    sync.Mutex
+	plans map[string]storedPlan
+}
+
+type storedPlan struct {
+	chatID  string
+	created time.Time
+	files   []plannedFile
+}
+
+func (s *planStore) add(chatID string, files []plannedFile) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := "r" + hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, p := range s.plans {
+		if time.Since(p.created) > replacePlanTTL {
+			delete(s.plans, k)
+		}
+	}
+	s.plans[id] = storedPlan{chatID: chatID, created: time.Now(), files: files}
+	return id
+}
+
+func (s *planStore) get(chatID, id string) ([]plannedFile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.plans[id]
+	if !ok || p.chatID != chatID || time.Since(p.created) > replacePlanTTL {
+		return nil, false
+	}
+	return p.files, true
+}
+
+func (s *planStore) remove(chatID, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.plans[id]; ok && p.chatID == chatID {
+		delete(s.plans, id)
+	}
+}
@@ -0,0 +1,150 @@
+package toolfns
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+
+	"github.com/byte-sat/llum-tools/schema"
+)
+
+// Function mirrors schema.Function, using a Definition that supports the JSON schema keywords llum-tools does not emit.
+type Function struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Parameters  Definition  `json:"parameters,omitempty"`
+	Annotations Annotations `json:"-"`
+}
+
+// MarshalJSON keeps the annotations next to the function definition rather than inside it, since providers reject
+// unknown function fields.
+func (f Function) MarshalJSON() ([]byte, error) {
+	type alias Function
+	tool := struct {
+		Type        string      `json:"type"`
+		Function    alias       `json:"function"`
+		Annotations Annotations `json:"annotations"`
+	}{Type: "function", Function: alias(f), Annotations: f.Annotations}
+	return json.Marshal(tool)
+}
+
+// Annotations describe the behavior of a tool, so that clients can decide which calls need approval.
+type Annotations struct {
+	ReadOnly        bool   `json:"readOnly"`
+	Destructive     bool   `json:"destructive"`
+	Idempotent      bool   `json:"idempotent"`
+	RequiresNetwork bool   `json:"requiresNetwork"`
+	DryRun          bool   `json:"dryRun"`
+	Cost            string `json:"cost,omitempty"`
+}
+
+type Definition struct {
+	Type        schema.Type `json:"type,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Enum        []string    `json:"enum,omitempty"`
+	Properties  Properties  `json:"properties,omitempty"`
+	Required    []string    `json:"required,omitempty"`
+	Items       *Definition `json:"items,omitempty"`
+	Minimum     *float64    `json:"minimum,omitempty"`
+	Maximum     *float64    `json:"maximum,omitempty"`
+	Default     any         `json:"default,omitempty"`
+	Examples    []any       `json:"examples,omitempty"`
+}
+
+// Property returns the definition of the named property, or nil if there is none.
+func (d *Definition) Property(name string) *Definition {
+	for i := range d.Properties {
+		if d.Properties[i].Name == name {
+			return &d.Properties[i].Definition
+		}
+	}
+	return nil
+}
+
+// IsRequired reports whether the named property must be present.
+func (d *Definition) IsRequired(name string) bool {
+	return slices.Contains(d.Required, name)
+}
+
+// zero returns the value an optional argument without a default receives when it is omitted.
+func (d *Definition) zero() any {
+	switch d.Type {
+	case schema.String:
+		return ""
+	case schema.Integer, schema.Number:
+		return float64(0)
+	case schema.Boolean:
+		return false
+	case schema.Array:
+		return []any{}
+	case schema.Object:
+		return map[string]any{}
+	default:
+		return nil
+	}
+}
+
+type Properties []Property
+
+func (p Properties) MarshalJSON() ([]byte, error) {
+	visited := make(map[string]bool)
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for _, prop := range p {
+		if visited[prop.Name] {
+			continue
+		}
+		if len(visited) > 0 {
+			buf.WriteString(",")
+		}
+		visited[prop.Name] = true
+
+		name, err := json.Marshal(prop.Name)
+		if err != nil {
+			return nil, err
+		}
+		def, err := json.Marshal(prop.Definition)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteString(":")
+		buf.Write(def)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+type Property struct {
+	Name string `json:"-"`
+	Definition
+}
+
+func fromSchemaFunction(fn schema.Function) Function {
+	return Function{
+		Name:        fn.Name,
+		Description: fn.Description,
+		Parameters:  fromSchemaDefinition(fn.Parameters),
+	}
+}
+
+func fromSchemaDefinition(d schema.Definition) Definition {
+	def := Definition{
+		Type:        d.Type,
+		Description: d.Description,
+		Enum:        d.Enum,
+		// llum-tools uses the same slice for the argument names it invokes functions with, so it must not be changed.
+		Required: slices.Clone(d.Required),
+	}
+	for _, prop := range d.Properties {
+		def.Properties = append(def.Properties, Property{
+			Name:       prop.Name,
+			Definition: fromSchemaDefinition(prop.Definition),
+		})
+	}
+	if d.Items != nil {
+		items := fromSchemaDefinition(*d.Items)
+		def.Items = &items
+	}
+	return def
+}
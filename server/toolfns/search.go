@@ -0,0 +1,371 @@
+package toolfns
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+type SearchResult struct {
+	Files []FileMatches `json:"files"`
+	// Matches is the number of matching lines in Files.
+	Matches int `json:"matches"`
+	// Truncated is set when more lines matched than were returned.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type FileMatches struct {
+	Path    string       `json:"path"`
+	Matches int          `json:"matches"`
+	Lines   []SearchLine `json:"lines"`
+}
+
+// SearchLine is a matching line, or a line of context around one.
+type SearchLine struct {
+	Line  int    `json:"line"`
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+const (
+	// maxSearchFileSize is the largest file Search reads. Larger files are usually data, not code.
+	maxSearchFileSize = 8 << 20
+	maxSearchLineSize = 300
+)
+
+// Searches the contents of the files in the workspace, and returns the matching lines grouped by file. Files ignored
+// by .gitignore, the .git directory and binary files are skipped. Prefer it over grep, which searches everything.
+// pattern: The regular expression to search for, in Go syntax, or the text to search for if literal is set.
+// literal: Search for pattern as plain text. [optional]
+// ignore_case: Match upper and lower case letters alike. [optional]
+// include: Only search the files that match one of these globs, e.g. "*.go" or "src/**/*.ts". [optional]
+// exclude: Skip the files and directories that match one of these globs. [optional]
+// path: The directory to search, relative to the workspace. [optional, default=.]
+// context_lines: How many lines around every match to return. [optional, default=2, min=0, max=10]
+// max_matches: How many matching lines to return at most. [optional, default=100, min=1, max=1000]
+// [readonly, idempotent]
+func Search(inv *Invocation, pattern string, literal, ignore_case bool, include, exclude []string, path string,
+	context_lines, max_matches int) (SearchResult, error) {
+	re, err := compilePattern(pattern, literal, ignore_case)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	includes, err := compileGlobs(include)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	excludes, err := compileGlobs(exclude)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	// Files are searched in no particular order. So that the result does not depend on it, it holds the matches of the
+	// files that sort first: once those hold more lines than are returned, the files that sort after them are dropped,
+	// or not searched at all.
+	var (
+		mu     sync.Mutex
+		files  []FileMatches
+		cutoff string
+	)
+	err = walkFiles(inv.Context(), inv.Workspace, gitPaths([]string{path})[0], excludes, func(rel string, d fs.DirEntry) {
+		if includes != nil && !includes.match(rel, false) {
+			return
+		}
+		mu.Lock()
+		skip := cutoff != "" && rel > cutoff
+		mu.Unlock()
+		if skip {
+			return
+		}
+		fm, ok := searchFile(filepath.Join(inv.Workspace, rel), re, context_lines)
+		if !ok {
+			return
+		}
+		fm.Path = rel
+
+		mu.Lock()
+		defer mu.Unlock()
+		files = append(files, fm)
+		files, cutoff = firstFiles(files, max_matches)
+	})
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	res := SearchResult{Files: []FileMatches{}}
+	for _, fm := range files {
+		if res.Matches+fm.Matches > max_matches {
+			fm = fm.limit(max_matches-res.Matches, context_lines)
+			res.Truncated = true
+		}
+		if fm.Matches > 0 {
+			res.Files = append(res.Files, fm)
+			res.Matches += fm.Matches
+		}
+		if res.Truncated {
+			break
+		}
+	}
+	return res, nil
+}
+
+// firstFiles sorts files by path and keeps the first ones, up to the one that brings their matches over
+// maxMatches. cutoff is the path of that file, if there is one.
+func firstFiles(files []FileMatches, maxMatches int) (kept []FileMatches, cutoff string) {
+	slices.SortFunc(files, func(a, b FileMatches) int { return strings.Compare(a.Path, b.Path) })
+	matches := 0
+	for i, fm := range files {
+		if matches += fm.Matches; matches > maxMatches {
+			return files[:i+1], fm.Path
+		}
+	}
+	return files, ""
+}
+
+// searchFile returns the lines of the file at path that match re, with context lines around them. Binary files and
+// files without matches are not reported.
+func searchFile(path string, re *regexp.Regexp, contextLines int) (FileMatches, bool) {
+	data, ok := readTextFile(path)
+	if !ok {
+		return FileMatches{}, false
+	}
+	locs := re.FindAllIndex(data, -1)
+	if len(locs) == 0 {
+		return FileMatches{}, false
+	}
+
+	// starts holds the offset of every line.
+	starts := []int{0}
+	for i, b := range data {
+		if b == '\n' && i+1 < len(data) {
+			starts = append(starts, i+1)
+		}
+	}
+	matched := make([]bool, len(starts))
+	for _, loc := range locs {
+		// The line of the first line start after the match start, minus one.
+		line, _ := slices.BinarySearch(starts, loc[0]+1)
+		matched[line-1] = true
+	}
+
+	var fm FileMatches
+	next := 0
+	for i, m := range matched {
+		if !m {
+			continue
+		}
+		fm.Matches++
+		for l := max(i-contextLines, next); l <= min(i+contextLines, len(starts)-1); l++ {
+			end := len(data)
+			if l+1 < len(starts) {
+				end = starts[l+1]
+			}
+			text := strings.TrimRight(string(data[starts[l]:end]), "\r\n")
+			fm.Lines = append(fm.Lines, SearchLine{Line: l + 1, Text: truncateLine(text), Match: matched[l]})
+			next = l + 1
+		}
+	}
+	return fm, true
+}
+
+// compilePattern compiles the pattern of a search, in which ^ and $ match at line breaks.
+func compilePattern(pattern string, literal, ignoreCase bool) (*regexp.Regexp, error) {
+	if literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	flags := "(?m)"
+	if ignoreCase {
+		flags = "(?mi)"
+	}
+	re, err := regexp.Compile(flags + pattern)
+	if err != nil {
+		return nil, Errorf(CodeInvalidArguments, "invalid pattern: %v", err)
+	}
+	return re, nil
+}
+
+// readTextFile reads the file at path, unless it is too large to search or binary.
+func readTextFile(path string) ([]byte, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxSearchFileSize {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	// Like git, a NUL byte near the start marks a binary file.
+	if err != nil || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return nil, false
+	}
+	return data, true
+}
+
+// limit keeps the first n matching lines and their context.
+func (fm FileMatches) limit(n, contextLines int) FileMatches {
+	count, last := 0, 0
+	for i, l := range fm.Lines {
+		if !l.Match {
+			continue
+		}
+		if count == n {
+			// Only the lines that are context of the last kept match stay.
+			cut := i
+			for cut > 0 && fm.Lines[cut-1].Line > last+contextLines {
+				cut--
+			}
+			fm.Lines = fm.Lines[:cut]
+			break
+		}
+		count, last = count+1, l.Line
+	}
+	fm.Matches = count
+	return fm
+}
+
+func truncateLine(text string) string {
+	if len(text) <= maxSearchLineSize {
+		return text
+	}
+	cut := maxSearchLineSize
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "…"
+}
+
+// Finds files in the workspace whose path fuzzily matches a query, best matches first. The characters of the query
+// must appear in the path in order, but not next to each other, so "srvmain" finds server/main.go.
+// query: Part of the path or name of the file. Words separated by spaces must all match.
+// limit: How many paths to return at most. [optional, default=20, min=1, max=200]
+// [readonly, idempotent]
+func FindFiles(inv *Invocation, query string, limit int) ([]string, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil, Errorf(CodeInvalidArguments, "the query is empty")
+	}
+
+	type scored struct {
+		path  string
+		score int
+	}
+	var (
+		mu    sync.Mutex
+		found []scored
+	)
+	err := walkFiles(inv.Context(), inv.Workspace, ".", nil, func(rel string, d fs.DirEntry) {
+		score := 0
+		for _, term := range terms {
+			s, ok := fuzzyScore(term, rel)
+			if !ok {
+				return
+			}
+			score += s
+		}
+		mu.Lock()
+		found = append(found, scored{rel, score})
+		mu.Unlock()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(found, func(a, b scored) int {
+		if a.score != b.score {
+			return b.score - a.score
+		}
+		return strings.Compare(a.path, b.path)
+	})
+	paths := []string{}
+	for _, f := range found[:min(limit, len(found))] {
+		paths = append(paths, f.path)
+	}
+	return paths, nil
+}
+
+// fuzzyScore scores how well path matches query, which must be lower case. Matches at the start of a word, in the
+// file name and next to each other score higher, and gaps between matches and long paths lower.
+func fuzzyScore(query, path string) (int, bool) {
+	// Paths are scored by rune, since lower-casing can change the length of a rune in bytes.
+	q := []rune(query)
+	runes := []rune(path)
+	lower := make([]rune, len(runes))
+	for j, r := range runes {
+		lower[j] = unicode.ToLower(r)
+	}
+	// Most paths do not contain the query at all, which is cheap to rule out.
+	i := 0
+	for j := 0; j < len(lower) && i < len(q); j++ {
+		if lower[j] == q[i] {
+			i++
+		}
+	}
+	if i < len(q) {
+		return 0, false
+	}
+
+	const (
+		matchScore       = 16
+		wordStartBonus   = 8
+		fileNameBonus    = 4
+		consecutiveBonus = 12
+		minScore         = -1 << 30
+	)
+	base := 0
+	for j, r := range runes {
+		if r == '/' {
+			base = j + 1
+		}
+	}
+	bonus := func(j int) int {
+		b := 0
+		if j >= base {
+			b += fileNameBonus
+		}
+		if j == 0 || strings.ContainsRune("/_-. ", runes[j-1]) ||
+			unicode.IsLower(runes[j-1]) && unicode.IsUpper(runes[j]) {
+			b += wordStartBonus
+		}
+		return b
+	}
+
+	// prev[j] is the best score of the query so far with its last character matched at j.
+	prev := make([]int, len(lower))
+	cur := make([]int, len(lower))
+	for j := range lower {
+		prev[j] = minScore
+		if lower[j] == q[0] {
+			prev[j] = matchScore + bonus(j)
+		}
+	}
+	for qi := 1; qi < len(q); qi++ {
+		// best is the best prev[k] + k over k < j-1, so that the gap j-k-1 can be subtracted.
+		best := minScore
+		for j := range lower {
+			cur[j] = minScore
+			if j >= 2 && prev[j-2] > minScore {
+				best = max(best, prev[j-2]+j-2)
+			}
+			if lower[j] != q[qi] {
+				continue
+			}
+			if best > minScore {
+				cur[j] = best - j + 1 + matchScore + bonus(j)
+			}
+			if j >= 1 && prev[j-1] > minScore {
+				cur[j] = max(cur[j], prev[j-1]+matchScore+bonus(j)+consecutiveBonus)
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	score := slices.Max(prev)
+	if score <= minScore {
+		return 0, false
+	}
+	return score - len(runes)/4, true
+}
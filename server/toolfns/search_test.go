@@ -0,0 +1,87 @@
+package toolfns
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		query string
+		path  string
+		ok    bool
+	}{
+		{"main", "cmd/main.go", true},
+		{"mg", "cmd/main.go", true},
+		{"xyz", "cmd/main.go", false},
+		// Lower-casing Ⱥ makes it longer in bytes.
+		{"x", "ȺȺx", true},
+		{"ⱥx", "docs/ȺȺx.md", true},
+		{"é", "Éclair.txt", true},
+	}
+	for _, tt := range tests {
+		if _, ok := fuzzyScore(tt.query, tt.path); ok != tt.ok {
+			t.Errorf("fuzzyScore(%q, %q) matched = %v, want %v", tt.query, tt.path, ok, tt.ok)
+		}
+	}
+
+	// Matches in the file name score higher than in the directories.
+	name, _ := fuzzyScore("walk", "internal/walk.go")
+	dir, _ := fuzzyScore("walk", "walk/internal.go")
+	if name <= dir {
+		t.Errorf("fuzzyScore of a file name match = %d, want more than %d", name, dir)
+	}
+}
+
+func TestWalkFilesRecoversPanics(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755)
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := walkFiles(context.Background(), dir, ".", nil, func(rel string, d fs.DirEntry) {
+		if rel == "sub/b.txt" {
+			panic("boom")
+		}
+	})
+	if err == nil {
+		t.Fatal("walkFiles returned no error for a panic in fn")
+	}
+}
+
+func TestSearchKeepsFirstFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 50 {
+		name := filepath.Join(dir, fmt.Sprintf("d%d", i%5), fmt.Sprintf("f%02d.txt", i))
+		os.MkdirAll(filepath.Dir(name), 0o755)
+		if err := os.WriteFile(name, []byte("match\nmatch\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inv := NewInvocation(context.Background())
+	inv.Workspace = dir
+	for range 20 {
+		res, err := Search(inv, "match", true, false, nil, nil, ".", 0, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, fm := range res.Files {
+			paths = append(paths, fm.Path)
+		}
+		want := []string{"d0/f00.txt", "d0/f05.txt", "d0/f10.txt"}
+		if !slices.Equal(paths, want) || res.Matches != 5 || !res.Truncated {
+			t.Fatalf("Search() = %v with %d matches, truncated %v, want %v with 5 matches, truncated", paths,
+				res.Matches, res.Truncated, want)
+		}
+	}
+}
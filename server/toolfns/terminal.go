@@ -0,0 +1,78 @@
+package toolfns
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Types keys into the chat's terminal and returns its screen once the output settles. Unlike Shell, the terminal
+// keeps running between calls and the user can watch it, so use it for interactive programs like REPLs, editors,
+// TUIs or git rebase.
+// keys: The text to type. Special keys are written in angle brackets: <Enter>, <Tab>, <Esc>, <Backspace>, <Delete>, <Up>, <Down>, <Left>, <Right>, <Home>, <End>, <PageUp>, <PageDown>, and Ctrl combinations like <C-c>. [example="ls -la<Enter>"]
+// wait: How many seconds to wait for the output to settle at most. [optional, default=5, min=0, max=60]
+// [destructive, dryrun]
+func TerminalSendKeys(inv *Invocation, keys string, wait float64) (string, error) {
+	if inv.DryRun {
+		return "Dry run: nothing was typed. These keys would be sent to the terminal: " + keys, nil
+	}
+	// Key names are replaced with spaces, so that they do not stick to the words of the command.
+	if err := inv.checkGitRewrite(keyRegex.ReplaceAllString(keys, " ")); err != nil {
+		return "", err
+	}
+
+	term, err := inv.Terminal()
+	if err != nil {
+		return "", err
+	}
+	if _, err := term.Write(parseKeys(keys)); err != nil {
+		return "", err
+	}
+	term.Settle(500*time.Millisecond, time.Duration(wait*float64(time.Second)))
+	return term.Screen().String(), nil
+}
+
+// Returns what the chat's terminal currently displays.
+// [readonly, idempotent]
+func TerminalScreen(inv *Invocation) (string, error) {
+	term, err := inv.Terminal()
+	if err != nil {
+		return "", err
+	}
+	return term.Screen().String(), nil
+}
+
+var keyRegex = regexp.MustCompile(`<([A-Za-z]+|[Cc]-.)>`)
+
+var keyCodes = map[string]string{
+	"enter":     "\r",
+	"tab":       "\t",
+	"esc":       "\x1b",
+	"space":     " ",
+	"backspace": "\x7f",
+	"delete":    "\x1b[3~",
+	"up":        "\x1b[A",
+	"down":      "\x1b[B",
+	"right":     "\x1b[C",
+	"left":      "\x1b[D",
+	"home":      "\x1b[H",
+	"end":       "\x1b[F",
+	"pageup":    "\x1b[5~",
+	"pagedown":  "\x1b[6~",
+}
+
+// parseKeys replaces the names of special keys in keys with the bytes a terminal sends for them. Bracketed text that
+// is not a key name is typed as is.
+func parseKeys(keys string) []byte {
+	return []byte(keyRegex.ReplaceAllStringFunc(keys, func(match string) string {
+		name := strings.ToLower(match[1 : len(match)-1])
+		if code, ok := keyCodes[name]; ok {
+			return code
+		}
+		if strings.HasPrefix(name, "c-") {
+			// Ctrl clears the upper bits of the key, e.g. Ctrl+C is 0x03.
+			return string(rune(strings.ToUpper(name[2:])[0] & 0x1f))
+		}
+		return match
+	}))
+}
@@ -0,0 +1,628 @@
+package toolfns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zakkor/server/secrets"
+)
+
+type TestReport struct {
+	Framework string `json:"framework"`
+	Command   string `json:"command"`
+	Passed    int    `json:"passed"`
+	Failed    int    `json:"failed"`
+	Skipped   int    `json:"skipped"`
+	// Failures lists the failing tests, and the suites that failed without running their tests.
+	Failures []TestFailure `json:"failures"`
+	// Truncated is set when more tests failed than are listed.
+	Truncated bool `json:"truncated,omitempty"`
+	// Output is the end of the command's output, when it failed without reporting a failing test, e.g. because the
+	// tests could not be run.
+	Output string `json:"output,omitempty"`
+}
+
+type TestFailure struct {
+	// Suite is the Go package, test file or Python class of the test.
+	Suite string `json:"suite,omitempty"`
+	// Name is empty when the suite failed as a whole, e.g. because it did not compile.
+	Name string `json:"name,omitempty"`
+	// Location is the file:line, relative to the workspace, the failure was reported at.
+	Location string `json:"location,omitempty"`
+	Output   string `json:"output"`
+}
+
+const (
+	maxTestFailures = 50
+	// maxFailureLines is how many lines of output a failure keeps. Longer output keeps its start and end.
+	maxFailureLines  = 40
+	maxFailureOutput = 4 << 10
+)
+
+// Runs the tests of the project in the workspace and returns how many passed, failed and were skipped, with the
+// output of every failure. Prefer it over running tests with Shell, whose output is much longer. Supports Go,
+// Jest and pytest, and detects which one the project uses.
+// path: The directory of the project, relative to the workspace. [optional, default=.]
+// tests: The Go packages, or test files and directories, to run, relative to path, e.g. "./server/..." or "tests/test_api.py". All tests run by default. [optional]
+// run: Only run the tests whose names match: a regex for Go and Jest, a -k expression for pytest. [optional]
+// framework: The test framework of the project. [optional, default=auto, enum=auto|go|jest|pytest]
+// timeout: How many seconds the tests can run for. [optional, default=600, min=1, max=3600]
+// [destructive, network, dryrun]
+func RunTests(inv *Invocation, path string, tests []string, run, framework string, timeout int) (TestReport, error) {
+	dir := inv.Path(path)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return TestReport{}, Errorf(CodeNotFound, "directory not found: %s", path)
+	}
+	if framework == "auto" {
+		found := detectTestFrameworks(dir)
+		switch len(found) {
+		case 0:
+			return TestReport{}, Errorf(CodeInvalidArguments,
+				"cannot tell which test framework %s uses, set framework", path)
+		case 1:
+			framework = found[0]
+		default:
+			return TestReport{}, Errorf(CodeInvalidArguments, "%s has %s tests, set framework to pick one", path,
+				strings.Join(found, " and "))
+		}
+	}
+
+	// Jest and pytest write their results to a file, and their usual output to stdout.
+	report := "<report>"
+	if !inv.DryRun {
+		f, err := os.CreateTemp("", "llum-tests-*")
+		if err != nil {
+			return TestReport{}, err
+		}
+		f.Close()
+		report = f.Name()
+		defer os.Remove(report)
+	}
+	args := testCommand(framework, dir, report, tests, run)
+	res := TestReport{Framework: framework, Command: commandLine(args), Failures: []TestFailure{}}
+	if inv.DryRun {
+		res.Output = "Dry run: the tests were not run."
+		return res, nil
+	}
+
+	ctx, cancel := context.WithTimeout(inv.Context(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = secrets.ChildEnv(cmd, "CI=true", "NO_COLOR=1", "FORCE_COLOR=0")
+	// Tests often start processes that outlive them, which would keep the output open.
+	cmd.WaitDelay = time.Second
+	var out bytes.Buffer
+	var events *goTestEvents
+	if framework == "go" {
+		events = newGoTestEvents(io.MultiWriter(&out, inv.Progress))
+		cmd.Stdout = events
+	} else {
+		cmd.Stdout = io.MultiWriter(&out, inv.Progress)
+	}
+	cmd.Stderr = io.MultiWriter(&out, inv.Progress)
+
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		e := Errorf(CodeTimeout, "the tests did not finish in %d seconds", timeout)
+		e.Details = tail(out.String())
+		return TestReport{}, e
+	}
+	if err := inv.Context().Err(); err != nil {
+		return TestReport{}, err
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return TestReport{}, Errorf(CodeToolFailed, "cannot run %s: %v", args[0], err)
+	}
+
+	var (
+		failures []TestFailure
+		parseErr error
+	)
+	switch framework {
+	case "go":
+		failures = events.report(&res, dir, inv.Workspace)
+	case "jest":
+		failures, parseErr = parseJestReport(report, inv.Workspace, &res)
+	case "pytest":
+		failures, parseErr = parsePytestReport(report, dir, inv.Workspace, &res)
+	}
+	if parseErr != nil {
+		e := Errorf(CodeToolFailed, "%s did not report the results of the tests", framework)
+		e.Details = tail(out.String())
+		return TestReport{}, e
+	}
+
+	for _, f := range failures {
+		if len(res.Failures) == maxTestFailures {
+			res.Truncated = true
+			break
+		}
+		if rel, err := filepath.Rel(inv.Workspace, f.Location); err == nil && f.Location != "" {
+			f.Location = filepath.ToSlash(rel)
+		}
+		// Jest names suites by their absolute paths, which are shortened the same way, like the paths in the output.
+		f.Suite = strings.TrimPrefix(f.Suite, inv.Workspace+"/")
+		f.Output = trimFailureOutput(strings.ReplaceAll(f.Output, inv.Workspace+"/", ""))
+		res.Failures = append(res.Failures, f)
+	}
+	if exitErr != nil && len(res.Failures) == 0 {
+		res.Output = tail(out.String())
+	}
+	return res, nil
+}
+
+// detectTestFrameworks returns the test frameworks the project in dir is set up for.
+func detectTestFrameworks(dir string) []string {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+	mentions := func(name, text string) bool {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		return err == nil && strings.Contains(string(data), text)
+	}
+
+	var found []string
+	if exists("go.mod") || exists("go.work") {
+		found = append(found, "go")
+	}
+	if mentions("package.json", `"jest"`) || mentions("package.json", "jest ") {
+		found = append(found, "jest")
+	} else {
+		for _, ext := range []string{"js", "ts", "mjs", "cjs", "json"} {
+			if exists("jest.config." + ext) {
+				found = append(found, "jest")
+				break
+			}
+		}
+	}
+	if exists("pytest.ini") || exists("conftest.py") || mentions("pyproject.toml", "pytest") ||
+		mentions("setup.cfg", "pytest") || mentions("tox.ini", "pytest") {
+		found = append(found, "pytest")
+	}
+	return found
+}
+
+// testCommand returns the command that runs the tests of framework in dir. Frameworks that report their results in
+// a file write it to report.
+func testCommand(framework, dir, report string, tests []string, run string) []string {
+	var args []string
+	switch framework {
+	case "go":
+		// -fullpath makes the locations of failures absolute, which they would otherwise not be.
+		args = []string{"go", "test", "-json", "-fullpath"}
+		if run != "" {
+			args = append(args, "-run", run)
+		}
+		if len(tests) == 0 {
+			tests = []string{"./..."}
+		}
+	case "jest":
+		args = []string{"npx", "--no-install", "jest"}
+		if _, err := os.Stat(filepath.Join(dir, "node_modules", ".bin", "jest")); err == nil {
+			args = []string{"node_modules/.bin/jest"}
+		}
+		args = append(args, "--ci", "--json", "--outputFile="+report, "--testLocationInResults")
+		if run != "" {
+			args = append(args, "--testNamePattern", run)
+		}
+	case "pytest":
+		python := "python3"
+		for _, venv := range []string{".venv", "venv"} {
+			if _, err := os.Stat(filepath.Join(dir, venv, "bin", "python")); err == nil {
+				python = venv + "/bin/python"
+				break
+			}
+		}
+		// xunit1 reports include the file and line of every test.
+		args = []string{python, "-m", "pytest", "--junitxml=" + report, "-o", "junit_family=xunit1", "--color=no"}
+		if run != "" {
+			args = append(args, "-k", run)
+		}
+	}
+	return append(args, tests...)
+}
+
+// goTestEvents collects the events go test -json writes, and forwards the output they carry to out.
+type goTestEvents struct {
+	out     io.Writer
+	partial []byte
+	tests   []*goTest
+	byName  map[[2]string]*goTest
+	pkgs    map[string]*goPackage
+	// builds holds the output of the builds that failed, by import path.
+	builds map[string][]string
+}
+
+type goTest struct {
+	pkg, name string
+	status    string
+	output    []string
+}
+
+type goPackage struct {
+	failed      bool
+	failedBuild string
+	output      []string
+}
+
+type goTestEvent struct {
+	Action      string
+	Package     string
+	Test        string
+	Output      string
+	ImportPath  string
+	FailedBuild string
+}
+
+func newGoTestEvents(out io.Writer) *goTestEvents {
+	return &goTestEvents{
+		out:    out,
+		byName: map[[2]string]*goTest{},
+		pkgs:   map[string]*goPackage{},
+		builds: map[string][]string{},
+	}
+}
+
+func (g *goTestEvents) Write(p []byte) (int, error) {
+	g.partial = append(g.partial, p...)
+	for {
+		i := bytes.IndexByte(g.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		g.line(g.partial[:i+1])
+		g.partial = g.partial[i+1:]
+	}
+}
+
+func (g *goTestEvents) line(line []byte) {
+	var e goTestEvent
+	if !bytes.HasPrefix(line, []byte("{")) || json.Unmarshal(line, &e) != nil {
+		g.out.Write(line)
+		return
+	}
+	g.out.Write([]byte(e.Output))
+
+	switch {
+	case e.ImportPath != "":
+		if e.Action == "build-output" {
+			g.builds[e.ImportPath] = append(g.builds[e.ImportPath], e.Output)
+		}
+	case e.Test != "":
+		key := [2]string{e.Package, e.Test}
+		t := g.byName[key]
+		if t == nil {
+			t = &goTest{pkg: e.Package, name: e.Test}
+			g.byName[key] = t
+			g.tests = append(g.tests, t)
+		}
+		switch e.Action {
+		case "output":
+			t.output = append(t.output, e.Output)
+		case "pass", "fail", "skip":
+			t.status = e.Action
+		}
+	case e.Package != "":
+		pkg := g.pkgs[e.Package]
+		if pkg == nil {
+			pkg = &goPackage{}
+			g.pkgs[e.Package] = pkg
+		}
+		switch e.Action {
+		case "output":
+			pkg.output = append(pkg.output, e.Output)
+		case "fail":
+			pkg.failed = true
+			pkg.failedBuild = e.FailedBuild
+		}
+	}
+}
+
+// report counts the tests and returns the failures. A test whose subtests failed is only counted, since its own
+// output is only the names of the subtests.
+func (g *goTestEvents) report(res *TestReport, dir, root string) []TestFailure {
+	var failures []TestFailure
+	failedPkgs := map[string]bool{}
+	for _, t := range g.tests {
+		switch t.status {
+		case "pass":
+			res.Passed++
+		case "skip":
+			res.Skipped++
+		case "fail":
+			res.Failed++
+			failedPkgs[t.pkg] = true
+			if g.failedSubtest(t) {
+				continue
+			}
+			output := testOutput(t.output)
+			failures = append(failures, TestFailure{
+				Suite:    t.pkg,
+				Name:     t.name,
+				Location: findLocation(output, goLocation, dir, root),
+				Output:   output,
+			})
+		}
+	}
+
+	// Packages that fail without a failing test did not build, or failed outside of the tests, e.g. in TestMain.
+	var names []string
+	for name := range g.pkgs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		pkg := g.pkgs[name]
+		if !pkg.failed || failedPkgs[name] {
+			continue
+		}
+		output := strings.TrimSpace(testOutput(pkg.output) + "\n" + strings.Join(g.builds[pkg.failedBuild], ""))
+		if output == "" {
+			continue
+		}
+		failures = append(failures, TestFailure{
+			Suite:    name,
+			Location: findLocation(output, goLocation, dir, root),
+			Output:   output,
+		})
+	}
+	return failures
+}
+
+func (g *goTestEvents) failedSubtest(t *goTest) bool {
+	for _, sub := range g.tests {
+		if sub.pkg == t.pkg && sub.status == "fail" && strings.HasPrefix(sub.name, t.name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// testOutput joins the output of a Go test, leaving out the lines go test prints about running it.
+func testOutput(lines []string) string {
+	var out strings.Builder
+	for _, l := range lines {
+		trimmed := strings.TrimSpace(l)
+		if strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- ") || trimmed == "FAIL" ||
+			trimmed == "PASS" || strings.HasPrefix(trimmed, "FAIL\t") || strings.HasPrefix(trimmed, "ok  \t") ||
+			strings.HasPrefix(trimmed, "exit status ") {
+			continue
+		}
+		// go test indents the output of tests.
+		out.WriteString(strings.TrimPrefix(l, "    "))
+	}
+	return strings.TrimSpace(out.String())
+}
+
+type jestReport struct {
+	NumPassedTests  int `json:"numPassedTests"`
+	NumFailedTests  int `json:"numFailedTests"`
+	NumPendingTests int `json:"numPendingTests"`
+	NumTodoTests    int `json:"numTodoTests"`
+	TestResults     []struct {
+		Name             string `json:"name"`
+		Status           string `json:"status"`
+		Message          string `json:"message"`
+		AssertionResults []struct {
+			FullName        string   `json:"fullName"`
+			Status          string   `json:"status"`
+			FailureMessages []string `json:"failureMessages"`
+			Location        *struct {
+				Line int `json:"line"`
+			} `json:"location"`
+		} `json:"assertionResults"`
+	} `json:"testResults"`
+}
+
+func parseJestReport(path, root string, res *TestReport) ([]TestFailure, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report jestReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	res.Passed = report.NumPassedTests
+	res.Failed = report.NumFailedTests
+	res.Skipped = report.NumPendingTests + report.NumTodoTests
+
+	var failures []TestFailure
+	for _, file := range report.TestResults {
+		failedTests := false
+		for _, a := range file.AssertionResults {
+			if a.Status != "failed" {
+				continue
+			}
+			failedTests = true
+			output := stripANSI(strings.Join(a.FailureMessages, "\n"))
+			location := findLocation(output, jestLocation, "", root)
+			if location == "" && a.Location != nil {
+				location = file.Name + ":" + strconv.Itoa(a.Location.Line)
+			}
+			failures = append(failures, TestFailure{Suite: file.Name, Name: a.FullName, Location: location, Output: output})
+		}
+		// A test file fails as a whole when it cannot be run, e.g. because of a syntax error.
+		if file.Status == "failed" && !failedTests && file.Message != "" {
+			output := stripANSI(file.Message)
+			failures = append(failures, TestFailure{
+				Suite:    file.Name,
+				Location: findLocation(output, jestLocation, "", root),
+				Output:   output,
+			})
+		}
+	}
+	return failures, nil
+}
+
+type junitReport struct {
+	Suites []junitReport `xml:"testsuite"`
+	Cases  []junitCase   `xml:"testcase"`
+}
+
+type junitCase struct {
+	Classname string       `xml:"classname,attr"`
+	Name      string       `xml:"name,attr"`
+	File      string       `xml:"file,attr"`
+	Line      string       `xml:"line,attr"`
+	Failure   *junitResult `xml:"failure"`
+	Error     *junitResult `xml:"error"`
+	Skipped   *junitResult `xml:"skipped"`
+}
+
+type junitResult struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func parsePytestReport(path, dir, root string, res *TestReport) ([]TestFailure, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report junitReport
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	var failures []TestFailure
+	var collect func(r junitReport)
+	collect = func(r junitReport) {
+		for _, s := range r.Suites {
+			collect(s)
+		}
+		for _, c := range r.Cases {
+			failure := c.Failure
+			if failure == nil {
+				failure = c.Error
+			}
+			switch {
+			case failure != nil:
+				res.Failed++
+				output := strings.TrimSpace(failure.Text)
+				if output == "" {
+					output = failure.Message
+				}
+				location := findLocation(output, pytestLocation, dir, root)
+				if location == "" && c.File != "" {
+					// The line of the test is counted from 0.
+					line, _ := strconv.Atoi(c.Line)
+					location = filepath.Join(dir, c.File) + ":" + strconv.Itoa(line+1)
+				}
+				failures = append(failures, TestFailure{Suite: c.Classname, Name: c.Name, Location: location, Output: output})
+			case c.Skipped != nil:
+				res.Skipped++
+			default:
+				res.Passed++
+			}
+		}
+	}
+	collect(report)
+	return failures, nil
+}
+
+var (
+	// goLocation matches the file names go test prints before failure messages and compiler errors, and in stack
+	// traces.
+	goLocation = regexp.MustCompile(`(?m)^\s*(\S+?\.go):(\d+)\b`)
+	// jestLocation matches the frames of stack traces.
+	jestLocation = regexp.MustCompile(`\((/[^():]+):(\d+):\d+\)`)
+	// pytestLocation matches the line pytest ends a failure with, e.g. "tests/test_api.py:12: AssertionError".
+	pytestLocation = regexp.MustCompile(`(?m)^(\S+?\.py):(\d+): `)
+	ansiEscape     = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+)
+
+// findLocation returns the first file:line in output that re matches and that is in root, skipping installed
+// dependencies. Relative paths are resolved against dir. pytest reports the location of the failure last.
+func findLocation(output string, re *regexp.Regexp, dir, root string) string {
+	matches := re.FindAllStringSubmatch(output, -1)
+	if re == pytestLocation {
+		for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+		}
+	}
+	for _, m := range matches {
+		file := m[1]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		if !strings.HasPrefix(file, root+"/") || strings.Contains(file, "/node_modules/") ||
+			strings.Contains(file, "/site-packages/") {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		return file + ":" + m[2]
+	}
+	return ""
+}
+
+// trimFailureOutput keeps the start and the end of long failure output, where the message and the location of the
+// failure usually are.
+func trimFailureOutput(output string) string {
+	lines := strings.Split(output, "\n")
+	if len(lines) > maxFailureLines {
+		half := maxFailureLines / 2
+		omitted := fmt.Sprintf("… %d lines omitted …", len(lines)-maxFailureLines)
+		lines = append(append(lines[:half:half], omitted), lines[len(lines)-half:]...)
+		output = strings.Join(lines, "\n")
+	}
+	if len(output) > maxFailureOutput {
+		output = truncateUTF8(output, maxFailureOutput) + "…"
+	}
+	return output
+}
+
+// tail returns the last lines of output.
+func tail(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > maxFailureLines {
+		lines = lines[len(lines)-maxFailureLines:]
+	}
+	output = strings.Join(lines, "\n")
+	if len(output) > maxFailureOutput {
+		// The cut moves back to the start of the rune it falls in, so that the tail starts with a whole rune.
+		output = "…" + output[len(truncateUTF8(output, len(output)-maxFailureOutput)):]
+	}
+	return output
+}
+
+func truncateUTF8(s string, n int) string {
+	for n > 0 && n < len(s) && s[n]&0xc0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
+
+func stripANSI(s string) string {
+	return ansiEscape.ReplaceAllString(s, "")
+}
+
+// commandLine formats args the way they would be typed in a shell.
+func commandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\n'\"\\$`*?[]|&;<>()") {
+			a = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		}
+		quoted[i] = a
+	}
+	return strings.Join(quoted, " ")
+}
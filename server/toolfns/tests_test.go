@@ -0,0 +1,188 @@
+package toolfns
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// testProject creates the given files in a temporary directory, since locations are only reported for files that
+// exist, and returns it.
+func testProject(t *testing.T, files ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, name := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// readFixture returns a report from testdata, with the /ROOT the fixtures were captured in replaced by root.
+func readFixture(t *testing.T, name, root string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.ReplaceAll(string(data), "/ROOT", root)
+}
+
+func writeFixture(t *testing.T, name, root string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(readFixture(t, name, root)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func checkReport(t *testing.T, res TestReport, failures []TestFailure, want TestReport, wantFailures []TestFailure) {
+	t.Helper()
+	if res.Passed != want.Passed || res.Failed != want.Failed || res.Skipped != want.Skipped {
+		t.Errorf("passed, failed, skipped = %d, %d, %d, want %d, %d, %d", res.Passed, res.Failed, res.Skipped,
+			want.Passed, want.Failed, want.Skipped)
+	}
+	if len(failures) != len(wantFailures) {
+		t.Fatalf("failures = %+v, want %+v", failures, wantFailures)
+	}
+	for i, f := range failures {
+		w := wantFailures[i]
+		if f.Suite != w.Suite || f.Name != w.Name || f.Location != w.Location || !strings.HasPrefix(f.Output, w.Output) {
+			t.Errorf("failure %d = %+v, want %+v", i, f, w)
+		}
+	}
+}
+
+func TestGoTestEvents(t *testing.T) {
+	root := testProject(t, "calc/calc_test.go", "broken/broken_test.go")
+	var out strings.Builder
+	events := newGoTestEvents(&out)
+	// go test writes its output in chunks that do not end at lines.
+	input := readFixture(t, "gotest.json", root)
+	for len(input) > 0 {
+		n := min(len(input), 100)
+		events.Write([]byte(input[:n]))
+		input = input[n:]
+	}
+	if !strings.Contains(out.String(), "--- FAIL: TestAdd") {
+		t.Errorf("the output of the tests was not forwarded: %q", out.String())
+	}
+
+	var res TestReport
+	failures := events.report(&res, root, root)
+	checkReport(t, res, failures, TestReport{Passed: 2, Failed: 3, Skipped: 1}, []TestFailure{
+		{
+			Suite:    "example.com/gt/calc",
+			Name:     "TestAdd",
+			Location: root + "/calc/calc_test.go:7",
+			Output:   root + "/calc/calc_test.go:7: 1+1 = 2, want 3",
+		},
+		{
+			Suite:    "example.com/gt/calc",
+			Name:     "TestTable/neg",
+			Location: root + "/calc/calc_test.go:17",
+			Output:   root + "/calc/calc_test.go:17: wrong sign",
+		},
+		{
+			Suite:    "example.com/gt/broken",
+			Location: root + "/broken/broken_test.go:5",
+			Output:   "# example.com/gt/broken [example.com/gt/broken.test]\nbroken/broken_test.go:5:28: undefined: undefined",
+		},
+	})
+}
+
+func TestParseJestReport(t *testing.T) {
+	root := testProject(t, "math.test.js", "broken.test.js", "node_modules/expect/build/index.js")
+	var res TestReport
+	failures, err := parseJestReport(writeFixture(t, "jest.json", root), root, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReport(t, res, failures, TestReport{Passed: 1, Failed: 1, Skipped: 2}, []TestFailure{
+		{
+			Suite:    root + "/math.test.js",
+			Name:     "math adds",
+			Location: root + "/math.test.js:8",
+			Output:   "Error: expect(received).toBe(expected) // Object.is equality\n\nExpected: 3\nReceived: 2\n",
+		},
+		{
+			Suite:    root + "/broken.test.js",
+			Location: root + "/broken.test.js:1",
+			Output:   "  ● Test suite failed to run\n\n    Cannot find module './missing'",
+		},
+	})
+}
+
+func TestParsePytestReport(t *testing.T) {
+	root := testProject(t, "tests/test_api.py", "tests/test_broken.py")
+	var res TestReport
+	failures, err := parsePytestReport(writeFixture(t, "pytest.xml", root), root, root, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReport(t, res, failures, TestReport{Passed: 1, Failed: 2, Skipped: 1}, []TestFailure{
+		{
+			Name:     "tests.test_broken",
+			Location: root + "/tests/test_broken.py:1",
+			Output:   "ImportError while importing test module '" + root + "/tests/test_broken.py'.",
+		},
+		{
+			Suite:    "tests.test_api",
+			Name:     "test_sum",
+			Location: root + "/tests/test_api.py:6",
+			Output:   "def test_sum():\n        total = helpers.add(1, 1)\n>       assert total == 3",
+		},
+	})
+}
+
+func TestFindLocation(t *testing.T) {
+	root := testProject(t, "pkg/a_test.go", "src/app.test.js", "node_modules/lib/index.js", "tests/test_a.py",
+		"tests/helpers.py")
+	tests := []struct {
+		name   string
+		output string
+		re     string
+		dir    string
+		want   string
+	}{
+		{"absolute", root + "/pkg/a_test.go:12: got 1", "go", root, root + "/pkg/a_test.go:12"},
+		{"relative to dir", "a_test.go:3:1: undefined: x", "go", root + "/pkg", root + "/pkg/a_test.go:3"},
+		{"missing file", "pkg/gone_test.go:3: x\npkg/a_test.go:4: y", "go", root, root + "/pkg/a_test.go:4"},
+		{"outside the workspace", "/usr/lib/go/src/testing/testing.go:1: x", "go", root, ""},
+		{
+			"dependency",
+			"at f (" + root + "/node_modules/lib/index.js:1:2)\nat g (" + root + "/src/app.test.js:9:5)",
+			"jest", "", root + "/src/app.test.js:9",
+		},
+		{"pytest reports the failure last", "tests/helpers.py:3: in add\ntests/test_a.py:7: AssertionError", "pytest",
+			root, root + "/tests/test_a.py:7"},
+		{"no location", "panic: boom", "go", root, ""},
+	}
+	res := map[string]*regexp.Regexp{"go": goLocation, "jest": jestLocation, "pytest": pytestLocation}
+	for _, tt := range tests {
+		if got := findLocation(tt.output, res[tt.re], tt.dir, root); got != tt.want {
+			t.Errorf("%s: findLocation = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTail(t *testing.T) {
+	// The last maxFailureOutput bytes start in the middle of an é.
+	got := tail(strings.Repeat("é", maxFailureOutput) + "x")
+	if !utf8.ValidString(got) {
+		t.Errorf("tail cut a rune in half: %q", got[:10])
+	}
+	if n := len(strings.TrimPrefix(got, "…")); n < maxFailureOutput || n > maxFailureOutput+utf8.UTFMax {
+		t.Errorf("tail kept %d bytes, want %d", n, maxFailureOutput)
+	}
+	if got := tail("a\nb\n"); got != "a\nb" {
+		t.Errorf("tail of short output = %q, want it whole", got)
+	}
+}
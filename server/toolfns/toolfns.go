@@ -1,9 +1,13 @@
 package toolfns
 
 import (
-	"github.com/byte-sat/llum-tools/tools"
+	"bytes"
+	"io"
 	"log"
 	"os/exec"
+
+	"github.com/byte-sat/llum-tools/tools"
+	"github.com/zakkor/server/secrets"
 )
 
 // Note: Generated filename is significant. The init function for the generated file must run first.
@@ -15,24 +19,103 @@ func init() {
 	ToolGroups = []*Group{
 		NewGroup("System",
 			Shell,
-		),
+		).Describe("Runs commands on the machine hosting the tool server.", "terminal"),
+		NewGroup("Files",
+			ReadFile,
+			WriteFile,
+			EditFile,
+			DeleteFile,
+			ShareFile,
+		).Describe("Reads and changes files in the chat's workspace.", "file"),
+		NewGroup("Terminal",
+			TerminalSendKeys,
+			TerminalScreen,
+		).Describe("Drives an interactive terminal the user can watch and take over.", "monitor"),
+		NewGroup("Processes",
+			StartProcess,
+			ReadProcessOutput,
+			SendInput,
+			ListProcesses,
+			StopProcess,
+			PreviewURL,
+		).Describe("Runs dev servers, watchers and other long-running commands in the background.", "activity"),
+		NewGroup("Git",
+			GitStatus,
+			GitDiff,
+			GitLog,
+			GitShow,
+			GitBlame,
+			GitBranch,
+			GitCheckout,
+			GitCommit,
+			GitStash,
+		).Describe("Inspects and changes the git repository of the chat's workspace.", "git-branch"),
+		NewGroup("Search",
+			Search,
+			FindFiles,
+			PreviewReplace,
+			ApplyReplace,
+		).Describe("Finds text and files in the chat's workspace, and replaces text across files.", "search"),
+		NewGroup("Tests",
+			RunTests,
+		).Describe("Runs the tests of the project in the chat's workspace.", "check-square"),
+		NewGroup("Lint",
+			Lint,
+			FormatFiles,
+		).Describe("Checks and formats the code in the chat's workspace.", "check-circle"),
+		NewGroup("Docs",
+			GoDoc,
+			SearchDocs,
+			SemanticSearch,
+		).Describe("Looks up the documentation of the code the chat's workspace uses, and searches the indexed documents.", "book-open"),
 	}
 }
 
 type Group struct {
-	Name string      `json:"name"`
-	Repo *tools.Repo `json:"-"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Icon        string      `json:"icon,omitempty"`
+	Repo        *tools.Repo `json:"-"`
+	Functions   []Function  `json:"-"`
 }
 
 func NewGroup(name string, fns ...any) *Group {
-	repo, err := tools.New(nil, fns...)
+	repo, err := tools.New((*Invocation)(nil).injector(), fns...)
 	if err != nil {
 		log.Fatal(err)
 	}
-	return &Group{
+	group := &Group{
 		Name: name,
 		Repo: repo,
 	}
+	for i, fn := range repo.Schema() {
+		f := fromSchemaFunction(fn)
+		annotateFunction(&f, fns[i])
+		group.Functions = append(group.Functions, f)
+	}
+	return group
+}
+
+// Describe sets the description of the group and the name of the feather icon clients display for it.
+func (g *Group) Describe(description, icon string) *Group {
+	g.Description = description
+	g.Icon = icon
+	return g
+}
+
+// Invoke calls the named tool of the group on behalf of inv.
+func (g *Group) Invoke(inv *Invocation, name string, args map[string]any) (any, error) {
+	return g.Repo.Invoke(inv.injector(), name, args)
+}
+
+// Function returns the schema of the named tool, or nil if the group does not contain it.
+func (g *Group) Function(name string) *Function {
+	for i := range g.Functions {
+		if g.Functions[i].Name == name {
+			return &g.Functions[i]
+		}
+	}
+	return nil
 }
 
 type ContentTypeResponse struct {
@@ -40,13 +123,27 @@ type ContentTypeResponse struct {
 	Content     string `json:"content"`
 }
 
-// Executes the given bash command and returns the output of the command.
+// Executes the given bash command and returns the output of the command. The command gets no input, so use the
+// terminal tools for interactive commands.
 // command: The bash command to execute.
-func Shell(command string) string {
-	cmd := exec.Command("bash", "-c", command)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return err.Error() + "\n" + string(out)
+// [destructive, network, dryrun]
+func Shell(inv *Invocation, command string) (string, error) {
+	if inv.DryRun {
+		return previewShell(inv, command), nil
+	}
+	if err := inv.checkGitRewrite(command); err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(inv.Context(), "bash", "-c", command)
+	cmd.Dir = inv.Workspace
+	cmd.Env = secrets.ChildEnv(cmd)
+
+	var out bytes.Buffer
+	cmd.Stdout = io.MultiWriter(&out, inv.Progress)
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Run(); err != nil {
+		return err.Error() + "\n" + out.String(), nil
 	}
-	return string(out)
+	return out.String(), nil
 }
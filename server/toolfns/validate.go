@@ -0,0 +1,212 @@
+package toolfns
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/byte-sat/llum-tools/schema"
+)
+
+// FieldError describes why a single argument of a tool call is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validate checks args against the parameters of f. If coerce is set, strings holding numbers or booleans are
+// converted to the type the parameter expects. It returns the (possibly coerced) arguments, or an error with code
+// CodeInvalidArguments whose details list every invalid field.
+func (f *Function) Validate(args map[string]any, coerce bool) (map[string]any, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+
+	params := f.Parameters
+	if params.Type == "" {
+		params.Type = schema.Object
+	}
+
+	v := &validator{coerce: coerce}
+	out := v.validate("", &params, args).(map[string]any)
+	if len(v.errs) > 0 {
+		return nil, &Error{
+			Code:    CodeInvalidArguments,
+			Message: fmt.Sprintf("invalid arguments for %s: %s", f.Name, v.errs[0].Message),
+			Details: v.errs,
+		}
+	}
+	return out, nil
+}
+
+type validator struct {
+	coerce bool
+	errs   []FieldError
+}
+
+func (v *validator) fail(path, format string, args ...any) {
+	field := path
+	if field == "" {
+		field = "arguments"
+	}
+	v.errs = append(v.errs, FieldError{
+		Field:   field,
+		Message: field + ": " + fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validate(path string, def *Definition, val any) any {
+	if v.coerce {
+		val = coerce(def.Type, val)
+	}
+
+	switch def.Type {
+	case schema.Object:
+		obj, ok := val.(map[string]any)
+		if !ok {
+			v.fail(path, "expected an object, got %s", jsonType(val))
+			return val
+		}
+		return v.validateObject(path, def, obj)
+
+	case schema.Array:
+		arr, ok := val.([]any)
+		if !ok {
+			v.fail(path, "expected an array, got %s", jsonType(val))
+			return val
+		}
+		if def.Items == nil {
+			return arr
+		}
+		out := make([]any, len(arr))
+		for i, elem := range arr {
+			out[i] = v.validate(fmt.Sprintf("%s[%d]", path, i), def.Items, elem)
+		}
+		return out
+
+	case schema.String:
+		s, ok := val.(string)
+		if !ok {
+			v.fail(path, "expected a string, got %s", jsonType(val))
+			return val
+		}
+		if len(def.Enum) > 0 && !slices.Contains(def.Enum, s) {
+			v.fail(path, "must be one of %s, got %q", strings.Join(def.Enum, ", "), s)
+		}
+
+	case schema.Integer, schema.Number:
+		n, ok := val.(float64)
+		if !ok {
+			v.fail(path, "expected %s, got %s", def.Type, jsonType(val))
+			return val
+		}
+		if def.Type == schema.Integer && n != math.Trunc(n) {
+			v.fail(path, "expected an integer, got %v", n)
+		}
+		if def.Minimum != nil && n < *def.Minimum {
+			v.fail(path, "must be at least %v, got %v", *def.Minimum, n)
+		}
+		if def.Maximum != nil && n > *def.Maximum {
+			v.fail(path, "must be at most %v, got %v", *def.Maximum, n)
+		}
+
+	case schema.Boolean:
+		if _, ok := val.(bool); !ok {
+			v.fail(path, "expected a boolean, got %s", jsonType(val))
+		}
+	}
+	return val
+}
+
+func (v *validator) validateObject(path string, def *Definition, obj map[string]any) map[string]any {
+	out := make(map[string]any, len(obj))
+
+	// llum-tools describes maps as objects whose values all match Items.
+	if def.Items != nil && len(def.Properties) == 0 {
+		for key, val := range obj {
+			out[key] = v.validate(joinPath(path, key), def.Items, val)
+		}
+		return out
+	}
+
+	for _, prop := range def.Properties {
+		if _, ok := obj[prop.Name]; ok {
+			continue
+		}
+		switch {
+		case prop.Default != nil:
+			out[prop.Name] = prop.Default
+		case def.IsRequired(prop.Name):
+			v.fail(joinPath(path, prop.Name), "missing required argument")
+		default:
+			// Tools are invoked with every parameter and every field of the objects they take, so omitted optional
+			// ones get their zero value.
+			out[prop.Name] = prop.zero()
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		prop := def.Property(key)
+		if prop == nil {
+			v.fail(joinPath(path, key), "unexpected argument")
+			continue
+		}
+		out[key] = v.validate(joinPath(path, key), prop, obj[key])
+	}
+	return out
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// coerce converts strings to the numbers or booleans t expects, returning val unchanged if that is not possible.
+func coerce(t schema.Type, val any) any {
+	s, ok := val.(string)
+	if !ok {
+		return val
+	}
+
+	s = strings.TrimSpace(s)
+	switch t {
+	case schema.Integer, schema.Number:
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+	case schema.Boolean:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return val
+}
+
+func jsonType(val any) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", val)
+	}
+}
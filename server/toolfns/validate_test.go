@@ -0,0 +1,136 @@
+package toolfns
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/byte-sat/llum-tools/schema"
+)
+
+func float(f float64) *float64 { return &f }
+
+// testFunction takes a required string with an enum, an optional integer with a range and a default, an optional
+// boolean, and an optional object with a required and an optional field.
+var testFunction = &Function{
+	Name: "Test",
+	Parameters: Definition{
+		Type: schema.Object,
+		Properties: Properties{
+			{Name: "mode", Definition: Definition{Type: schema.String, Enum: []string{"fast", "slow"}}},
+			{Name: "limit", Definition: Definition{Type: schema.Integer, Minimum: float(1), Maximum: float(10),
+				Default: float64(5)}},
+			{Name: "verbose", Definition: Definition{Type: schema.Boolean}},
+			{Name: "target", Definition: Definition{
+				Type: schema.Object,
+				Properties: Properties{
+					{Name: "path", Definition: Definition{Type: schema.String}},
+					{Name: "depth", Definition: Definition{Type: schema.Integer}},
+					{Name: "tags", Definition: Definition{Type: schema.Array, Items: &Definition{Type: schema.String}}},
+				},
+				Required: []string{"path"},
+			}},
+		},
+		Required: []string{"mode"},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   map[string]any
+		coerce bool
+		want   map[string]any
+		// fields are the fields of the errors, if the arguments are invalid.
+		fields []string
+	}{
+		{
+			name: "defaults and zero values",
+			args: map[string]any{"mode": "fast"},
+			want: map[string]any{"mode": "fast", "limit": float64(5), "verbose": false, "target": map[string]any{}},
+		},
+		{
+			name: "nested optional fields",
+			args: map[string]any{"mode": "slow", "limit": float64(10), "target": map[string]any{"path": "a"}},
+			want: map[string]any{"mode": "slow", "limit": float64(10), "verbose": false,
+				"target": map[string]any{"path": "a", "depth": float64(0), "tags": []any{}}},
+		},
+		{
+			name:   "missing required",
+			args:   map[string]any{},
+			fields: []string{"mode"},
+		},
+		{
+			name:   "missing required nested",
+			args:   map[string]any{"mode": "fast", "target": map[string]any{"depth": float64(1)}},
+			fields: []string{"target.path"},
+		},
+		{
+			name:   "enum",
+			args:   map[string]any{"mode": "medium"},
+			fields: []string{"mode"},
+		},
+		{
+			name:   "min and max",
+			args:   map[string]any{"mode": "fast", "limit": float64(0)},
+			fields: []string{"limit"},
+		},
+		{
+			name:   "above max",
+			args:   map[string]any{"mode": "fast", "limit": float64(11)},
+			fields: []string{"limit"},
+		},
+		{
+			name:   "not an integer",
+			args:   map[string]any{"mode": "fast", "limit": 2.5},
+			fields: []string{"limit"},
+		},
+		{
+			name:   "type mismatch",
+			args:   map[string]any{"mode": float64(1), "verbose": "yes"},
+			fields: []string{"mode", "verbose"},
+		},
+		{
+			name:   "nested type mismatch",
+			args:   map[string]any{"mode": "fast", "target": map[string]any{"path": "a", "tags": []any{"x", float64(1)}}},
+			fields: []string{"target.tags[1]"},
+		},
+		{
+			name:   "unexpected argument",
+			args:   map[string]any{"mode": "fast", "target": map[string]any{"path": "a", "size": float64(1)}},
+			fields: []string{"target.size"},
+		},
+		{
+			name:   "coerced",
+			args:   map[string]any{"mode": "fast", "limit": "3", "verbose": "true"},
+			coerce: true,
+			want:   map[string]any{"mode": "fast", "limit": float64(3), "verbose": true, "target": map[string]any{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testFunction.Validate(tt.args, tt.coerce)
+			if tt.fields != nil {
+				var terr *Error
+				if !errors.As(err, &terr) || terr.Code != CodeInvalidArguments {
+					t.Fatalf("Validate() error = %v, want invalid arguments", err)
+				}
+				var fields []string
+				for _, e := range terr.Details.([]FieldError) {
+					fields = append(fields, e.Field)
+				}
+				if !slices.Equal(fields, tt.fields) {
+					t.Errorf("Validate() invalid fields = %v, want %v", fields, tt.fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
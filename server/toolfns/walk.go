@@ -0,0 +1,255 @@
+package toolfns
+
+import (
+	"bufio"
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// glob is a compiled .gitignore pattern. The include and exclude globs of tools use the same syntax.
+type glob struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// compileGlob compiles a pattern with the semantics of .gitignore: a pattern without a slash matches a name at any
+// depth, other patterns are relative to the directory they are defined in, and ** matches any number of directories.
+func compileGlob(pattern string) (glob, bool) {
+	var g glob
+	if strings.HasPrefix(pattern, "!") {
+		g.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		g.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return g, false
+	}
+
+	var re strings.Builder
+	if strings.Contains(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+		re.WriteString("^")
+	} else {
+		re.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			re.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case ch == '*':
+			re.WriteString("[^/]*")
+		case ch == '?':
+			re.WriteString("[^/]")
+		case ch == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case ch == '\\' && i+1 < len(pattern):
+			i++
+			re.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return g, false
+	}
+	g.re = compiled
+	return g, true
+}
+
+func (g glob) match(rel string, isDir bool) bool {
+	return (isDir || !g.dirOnly) && g.re.MatchString(rel)
+}
+
+// globs is a list of globs that matches a path if any of them does.
+type globs []glob
+
+func compileGlobs(patterns []string) (globs, error) {
+	var gs globs
+	for _, p := range patterns {
+		g, ok := compileGlob(p)
+		if !ok || g.negate {
+			return nil, Errorf(CodeInvalidArguments, "invalid glob: %s", p)
+		}
+		gs = append(gs, g)
+	}
+	return gs, nil
+}
+
+func (gs globs) match(rel string, isDir bool) bool {
+	for _, g := range gs {
+		if g.match(rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreRules are the patterns of the .gitignore file of a directory, on top of the rules of its parent.
+type ignoreRules struct {
+	parent *ignoreRules
+	// dir is the directory, relative to the root of the walk, with a trailing slash unless it is the root.
+	dir      string
+	patterns []glob
+}
+
+// loadIgnoreRules reads the .gitignore file of dir, whose path relative to the root is rel.
+func loadIgnoreRules(parent *ignoreRules, dir, rel string) *ignoreRules {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return parent
+	}
+	defer f.Close()
+
+	rules := &ignoreRules{parent: parent}
+	if rel != "" {
+		rules.dir = rel + "/"
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Trailing spaces are ignored unless they are escaped.
+		if trimmed := strings.TrimRight(line, " "); !strings.HasSuffix(trimmed, `\`) {
+			line = trimmed
+		}
+		if g, ok := compileGlob(line); ok {
+			rules.patterns = append(rules.patterns, g)
+		}
+	}
+	return rules
+}
+
+// ignored reports whether rel is ignored. The last pattern that matches decides, and patterns of deeper directories
+// take precedence.
+func (r *ignoreRules) ignored(rel string, isDir bool) bool {
+	for ; r != nil; r = r.parent {
+		sub, ok := strings.CutPrefix(rel, r.dir)
+		if !ok {
+			continue
+		}
+		for i := len(r.patterns) - 1; i >= 0; i-- {
+			if r.patterns[i].match(sub, isDir) {
+				return !r.patterns[i].negate
+			}
+		}
+	}
+	return false
+}
+
+// walkFiles calls fn for every file under start, a directory of the workspace, that is not ignored by the
+// .gitignore files of the workspace, or excluded. Directories are read in parallel, so fn is called concurrently, by
+// as many goroutines at a time as there are CPUs. rel is relative to the workspace and uses slashes. The walk stops
+// early when ctx is done, or when fn panics, which is returned as an error.
+func walkFiles(ctx context.Context, workspace, start string, exclude globs, fn func(rel string, d fs.DirEntry)) error {
+	if start == "." {
+		start = ""
+	}
+	if info, err := os.Stat(filepath.Join(workspace, start)); err != nil || !info.IsDir() {
+		return Errorf(CodeNotFound, "directory not found: %s", start)
+	}
+
+	// The rules of the directories above start apply too.
+	var rules *ignoreRules
+	rel := ""
+	for _, name := range strings.Split(start, "/") {
+		if name == "" {
+			break
+		}
+		rules = loadIgnoreRules(rules, filepath.Join(workspace, rel), rel)
+		rel = path.Join(rel, name)
+		if rules.ignored(rel, true) {
+			return nil
+		}
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, runtime.NumCPU())
+
+		panicOnce sync.Once
+		panicErr  error
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	call := func(rel string, d fs.DirEntry) {
+		sem <- struct{}{}
+		defer func() {
+			<-sem
+			// The walk runs in its own goroutines, where a panic would take down the server.
+			if r := recover(); r != nil {
+				panicOnce.Do(func() {
+					panicErr = Errorf(CodeInternal, "%s: %v", rel, r)
+					cancel()
+				})
+			}
+		}()
+		fn(rel, d)
+	}
+	var walkDir func(rel string, rules *ignoreRules)
+	walkDir = func(rel string, rules *ignoreRules) {
+		defer wg.Done()
+		sem <- struct{}{}
+		entries, err := os.ReadDir(filepath.Join(workspace, rel))
+		rules = loadIgnoreRules(rules, filepath.Join(workspace, rel), rel)
+		<-sem
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			if ctx.Err() != nil {
+				return
+			}
+			child := path.Join(rel, e.Name())
+			isDir := e.IsDir()
+			if e.Name() == ".git" || rules.ignored(child, isDir) || exclude.match(child, isDir) {
+				continue
+			}
+			if isDir {
+				wg.Add(1)
+				go walkDir(child, rules)
+			} else if e.Type().IsRegular() {
+				call(child, e)
+			}
+		}
+	}
+	wg.Add(1)
+	walkDir(start, rules)
+	wg.Wait()
+	return panicErr
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/byte-sat/llum-tools/schema"
+	"github.com/zakkor/server/toolfns"
+)
+
+type encodedGroup struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description,omitempty"`
+	Icon        string                  `json:"icon,omitempty"`
+	Schema      []toolfns.Function      `json:"schema"`
+	Errors      []toolfns.ErrorCodeInfo `json:"errors"`
+}
+
+// ToolSchema serves the tool definitions. By default they are grouped in llum's own format; the format query
+// parameter selects the tool definitions expected by a provider's function calling API instead.
+func (tr *ToolHandler) ToolSchema(w http.ResponseWriter, r *http.Request) {
+	var encodedGroups []encodedGroup
+	var functions []toolfns.Function
+	for _, group := range tr.Groups {
+		encodedGroups = append(encodedGroups, encodedGroup{
+			Name:        group.Name,
+			Description: group.Description,
+			Icon:        group.Icon,
+			Schema:      group.Functions,
+			Errors:      toolfns.ErrorCodes,
+		})
+		functions = append(functions, group.Functions...)
+	}
+
+	var (
+		v    any
+		terr *toolfns.Error
+	)
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "llum":
+		v = encodedGroups
+	case "openai":
+		v, terr = openAITools(functions)
+	case "anthropic":
+		v, terr = anthropicTools(functions)
+	case "gemini":
+		v, terr = geminiTools(functions)
+	case "mcp":
+		v, terr = mcpTools(functions)
+	default:
+		terr = toolfns.Errorf(toolfns.CodeInvalidArguments, "unknown schema format: %s", format)
+	}
+	if terr != nil {
+		writeError(w, terr)
+		return
+	}
+
+	version, err := json.Marshal(encodedGroups)
+	if err != nil {
+		writeError(w, toolfns.Errorf(toolfns.CodeInternal, "encode schema: %v", err))
+		return
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		writeError(w, toolfns.Errorf(toolfns.CodeInternal, "encode schema: %v", err))
+		return
+	}
+
+	// The version only changes when the tools do, while the ETag also differs between formats.
+	etag := `"` + shortHash(b) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Tool-Schema-Version", shortHash(version))
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// etagMatches reports whether the If-None-Match header lists etag. The comparison is weak, as RFC 9110 requires.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func shortHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// schemaFormat holds the limits a provider puts on tool definitions.
+type schemaFormat struct {
+	namePattern    *regexp.Regexp
+	maxName        int
+	maxDescription int
+	// maxDepth is the deepest parameter nesting allowed, deeper objects are passed without their properties.
+	maxDepth int
+	// openAPI providers only understand a subset of JSON schema, with upper case type names.
+	openAPI bool
+}
+
+var (
+	openAIFormat = schemaFormat{
+		namePattern:    regexp.MustCompile(`[^a-zA-Z0-9_-]`),
+		maxName:        64,
+		maxDescription: 1024,
+		maxDepth:       5,
+	}
+	anthropicFormat = schemaFormat{
+		namePattern: regexp.MustCompile(`[^a-zA-Z0-9_-]`),
+		maxName:     64,
+	}
+	geminiFormat = schemaFormat{
+		namePattern: regexp.MustCompile(`[^a-zA-Z0-9_.-]`),
+		maxName:     64,
+		maxDepth:    5,
+		openAPI:     true,
+	}
+	mcpFormat = schemaFormat{
+		namePattern: regexp.MustCompile(`[^a-zA-Z0-9_.-]`),
+		maxName:     128,
+	}
+)
+
+func (f schemaFormat) name(name string) string {
+	name = f.namePattern.ReplaceAllString(name, "_")
+	if len(name) > f.maxName {
+		name = name[:f.maxName]
+	}
+	return name
+}
+
+// names converts the names of functions. It fails if two of them convert to the same name, since calls to either
+// could not be told apart.
+func (f schemaFormat) names(functions []toolfns.Function) ([]string, *toolfns.Error) {
+	names := make([]string, len(functions))
+	seen := make(map[string]string)
+	for i, fn := range functions {
+		name := f.name(fn.Name)
+		if other, ok := seen[name]; ok {
+			return nil, toolfns.Errorf(toolfns.CodeInternal, "tools %s and %s are both named %s", other, fn.Name, name)
+		}
+		seen[name] = fn.Name
+		names[i] = name
+	}
+	return names, nil
+}
+
+func (f schemaFormat) description(desc string) string {
+	if f.maxDescription > 0 && len(desc) > f.maxDescription {
+		desc = strings.ToValidUTF8(desc[:f.maxDescription-3], "") + "..."
+	}
+	return desc
+}
+
+// parameters converts the parameters of a tool. Every provider expects an object, even for tools without arguments.
+func (f schemaFormat) parameters(def toolfns.Definition) toolfns.Definition {
+	if def.Type == "" {
+		def.Type = schema.Object
+	}
+	return f.definition(def, 1)
+}
+
+func (f schemaFormat) definition(def toolfns.Definition, depth int) toolfns.Definition {
+	def.Description = f.description(def.Description)
+	if f.maxDepth > 0 && depth > f.maxDepth && def.Type == schema.Object {
+		return toolfns.Definition{Type: f.typ(def.Type), Description: def.Description}
+	}
+
+	if def.Properties != nil {
+		props := make(toolfns.Properties, len(def.Properties))
+		for i, prop := range def.Properties {
+			props[i] = toolfns.Property{Name: prop.Name, Definition: f.definition(prop.Definition, depth+1)}
+		}
+		def.Properties = props
+	}
+	if def.Items != nil {
+		items := f.definition(*def.Items, depth+1)
+		def.Items = &items
+	}
+
+	if f.openAPI {
+		def.Default = nil
+		def.Examples = nil
+		// llum-tools describes maps as objects with items, which OpenAPI does not allow.
+		if def.Type == schema.Object {
+			def.Items = nil
+		}
+	}
+	def.Type = f.typ(def.Type)
+	return def
+}
+
+func (f schemaFormat) typ(t schema.Type) schema.Type {
+	if f.openAPI {
+		return schema.Type(strings.ToUpper(string(t)))
+	}
+	return t
+}
+
+type openAITool struct {
+	Type     string         `json:"type"`
+	Function openAIFunction `json:"function"`
+}
+
+type openAIFunction struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Parameters  toolfns.Definition `json:"parameters"`
+}
+
+func openAITools(functions []toolfns.Function) ([]openAITool, *toolfns.Error) {
+	names, err := openAIFormat.names(functions)
+	if err != nil {
+		return nil, err
+	}
+	tools := []openAITool{}
+	for i, fn := range functions {
+		tools = append(tools, openAITool{
+			Type: "function",
+			Function: openAIFunction{
+				Name:        names[i],
+				Description: openAIFormat.description(fn.Description),
+				Parameters:  openAIFormat.parameters(fn.Parameters),
+			},
+		})
+	}
+	return tools, nil
+}
+
+type anthropicTool struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	InputSchema toolfns.Definition `json:"input_schema"`
+}
+
+func anthropicTools(functions []toolfns.Function) ([]anthropicTool, *toolfns.Error) {
+	names, err := anthropicFormat.names(functions)
+	if err != nil {
+		return nil, err
+	}
+	tools := []anthropicTool{}
+	for i, fn := range functions {
+		tools = append(tools, anthropicTool{
+			Name:        names[i],
+			Description: anthropicFormat.description(fn.Description),
+			InputSchema: anthropicFormat.parameters(fn.Parameters),
+		})
+	}
+	return tools, nil
+}
+
+type geminiFunction struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Parameters  *toolfns.Definition `json:"parameters,omitempty"`
+}
+
+func geminiTools(functions []toolfns.Function) (map[string][]geminiFunction, *toolfns.Error) {
+	names, err := geminiFormat.names(functions)
+	if err != nil {
+		return nil, err
+	}
+	decls := []geminiFunction{}
+	for i, fn := range functions {
+		decl := geminiFunction{
+			Name:        names[i],
+			Description: geminiFormat.description(fn.Description),
+		}
+		// Gemini rejects parameter objects without properties.
+		if len(fn.Parameters.Properties) > 0 {
+			params := geminiFormat.parameters(fn.Parameters)
+			decl.Parameters = &params
+		}
+		decls = append(decls, decl)
+	}
+	return map[string][]geminiFunction{"functionDeclarations": decls}, nil
+}
+
+type mcpTool struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	InputSchema toolfns.Definition `json:"inputSchema"`
+	Annotations mcpAnnotations     `json:"annotations"`
+}
+
+type mcpAnnotations struct {
+	ReadOnlyHint    bool `json:"readOnlyHint"`
+	DestructiveHint bool `json:"destructiveHint"`
+	IdempotentHint  bool `json:"idempotentHint"`
+	OpenWorldHint   bool `json:"openWorldHint"`
+}
+
+func mcpTools(functions []toolfns.Function) (map[string][]mcpTool, *toolfns.Error) {
+	names, err := mcpFormat.names(functions)
+	if err != nil {
+		return nil, err
+	}
+	tools := []mcpTool{}
+	for i, fn := range functions {
+		tools = append(tools, mcpTool{
+			Name:        names[i],
+			Description: mcpFormat.description(fn.Description),
+			InputSchema: mcpFormat.parameters(fn.Parameters),
+			Annotations: mcpAnnotations{
+				ReadOnlyHint:    fn.Annotations.ReadOnly,
+				DestructiveHint: fn.Annotations.Destructive,
+				IdempotentHint:  fn.Annotations.Idempotent,
+				OpenWorldHint:   fn.Annotations.RequiresNetwork,
+			},
+		})
+	}
+	return map[string][]mcpTool{"tools": tools}, nil
+}
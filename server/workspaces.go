@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zakkor/server/toolfns"
+	"github.com/zakkor/server/workspaces"
+)
+
+// defaultChatID is the workspace shared by tool calls and uploads made outside of a chat.
+const defaultChatID = "default"
+
+// workspace returns the directory of chatID's workspace, creating it if needed.
+func (tr *ToolHandler) workspace(chatID string) (string, *toolfns.Error) {
+	dir, err := tr.Workspaces.Get(chatID)
+	if err != nil {
+		return "", toWorkspaceError(err)
+	}
+	return dir, nil
+}
+
+// existingWorkspace returns the directory of chatID's workspace, without creating it.
+func (tr *ToolHandler) existingWorkspace(chatID string) (string, *toolfns.Error) {
+	dir, err := tr.Workspaces.Path(chatID)
+	if err != nil {
+		return "", toWorkspaceError(err)
+	}
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return "", toWorkspaceError(workspaces.ErrNotFound)
+	} else if err != nil {
+		return "", toWorkspaceError(err)
+	}
+	return dir, nil
+}
+
+func toWorkspaceError(err error) *toolfns.Error {
+	switch {
+	case errors.Is(err, workspaces.ErrInvalidChatID), errors.Is(err, workspaces.ErrInvalidCallID):
+		return toolfns.Errorf(toolfns.CodeInvalidArguments, "%v", err)
+	case errors.Is(err, workspaces.ErrNotFound), errors.Is(err, workspaces.ErrCheckpointNotFound):
+		return toolfns.Errorf(toolfns.CodeNotFound, "%v", err)
+	default:
+		return toolfns.Errorf(toolfns.CodeInternal, "%v", err)
+	}
+}
+
+func (tr *ToolHandler) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	list, err := tr.Workspaces.List()
+	if err != nil {
+		writeError(w, toWorkspaceError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: list})
+}
+
+func (tr *ToolHandler) DeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	tr.Terminals.Close(chi.URLParam(r, "chat_id"))
+	tr.Processes.StopChat(chi.URLParam(r, "chat_id"))
+	if err := tr.Workspaces.Delete(chi.URLParam(r, "chat_id")); err != nil {
+		writeError(w, toWorkspaceError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, toolResponse{OK: true})
+}
+
+// ExportWorkspace downloads a workspace as a gzipped tarball.
+func (tr *ToolHandler) ExportWorkspace(w http.ResponseWriter, r *http.Request) {
+	chatID := chi.URLParam(r, "chat_id")
+	if _, err := tr.Workspaces.Path(chatID); err != nil {
+		writeError(w, toWorkspaceError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+chatID+`.tar.gz"`)
+	if err := tr.Workspaces.Export(chatID, w); err != nil {
+		// Once the archive is being streamed, the status can no longer change.
+		if errors.Is(err, workspaces.ErrNotFound) {
+			w.Header().Del("Content-Disposition")
+			writeError(w, toWorkspaceError(err))
+		}
+		return
+	}
+}
+
+func (tr *ToolHandler) ListSnapshots(w http.ResponseWriter, r *http.Request) {
+	list, err := tr.Workspaces.Snapshots(chi.URLParam(r, "chat_id"))
+	if err != nil {
+		writeError(w, toWorkspaceError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: list})
+}
+
+func (tr *ToolHandler) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	snap, err := tr.Workspaces.Snapshot(chi.URLParam(r, "chat_id"))
+	if err != nil {
+		writeError(w, toWorkspaceError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: snap})
+}
+
+// checkpoint records the workspace of call before it runs. Failing to do so does not stop the call, but is reported
+// with its result.
+func (tr *ToolHandler) checkpoint(call toolCall) error {
+	// Calls without an ID are still checkpointed, but can only be found by listing.
+	id := call.ID
+	if id == "" {
+		id = "call_" + newJobID()
+	}
+	if _, err := tr.Workspaces.Checkpoint(call.ChatID, id, call.Name); err != nil {
+		slog.Warn("checkpoint workspace", "chat_id", call.ChatID, "call_id", id, "err", err)
+		return err
+	}
+	return nil
+}
+
+func (tr *ToolHandler) ListCheckpoints(w http.ResponseWriter, r *http.Request) {
+	list, err := tr.Workspaces.Checkpoints(chi.URLParam(r, "chat_id"))
+	if err != nil {
+		writeError(w, toWorkspaceError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: list})
+}
+
+// DiffCheckpoints returns the unified diff from the checkpoint of call `from` to that of call `to`, or to the
+// current workspace if `to` is omitted.
+func (tr *ToolHandler) DiffCheckpoints(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	diff, err := tr.Workspaces.Diff(chi.URLParam(r, "chat_id"), q.Get("from"), q.Get("to"))
+	if err != nil {
+		writeError(w, toWorkspaceError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: diff})
+}
+
+// RestoreCheckpoint reverts a workspace to its state before the given call. The replaced state is checkpointed
+// under a new ID, which is returned.
+func (tr *ToolHandler) RestoreCheckpoint(w http.ResponseWriter, r *http.Request) {
+	restoreID := "restore_" + newJobID()
+	if err := tr.Workspaces.Restore(chi.URLParam(r, "chat_id"), chi.URLParam(r, "call_id"), restoreID); err != nil {
+		writeError(w, toWorkspaceError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, toolResponse{OK: true, Result: map[string]string{"restore_id": restoreID}})
+}
@@ -0,0 +1,169 @@
+package workspaces
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Snapshot struct {
+	ID        string    `json:"id"`
+	ChatID    string    `json:"chat_id"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Export writes chatID's workspace to w as a gzipped tarball.
+func (m *Manager) Export(chatID string, w io.Writer) error {
+	path, err := m.Path(chatID)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return writeArchive(w, path)
+}
+
+// Snapshot saves the current state of chatID's workspace.
+func (m *Manager) Snapshot(chatID string) (Snapshot, error) {
+	if _, err := m.Path(chatID); err != nil {
+		return Snapshot{}, err
+	}
+	dir := filepath.Join(m.snapshots, chatID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Snapshot{}, err
+	}
+
+	now := time.Now()
+	id := now.UTC().Format("20060102T150405.000000000")
+	f, err := os.Create(filepath.Join(dir, id+".tar.gz"))
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer f.Close()
+
+	if err := m.Export(chatID, f); err != nil {
+		os.Remove(f.Name())
+		return Snapshot{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if err := m.pruneSnapshots(chatID); err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{ID: id, ChatID: chatID, Size: info.Size(), CreatedAt: now}, nil
+}
+
+// pruneSnapshots deletes the oldest snapshots of chatID's workspace beyond the ones it keeps.
+func (m *Manager) pruneSnapshots(chatID string) error {
+	if m.opts.MaxSnapshots <= 0 {
+		return nil
+	}
+	list, err := m.Snapshots(chatID)
+	if err != nil {
+		return err
+	}
+	for _, snap := range list[:max(len(list)-m.opts.MaxSnapshots, 0)] {
+		if err := os.Remove(filepath.Join(m.snapshots, chatID, snap.ID+".tar.gz")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Snapshots lists the snapshots of chatID's workspace, oldest first.
+func (m *Manager) Snapshots(chatID string) ([]Snapshot, error) {
+	if _, err := m.Path(chatID); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(m.snapshots, chatID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := []Snapshot{}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".tar.gz")
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		createdAt, _ := time.Parse("20060102T150405.000000000", id)
+		list = append(list, Snapshot{ID: id, ChatID: chatID, Size: info.Size(), CreatedAt: createdAt})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func writeArchive(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if d.Type()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", dir, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,405 @@
+package workspaces
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zakkor/server/secrets"
+)
+
+// Checkpoints record the state of a workspace in a git repository kept outside of it, so that they work for any
+// workspace and never show up in it. Files ignored by the workspace's .gitignore are not recorded, nor are the files
+// of repositories cloned inside it that their own .gitignore ignores.
+
+var (
+	ErrInvalidCallID      = errors.New("invalid call ID")
+	ErrCheckpointNotFound = errors.New("checkpoint not found")
+)
+
+var callIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}$`)
+
+type Checkpoint struct {
+	CallID    string    `json:"call_id"`
+	Label     string    `json:"label"`
+	Commit    string    `json:"commit"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Checkpoint records the current state of chatID's workspace under callID, the call about to modify it.
+func (m *Manager) Checkpoint(chatID, callID, label string) (Checkpoint, error) {
+	repo, err := m.checkpointRepo(chatID)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	l := m.lock(chatID)
+	l.git.Lock()
+	defer l.git.Unlock()
+
+	c, err := m.checkpoint(repo, callID, label)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	return c, m.pruneCheckpoints(chatID, repo)
+}
+
+func (m *Manager) checkpoint(repo *checkpointRepo, callID, label string) (Checkpoint, error) {
+	if !callIDRegex.MatchString(callID) {
+		return Checkpoint{}, fmt.Errorf("%w: %q", ErrInvalidCallID, callID)
+	}
+
+	tree, err := repo.tree()
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	// The creation time goes in the body, as commit dates only have a resolution of seconds.
+	createdAt := time.Now()
+	commit, err := repo.git("commit-tree", tree, "-m", label, "-m", createdAt.Format(time.RFC3339Nano))
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if _, err := repo.git("update-ref", "refs/checkpoints/"+callID, commit); err != nil {
+		return Checkpoint{}, err
+	}
+	return Checkpoint{CallID: callID, Label: label, Commit: commit, CreatedAt: createdAt}, nil
+}
+
+// Checkpoints lists the checkpoints of chatID's workspace, oldest first.
+func (m *Manager) Checkpoints(chatID string) ([]Checkpoint, error) {
+	repo, err := m.checkpointRepo(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := repo.git("for-each-ref",
+		"--format=%(refname:lstrip=2)%09%(objectname)%09%(contents:subject)%09%(contents:body)%00", "refs/checkpoints")
+	if err != nil {
+		return nil, err
+	}
+
+	list := []Checkpoint{}
+	for _, record := range strings.Split(out, "\x00") {
+		fields := strings.SplitN(strings.TrimSpace(record), "\t", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		createdAt, _ := time.Parse(time.RFC3339Nano, strings.TrimSpace(fields[3]))
+		list = append(list, Checkpoint{CallID: fields[0], Commit: fields[1], CreatedAt: createdAt, Label: fields[2]})
+	}
+	slices.SortFunc(list, func(a, b Checkpoint) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return list, nil
+}
+
+// pruneCheckpoints deletes the oldest checkpoints of chatID's workspace beyond the ones it keeps, and the objects only
+// they used. It waits until there are a quarter more than that, since collecting the objects takes a while.
+func (m *Manager) pruneCheckpoints(chatID string, repo *checkpointRepo) error {
+	if m.opts.MaxCheckpoints <= 0 {
+		return nil
+	}
+	out, err := repo.git("for-each-ref", "--format=%(refname)", "refs/checkpoints")
+	if err != nil || strings.Count(out, "\n")+1 <= m.opts.MaxCheckpoints+m.opts.MaxCheckpoints/4 {
+		return err
+	}
+	list, err := m.Checkpoints(chatID)
+	if err != nil {
+		return err
+	}
+	for _, c := range list[:len(list)-m.opts.MaxCheckpoints] {
+		if _, err := repo.git("update-ref", "-d", "refs/checkpoints/"+c.CallID); err != nil {
+			return err
+		}
+	}
+	_, err = repo.git("gc", "--quiet", "--prune=now")
+	return err
+}
+
+// Diff returns the changes between the checkpoints of two calls as a unified diff. An empty to compares with the
+// current state of the workspace.
+func (m *Manager) Diff(chatID, from, to string) (string, error) {
+	repo, err := m.checkpointRepo(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	fromRev, err := repo.rev(from)
+	if err != nil {
+		return "", err
+	}
+	var toRev string
+	if to == "" {
+		l := m.lock(chatID)
+		l.git.Lock()
+		toRev, err = repo.tree()
+		l.git.Unlock()
+	} else {
+		toRev, err = repo.rev(to)
+	}
+	if err != nil {
+		return "", err
+	}
+	return repo.git("diff", "--no-color", "--no-ext-diff", fromRev, toRev)
+}
+
+// Restore returns chatID's workspace to its state before callID. The state it is replacing is checkpointed first
+// under restoreID, so the restore can itself be undone. It waits for the calls changing the workspace to end, and
+// holds off new ones until it is done.
+func (m *Manager) Restore(chatID, callID, restoreID string) error {
+	repo, err := m.checkpointRepo(chatID)
+	if err != nil {
+		return err
+	}
+	l := m.lock(chatID)
+	l.calls.Lock()
+	defer l.calls.Unlock()
+	l.git.Lock()
+	defer l.git.Unlock()
+
+	rev, err := repo.rev(callID)
+	if err != nil {
+		return err
+	}
+	if _, err := m.checkpoint(repo, restoreID, "restore "+callID); err != nil {
+		return err
+	}
+	// The checkpoint staged every file, so files created after callID are removed as well.
+	if _, err = repo.git("read-tree", "-u", "--reset", rev); err != nil {
+		return err
+	}
+	// Checkpoints are only pruned now, as the one restored may be among the oldest.
+	return m.pruneCheckpoints(chatID, repo)
+}
+
+type checkpointRepo struct {
+	gitDir, workTree string
+}
+
+func (m *Manager) checkpointRepo(chatID string) (*checkpointRepo, error) {
+	workTree, err := m.Path(chatID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(workTree); errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	repo := &checkpointRepo{
+		gitDir:   filepath.Join(m.checkpoints, chatID+".git"),
+		workTree: workTree,
+	}
+	if _, err := os.Stat(repo.gitDir); errors.Is(err, fs.ErrNotExist) {
+		// Without a template, the repository has no sample hooks, which would count against the quota.
+		cmd := exec.Command("git", "init", "--quiet", "--bare", "--template=", repo.gitDir)
+		cmd.Env = secrets.ChildEnv(cmd)
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("create checkpoint repository: %w", err)
+		}
+	}
+	return repo, nil
+}
+
+// tree stages the whole workspace and returns the resulting tree. git stages the repositories cloned inside the
+// workspace as links to their commits, which would leave changes to their files out of checkpoints, so their files
+// are staged instead.
+func (r *checkpointRepo) tree() (string, error) {
+	if _, err := r.git("add", "--all", "."); err != nil {
+		return "", err
+	}
+	repos, err := r.nestedRepos()
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range repos {
+		if err := r.stageRepo(dir); err != nil {
+			return "", err
+		}
+	}
+	return r.git("write-tree")
+}
+
+// nestedRepos returns the outermost repositories inside the workspace, which git add staged as links, or whose files
+// were staged by an earlier checkpoint.
+func (r *checkpointRepo) nestedRepos() ([]string, error) {
+	out, err := r.git("ls-files", "-z", "--stage")
+	if err != nil {
+		return nil, err
+	}
+	isRepo := make(map[string]bool)
+	repoAt := func(dir string) bool {
+		is, ok := isRepo[dir]
+		if !ok {
+			_, err := os.Stat(filepath.Join(r.workTree, dir, ".git"))
+			is = err == nil
+			isRepo[dir] = is
+		}
+		return is
+	}
+	var repos []string
+	for _, entry := range strings.Split(out, "\x00") {
+		mode, path, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(mode, "160000 ") {
+			repos = append(repos, path)
+			continue
+		}
+		for i := strings.IndexByte(path, '/'); i >= 0; i = nextSlash(path, i) {
+			if repoAt(path[:i]) {
+				repos = append(repos, path[:i])
+				break
+			}
+		}
+	}
+	slices.Sort(repos)
+	return slices.Compact(repos), nil
+}
+
+func nextSlash(path string, i int) int {
+	j := strings.IndexByte(path[i+1:], '/')
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+// stageRepo replaces what is staged for the repository at dir with the files it holds, leaving out the files it
+// ignores itself.
+func (r *checkpointRepo) stageRepo(dir string) error {
+	files, err := repoFiles(r.workTree, dir)
+	if err != nil {
+		return err
+	}
+	staged, err := r.git("ls-files", "-z", "--", ":(literal)"+dir)
+	if err != nil {
+		return err
+	}
+	if _, err := r.gitInput(staged, "update-index", "-z", "--force-remove", "--stdin"); err != nil {
+		return err
+	}
+
+	var entries strings.Builder
+	var regular, modes []string
+	for _, path := range files {
+		info, err := os.Lstat(filepath.Join(r.workTree, path))
+		switch {
+		case err != nil:
+			continue
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(filepath.Join(r.workTree, path))
+			if err != nil {
+				continue
+			}
+			hash, err := r.gitInput(target, "hash-object", "-w", "--stdin")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&entries, "120000 %s\t%s\x00", hash, path)
+		// hash-object reads one path per line.
+		case info.Mode().IsRegular() && !strings.Contains(path, "\n"):
+			mode := "100644"
+			if info.Mode()&0o111 != 0 {
+				mode = "100755"
+			}
+			regular = append(regular, path)
+			modes = append(modes, mode)
+		}
+	}
+	if len(regular) > 0 {
+		out, err := r.gitInput(strings.Join(regular, "\n")+"\n", "hash-object", "-w", "--stdin-paths")
+		if err != nil {
+			return err
+		}
+		hashes := strings.Fields(out)
+		if len(hashes) != len(regular) {
+			return fmt.Errorf("git hash-object: hashed %d of %d files", len(hashes), len(regular))
+		}
+		for i, path := range regular {
+			fmt.Fprintf(&entries, "%s %s\t%s\x00", modes[i], hashes[i], path)
+		}
+	}
+	_, err = r.gitInput(entries.String(), "update-index", "-z", "--index-info")
+	return err
+}
+
+// repoFiles lists the files of the repository at dir within root, relative to root, including those of the
+// repositories inside it.
+func repoFiles(root, dir string) ([]string, error) {
+	cmd := exec.Command("git", "-C", filepath.Join(root, dir), "ls-files", "-z", "--cached", "--others",
+		"--exclude-standard")
+	cmd.Env = secrets.ChildEnv(cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("list the files of %s: %w: %s", dir, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var files []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name == "" {
+			continue
+		}
+		path := dir + "/" + strings.TrimSuffix(name, "/")
+		info, err := os.Lstat(filepath.Join(root, path))
+		if err != nil {
+			// Deleted files are still listed until they are staged.
+			continue
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		// Repositories inside the repository are listed as directories.
+		if _, err := os.Stat(filepath.Join(root, path, ".git")); err == nil {
+			inner, err := repoFiles(root, path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, inner...)
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+func (r *checkpointRepo) rev(callID string) (string, error) {
+	if !callIDRegex.MatchString(callID) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCallID, callID)
+	}
+	rev, err := r.git("rev-parse", "--verify", "--quiet", "refs/checkpoints/"+callID)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrCheckpointNotFound, callID)
+	}
+	return rev, nil
+}
+
+func (r *checkpointRepo) git(args ...string) (string, error) {
+	return r.gitInput("", args...)
+}
+
+// gitInput runs git with input as its standard input.
+func (r *checkpointRepo) gitInput(input string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"--git-dir", r.gitDir, "--work-tree", r.workTree,
+		"-c", "advice.addEmbeddedRepo=false"}, args...)...)
+	cmd.Dir = r.workTree
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = secrets.ChildEnv(cmd,
+		"GIT_AUTHOR_NAME=llum", "GIT_AUTHOR_EMAIL=llum@localhost",
+		"GIT_COMMITTER_NAME=llum", "GIT_COMMITTER_EMAIL=llum@localhost",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
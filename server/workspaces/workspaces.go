@@ -0,0 +1,372 @@
+// Package workspaces gives every chat its own directory for tools to work in.
+package workspaces
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zakkor/server/secrets"
+)
+
+var (
+	ErrInvalidChatID = errors.New("invalid chat ID")
+	ErrNotFound      = errors.New("workspace not found")
+)
+
+var chatIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}$`)
+
+type Options struct {
+	// Template is copied into new workspaces. If Repo is set instead, new workspaces are git worktrees of it.
+	Template string
+	Repo     string
+	// Quota is the number of bytes a workspace, with its checkpoints and snapshots, may use before tool calls in it
+	// are refused.
+	Quota int64
+	// IdleTimeout is how long a workspace can go unused before Cleanup deletes it.
+	IdleTimeout time.Duration
+	// MaxCheckpoints and MaxSnapshots are how many checkpoints and snapshots of a workspace are kept. Older ones are
+	// deleted. Zero keeps them all.
+	MaxCheckpoints int
+	MaxSnapshots   int
+}
+
+type Info struct {
+	ChatID string `json:"chat_id"`
+	Path   string `json:"path"`
+	// Size counts the workspace's checkpoints and snapshots, like its quota does.
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// sizeTTL is how long CheckQuota trusts the size it measured last, since measuring walks the whole workspace.
+const sizeTTL = time.Minute
+
+type measuredSize struct {
+	size int64
+	at   time.Time
+}
+
+type Manager struct {
+	root        string
+	snapshots   string
+	checkpoints string
+	// lastUse holds an empty file per workspace, whose modification time is when the workspace was last used.
+	lastUse string
+	opts    Options
+
+	// mu guards the maps. Work on a workspace is done under its chatLock instead.
+	mu    sync.Mutex
+	sizes map[string]measuredSize
+	locks map[string]*chatLock
+}
+
+// chatLock keeps the checkpoints and restores of a workspace from racing with each other and with the calls that
+// change it.
+type chatLock struct {
+	// calls is held for reading by the calls that change the workspace, and for writing by Restore and Delete.
+	calls sync.RWMutex
+	// git serializes the git commands that stage the workspace, which share an index.
+	git sync.Mutex
+	// dir serializes creating and deleting the workspace.
+	dir sync.Mutex
+}
+
+// New creates a manager that keeps workspaces and their snapshots under dir.
+func New(dir string, opts Options) (*Manager, error) {
+	m := &Manager{
+		root:        filepath.Join(dir, "workspaces"),
+		snapshots:   filepath.Join(dir, "snapshots"),
+		checkpoints: filepath.Join(dir, "checkpoints"),
+		lastUse:     filepath.Join(dir, "last-use"),
+		opts:        opts,
+		sizes:       make(map[string]measuredSize),
+		locks:       make(map[string]*chatLock),
+	}
+	for _, d := range []string{m.root, m.snapshots, m.checkpoints, m.lastUse} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Path returns the directory of chatID's workspace, without creating it.
+func (m *Manager) Path(chatID string) (string, error) {
+	if !chatIDRegex.MatchString(chatID) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidChatID, chatID)
+	}
+	return filepath.Join(m.root, chatID), nil
+}
+
+// Get returns the directory of chatID's workspace, creating and initializing it on first use.
+func (m *Manager) Get(chatID string) (string, error) {
+	path, err := m.Path(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	l := m.lock(chatID)
+	l.dir.Lock()
+	defer l.dir.Unlock()
+
+	if _, err := os.Stat(path); err != nil {
+		if err := m.init(path); err != nil {
+			os.RemoveAll(path)
+			return "", fmt.Errorf("initialize workspace: %w", err)
+		}
+	}
+	m.touch(chatID)
+	return path, nil
+}
+
+// touch records that chatID's workspace is being used. It is recorded on disk, so that Cleanup does not take
+// workspaces used before a restart for idle ones.
+func (m *Manager) touch(chatID string) {
+	path := filepath.Join(m.lastUse, chatID)
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); errors.Is(err, fs.ErrNotExist) {
+		os.WriteFile(path, nil, 0o644)
+	}
+}
+
+func (m *Manager) init(path string) error {
+	switch {
+	case m.opts.Repo != "":
+		return git(m.opts.Repo, "worktree", "add", "--detach", path)
+	case m.opts.Template != "":
+		return copyDir(m.opts.Template, path)
+	default:
+		return os.Mkdir(path, 0o755)
+	}
+}
+
+// Begin marks the start of a call that changes chatID's workspace. The workspace is not restored until the returned
+// function marks its end.
+func (m *Manager) Begin(chatID string) (end func()) {
+	l := m.lock(chatID)
+	l.calls.RLock()
+	return l.calls.RUnlock
+}
+
+func (m *Manager) lock(chatID string) *chatLock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := m.locks[chatID]
+	if l == nil {
+		l = &chatLock{}
+		m.locks[chatID] = l
+	}
+	return l
+}
+
+// CheckQuota fails if chatID's workspace uses more than its quota. The size is measured at most once per sizeTTL, so
+// a workspace can briefly exceed its quota.
+func (m *Manager) CheckQuota(chatID string) error {
+	if m.opts.Quota <= 0 {
+		return nil
+	}
+	if _, err := m.Path(chatID); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	measured, ok := m.sizes[chatID]
+	m.mu.Unlock()
+	if !ok || time.Since(measured.at) > sizeTTL {
+		measured = measuredSize{size: m.usage(chatID), at: time.Now()}
+		m.mu.Lock()
+		m.sizes[chatID] = measured
+		m.mu.Unlock()
+	}
+	if measured.size > m.opts.Quota {
+		return fmt.Errorf("workspace uses %d bytes, more than its quota of %d bytes", measured.size, m.opts.Quota)
+	}
+	return nil
+}
+
+// usage returns the bytes chatID's workspace, its checkpoints and its snapshots use.
+func (m *Manager) usage(chatID string) int64 {
+	return dirSize(filepath.Join(m.root, chatID)) + dirSize(filepath.Join(m.checkpoints, chatID+".git")) +
+		dirSize(filepath.Join(m.snapshots, chatID))
+}
+
+func (m *Manager) List() ([]Info, error) {
+	entries, err := os.ReadDir(m.root)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []Info{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		path := filepath.Join(m.root, e.Name())
+		list = append(list, Info{
+			ChatID:   e.Name(),
+			Path:     path,
+			Size:     m.usage(e.Name()),
+			LastUsed: m.lastUsed(e.Name(), path),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastUsed.After(list[j].LastUsed) })
+	return list, nil
+}
+
+// lastUsed returns when chatID's workspace at path was last used. It falls back to the modification time of the
+// workspace for workspaces whose use was never recorded.
+func (m *Manager) lastUsed(chatID, path string) time.Time {
+	info, err := os.Stat(filepath.Join(m.lastUse, chatID))
+	if err != nil {
+		if info, err = os.Stat(path); err != nil {
+			return time.Time{}
+		}
+	}
+	return info.ModTime()
+}
+
+// Delete removes chatID's workspace, its snapshots and its checkpoints. It waits for the calls changing the workspace
+// to end.
+func (m *Manager) Delete(chatID string) error {
+	path, err := m.Path(chatID)
+	if err != nil {
+		return err
+	}
+
+	l := m.lock(chatID)
+	l.calls.Lock()
+	defer l.calls.Unlock()
+	l.git.Lock()
+	defer l.git.Unlock()
+	l.dir.Lock()
+	defer l.dir.Unlock()
+
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	m.mu.Lock()
+	delete(m.sizes, chatID)
+	m.mu.Unlock()
+	os.Remove(filepath.Join(m.lastUse, chatID))
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	if m.opts.Repo != "" {
+		git(m.opts.Repo, "worktree", "prune")
+	}
+	if err := os.RemoveAll(filepath.Join(m.checkpoints, chatID+".git")); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(m.snapshots, chatID))
+}
+
+// Cleanup deletes the workspaces that have been idle for longer than the idle timeout, calling onDelete before each,
+// e.g. to stop what still runs in it. Checkpoints, snapshots and last uses left of workspaces that no longer exist are
+// deleted once they are as old.
+func (m *Manager) Cleanup(onDelete func(chatID string)) error {
+	if m.opts.IdleTimeout <= 0 {
+		return nil
+	}
+	list, err := m.List()
+	if err != nil {
+		return err
+	}
+	for _, info := range list {
+		if time.Since(info.LastUsed) > m.opts.IdleTimeout {
+			onDelete(info.ChatID)
+			if err := m.Delete(info.ChatID); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, dir := range []string{m.checkpoints, m.snapshots, m.lastUse} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			chatID := strings.TrimSuffix(e.Name(), ".git")
+			if _, err := os.Stat(filepath.Join(m.root, chatID)); !errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > m.opts.IdleTimeout {
+				if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func git(dir string, args ...string) error {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = secrets.ChildEnv(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s: %w: %s", args[0], err, out)
+	}
+	return nil
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(target, data, info.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+}
@@ -1,5 +1,5 @@
 import { get } from 'svelte/store';
-import { controller, params, toolSchema } from './stores.js';
+import { controller, params, providerToolSchema, toolSchema } from './stores.js';
 import { headersForFetch, providers } from './providers.js';
 
 export async function complete(convo, onupdate, onabort) {
@@ -41,9 +41,15 @@ export async function complete(convo, onupdate, onabort) {
 		.map((group) => group.schema)
 		.flat();
 
+	// Server tools are sent as the server converted them for the provider, client tools are converted here.
+	const converted =
+		get(providerToolSchema)[model.provider === 'Anthropic' ? 'anthropic' : 'openai'] || {};
 	const activeSchema = schema
 		.filter((tool) => (convo.tools || []).includes(tool.function.name))
 		.map((tool) => {
+			if (converted[tool.function.name]) {
+				return converted[tool.function.name];
+			}
 			if (model.provider === 'Anthropic') {
 				return toolSchemaToAnthropicFormat(tool);
 			}
@@ -263,8 +269,13 @@ function messageToOpenAIFormat(msg) {
 			...msg.contentParts,
 		];
 	} else if (msg.role === 'tool') {
-		msgConverted.content =
-			typeof msg.content === 'object' ? JSON.stringify(msg.content) : msg.content;
+		if (msg.content?.contentType === 'multipart/mixed') {
+			// Send the text rendition of rich results, since tool messages can't hold images.
+			msgConverted.content = msg.content.content;
+		} else {
+			msgConverted.content =
+				typeof msg.content === 'object' ? JSON.stringify(msg.content) : msg.content;
+		}
 	} else {
 		msgConverted.content = msg.content;
 	}
@@ -291,6 +302,20 @@ function messageToOpenAIFormat(msg) {
 	return msgConverted;
 }
 
+function imagePartToAnthropicFormat(part) {
+	if (part.url) {
+		return { type: 'image', source: { type: 'url', url: part.url } };
+	}
+	return {
+		type: 'image',
+		source: {
+			type: 'base64',
+			media_type: part.contentType,
+			data: part.content.slice(`data:${part.contentType};base64,`.length),
+		},
+	};
+}
+
 function messageToAnthropicFormat(msg) {
 	const msgConverted = {
 		role: msg.role === 'tool' ? 'user' : msg.role,
@@ -327,6 +352,14 @@ function messageToAnthropicFormat(msg) {
 						},
 					},
 				];
+			} else if (msg.content.contentType === 'multipart/mixed') {
+				content = [
+					{ type: 'text', text: msg.content.content },
+					...msg.content.parts
+						// Artifacts on the tool server can't be fetched by the provider.
+						.filter((part) => part.type === 'image' && !part.url?.startsWith('/'))
+						.map(imagePartToAnthropicFormat),
+				];
 			} else {
 				content = JSON.stringify(msg.content);
 			}
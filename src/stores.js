@@ -17,6 +17,7 @@ export const params = persisted('params', {
 
 export const config = persisted('config', {
 	explicitToolView: false,
+	previewTools: false,
 });
 
 export const openaiAPIKey = persisted('openaiAPIKey', '');
@@ -50,3 +51,7 @@ export const syncServer = persisted('syncServer', {
 	password: '',
 });
 export const toolSchema = persisted('toolSchemaGroups', []);
+// The server's tools converted by the server for each provider's API, keyed by format and then by tool name.
+export const providerToolSchema = persisted('providerToolSchema', {});
+// Dry-run previews of server-side tool calls waiting for the user to run or reject them, keyed by tool call ID.
+export const toolPreviews = writable({});